@@ -0,0 +1,400 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// How a character printed by a program looks, colors are nil when the
+// program didn't set them so the theme's are used
+type cellStyle struct {
+	fg			color.Color
+	bg			color.Color
+	bold		bool
+	italic		bool
+	underline	bool
+	inverse		bool
+}
+
+type cell struct {
+	r		rune
+	style	cellStyle
+}
+
+// Interprets what programs print the way a terminal would: SGR escape
+// sequences style the text, carriage returns and cursor movements let
+// progress bars overwrite their own lines, and lines can be cleared.
+// Lines are kept in a ring, the oldest ones are dropped past the limits
+// and the ones longer than the size limit are wrapped
+type terminal struct {
+	ring		[][]cell
+	first		int
+	count		int
+	// Lines dropped from the start, and characters kept including line breaks
+	dropped		int
+	size		int
+	maxLines	int
+	maxSize		int
+	row			int
+	col			int
+	style		cellStyle
+	// Part of an escape sequence cut at the end of what was written
+	pending		string
+	// The first line changed since the changes were last taken, counted
+	// from the first line ever printed
+	changed		int
+}
+
+func newTerminal(maxLines, maxSize int) *terminal {
+	t := &terminal{}
+	t.setLimits(maxLines, maxSize)
+	t.reset()
+	return t
+}
+
+// Meant to be followed by a reset, lines kept before are not dropped
+func (t *terminal) setLimits(maxLines, maxSize int) {
+	t.maxLines, t.maxSize = max(maxLines, 1), max(maxSize, 1)
+}
+
+func (t *terminal) reset() {
+	t.ring = make([][]cell, min(t.maxLines, 64))
+	t.first, t.count, t.dropped, t.size = 0, 1, 0, 0
+	t.row, t.col = 0, 0
+	t.style = cellStyle{}
+	t.pending = ""
+	t.changed = 0
+}
+
+// The line at the given index, counting from the oldest one kept
+func (t *terminal) line(i int) []cell {
+	return t.ring[(t.first+i)%len(t.ring)]
+}
+
+func (t *terminal) setLine(i int, line []cell) {
+	t.size += len(line) - len(t.line(i))
+	t.ring[(t.first+i)%len(t.ring)] = line
+	t.touch(i)
+}
+
+func (t *terminal) touch(i int) {
+	t.changed = min(t.changed, t.dropped+i)
+}
+
+// The first line changed since the last time this was called, lines before
+// it are as they were then. It's past the last line when none changed
+func (t *terminal) takeChanged() int {
+	changed := t.changed
+	t.changed = t.dropped + t.count
+	return changed
+}
+
+// Adds an empty line at the end, dropping the oldest ones when there are
+// too many. The ring doubles as needed up to the line limit
+func (t *terminal) push() {
+	if t.count == len(t.ring) {
+		if t.count < t.maxLines {
+			ring := make([][]cell, min(t.maxLines, 2*len(t.ring)))
+			for i := 0; i < t.count; i++ {
+				ring[i] = t.line(i)
+			}
+			t.ring, t.first = ring, 0
+		} else {
+			t.drop()
+		}
+	}
+
+	t.ring[(t.first+t.count)%len(t.ring)] = nil
+	t.touch(t.count)
+	t.count++
+	t.size++
+	for t.size > t.maxSize && t.count > 1 {
+		t.drop()
+	}
+}
+
+func (t *terminal) drop() {
+	t.size -= len(t.line(0)) + 1
+	t.ring[t.first] = nil
+	t.first = (t.first + 1) % len(t.ring)
+	t.count--
+	t.dropped++
+	t.row = max(t.row-1, 0)
+}
+
+func (t *terminal) write(s string) {
+	s = t.pending + s
+	t.pending = ""
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		switch r {
+		case '\x1b':
+			n, ok := t.escape(s[i:])
+			if !ok {
+				t.pending = s[i:]
+				return
+			}
+			size = n
+		case '\n':
+			t.moveTo(t.row+1, 0)
+		case '\r':
+			t.col = 0
+		case '\b':
+			t.col = max(t.col-1, 0)
+		case '\t':
+			t.put(' ')
+			for t.col%8 != 0 {
+				t.put(' ')
+			}
+		case '\a', '\x00':
+		default:
+			t.put(r)
+		}
+		i += size
+	}
+}
+
+// Writes a character at the cursor, overwriting the one there. Lines are
+// wrapped at the size limit, so a program that never prints a line break
+// still has its oldest output dropped
+func (t *terminal) put(r rune) {
+	if t.col >= t.maxSize {
+		t.moveTo(t.row+1, 0)
+	}
+
+	line := t.line(t.row)
+	for len(line) < t.col {
+		line = append(line, cell{r: ' '})
+	}
+
+	if t.col < len(line) {
+		line[t.col] = cell{r: r, style: t.style}
+	} else {
+		line = append(line, cell{r: r, style: t.style})
+	}
+
+	t.setLine(t.row, line)
+	t.col++
+	for t.size > t.maxSize && t.count > 1 {
+		t.drop()
+	}
+}
+
+func (t *terminal) moveTo(row, col int) {
+	for row >= t.count {
+		before := t.dropped
+		t.push()
+		row -= t.dropped - before
+	}
+
+	t.row, t.col = max(row, 0), max(col, 0)
+}
+
+// Handles the escape sequence s starts with, returning how long it is or
+// false when it's cut short
+func (t *terminal) escape(s string) (int, bool) {
+	if len(s) < 2 {
+		return 0, false
+	}
+
+	switch s[1] {
+	case '[':
+		// Control sequences end with a byte in the @ to ~ range, the ones
+		// that don't end soon are not sequences a program meant to print
+		for i := 2; i < min(len(s), ESCAPE_LIMIT); i++ {
+			if s[i] >= '@' && s[i] <= '~' {
+				t.control(s[2:i], s[i])
+				return i + 1, true
+			}
+		}
+		return 2, len(s) >= ESCAPE_LIMIT
+	case ']':
+		// Operating system commands, such as setting the window title, end
+		// with BEL or ESC \. Unterminated ones are printed like control
+		// sequences that don't end
+		for i := 2; i < min(len(s), ESCAPE_LIMIT); i++ {
+			if s[i] == '\a' {
+				return i + 1, true
+			}
+			if s[i] == '\x1b' && i+1 < len(s) && s[i+1] == '\\' {
+				return i + 2, true
+			}
+		}
+		return 2, len(s) >= ESCAPE_LIMIT
+	}
+
+	return 2, true
+}
+
+func (t *terminal) control(params string, final byte) {
+	args := make([]int, 0)
+	for _, param := range strings.Split(strings.TrimLeft(params, "?"), ";") {
+		n, _ := strconv.Atoi(param)
+		args = append(args, n)
+	}
+	arg := func(i, fallback int) int {
+		if i < len(args) && args[i] > 0 {
+			return args[i]
+		}
+		return fallback
+	}
+
+	switch final {
+	case 'm':
+		t.sgr(args)
+	case 'A':
+		t.moveTo(t.row-arg(0, 1), t.col)
+	case 'B':
+		t.moveTo(t.row+arg(0, 1), t.col)
+	case 'C':
+		t.col += arg(0, 1)
+	case 'D':
+		t.col = max(t.col-arg(0, 1), 0)
+	case 'G':
+		t.col = arg(0, 1) - 1
+	case 'K':
+		line := t.line(t.row)
+		switch arg(0, 0) {
+		case 0:
+			t.setLine(t.row, line[:min(t.col, len(line))])
+		case 1:
+			for i := 0; i < min(t.col+1, len(line)); i++ {
+				line[i] = cell{r: ' '}
+			}
+			t.touch(t.row)
+		case 2:
+			t.setLine(t.row, line[:0])
+		}
+	case 'J':
+		// Clearing the screen clears everything printed so far, as the
+		// console has no screen apart from its history
+		if arg(0, 0) >= 2 {
+			t.reset()
+		}
+	}
+}
+
+// Select graphic rendition, the sequences that set colors and attributes
+func (t *terminal) sgr(args []int) {
+	for i := 0; i < len(args); i++ {
+		switch n := args[i]; {
+		case n == 0:
+			t.style = cellStyle{}
+		case n == 1:
+			t.style.bold = true
+		case n == 3:
+			t.style.italic = true
+		case n == 4:
+			t.style.underline = true
+		case n == 7:
+			t.style.inverse = true
+		case n == 22:
+			t.style.bold = false
+		case n == 23:
+			t.style.italic = false
+		case n == 24:
+			t.style.underline = false
+		case n == 27:
+			t.style.inverse = false
+		case n >= 30 && n <= 37:
+			t.style.fg = ansiColor(n - 30)
+		case n >= 90 && n <= 97:
+			t.style.fg = ansiColor(n - 90 + 8)
+		case n == 39:
+			t.style.fg = nil
+		case n >= 40 && n <= 47:
+			t.style.bg = ansiColor(n - 40)
+		case n >= 100 && n <= 107:
+			t.style.bg = ansiColor(n - 100 + 8)
+		case n == 49:
+			t.style.bg = nil
+		case n == 38 || n == 48:
+			col, used := extendedColor(args[i+1:])
+			if n == 38 {
+				t.style.fg = col
+			} else {
+				t.style.bg = col
+			}
+			i += used
+		}
+	}
+}
+
+// Colors given as 5;n from the 256 color palette or as 2;r;g;b
+func extendedColor(args []int) (color.Color, int) {
+	switch {
+	case len(args) >= 2 && args[0] == 5:
+		return ansiColor(args[1]), 2
+	case len(args) >= 4 && args[0] == 2:
+		return color.NRGBA{R: uint8(args[1]), G: uint8(args[2]), B: uint8(args[3]), A: 0xff}, 4
+	}
+
+	return nil, len(args)
+}
+
+// The 16 basic colors as xterm draws them
+var ansiPalette = []uint32{
+	0x000000, 0xcd0000, 0x00cd00, 0xcdcd00, 0x0000ee, 0xcd00cd, 0x00cdcd, 0xe5e5e5,
+	0x7f7f7f, 0xff0000, 0x00ff00, 0xffff00, 0x5c5cff, 0xff00ff, 0x00ffff, 0xffffff,
+}
+
+// A color of the 256 color palette: the basic colors, a 6x6x6 cube and
+// a ramp of grays
+func ansiColor(n int) color.Color {
+	switch {
+	case n < 0 || n > 255:
+		return nil
+	case n < 16:
+		rgb := ansiPalette[n]
+		return color.NRGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xff}
+	case n < 232:
+		n -= 16
+		level := func(v int) uint8 {
+			if v == 0 {
+				return 0
+			}
+			return uint8(55 + v*40)
+		}
+		return color.NRGBA{R: level(n / 36), G: level(n / 6 % 6), B: level(n % 6), A: 0xff}
+	}
+
+	gray := uint8(8 + (n-232)*10)
+	return color.NRGBA{R: gray, G: gray, B: gray, A: 0xff}
+}
+
+// The text as it would be left on a terminal, without escape sequences
+func (t *terminal) String() string {
+	var b strings.Builder
+	for i := 0; i < t.count; i++ {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(lineText(t.line(i)))
+	}
+
+	return b.String()
+}
+
+func lineText(line []cell) string {
+	runes := make([]rune, 0, len(line))
+	for _, c := range line {
+		runes = append(runes, c.r)
+	}
+
+	return string(runes)
+}
+
+func stripANSI(s string) string {
+	t := newTerminal(math.MaxInt32, math.MaxInt32)
+	t.write(s)
+	return t.String()
+}
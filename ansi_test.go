@@ -0,0 +1,136 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestTerminalWrite(t *testing.T) {
+	tests := []struct {
+		name	string
+		// Written one after the other, as programs may flush anywhere
+		writes	[]string
+		want	string
+	}{
+		{name: "plain text", writes: []string{"hello\nworld"}, want: "hello\nworld"},
+		{name: "colors", writes: []string{"\x1b[31mred\x1b[0m plain"}, want: "red plain"},
+		{name: "progress line", writes: []string{"progress 10%\rprogress 100%\n"}, want: "progress 100%\n"},
+		{name: "progress line over flushes", writes: []string{"10%", "\r", "100%"}, want: "100%"},
+		{name: "carriage return overwrites", writes: []string{"abc\rx"}, want: "xbc"},
+		{name: "carriage return and clear", writes: []string{"hello\rhe\x1b[K"}, want: "he"},
+		{name: "clear line", writes: []string{"abc\x1b[2Kx"}, want: "   x"},
+		{name: "backspace", writes: []string{"ab\bc"}, want: "ac"},
+		{name: "tab", writes: []string{"a\tb"}, want: "a       b"},
+		{name: "cursor up", writes: []string{"1\n2\n\x1b[1A\x1b[2K\rX"}, want: "1\nX\n"},
+		{name: "cursor forward", writes: []string{"a\x1b[3Cb"}, want: "a   b"},
+		{name: "clear screen", writes: []string{"old\n\x1b[2Jnew"}, want: "new"},
+		{name: "osc ended by bel", writes: []string{"\x1b]0;title\aok"}, want: "ok"},
+		{name: "osc ended by st", writes: []string{"\x1b]0;title\x1b\\ok"}, want: "ok"},
+		{name: "split after esc", writes: []string{"a\x1b", "[1mb"}, want: "ab"},
+		{name: "split csi", writes: []string{"\x1b[3", "1mred"}, want: "red"},
+		{name: "split csi over several writes", writes: []string{"\x1b[", "38;5", ";196", "m", "x"}, want: "x"},
+		{name: "split osc", writes: []string{"\x1b]0;ti", "tle\a", "ok"}, want: "ok"},
+		{name: "split st", writes: []string{"\x1b]0;title\x1b", "\\ok"}, want: "ok"},
+		{name: "csi past the escape limit", writes: []string{"\x1b[" + strings.Repeat("1", ESCAPE_LIMIT)}, want: strings.Repeat("1", ESCAPE_LIMIT)},
+		{name: "osc past the escape limit", writes: []string{"\x1b]" + strings.Repeat("x", ESCAPE_LIMIT)}, want: strings.Repeat("x", ESCAPE_LIMIT)},
+		{name: "split osc past the escape limit", writes: []string{"\x1b]0;", strings.Repeat("x", ESCAPE_LIMIT/2), strings.Repeat("x", ESCAPE_LIMIT)}, want: "0;" + strings.Repeat("x", ESCAPE_LIMIT/2+ESCAPE_LIMIT)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			term := newTerminal(math.MaxInt32, math.MaxInt32)
+			for _, s := range test.writes {
+				term.write(s)
+			}
+
+			if got := term.String(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if len(term.pending) > 0 {
+				t.Errorf("%q is still pending", term.pending)
+			}
+		})
+	}
+}
+
+func TestTerminalStyle(t *testing.T) {
+	tests := []struct {
+		name	string
+		writes	[]string
+		// The style of the last character written
+		want	cellStyle
+	}{
+		{name: "default", writes: []string{"x"}, want: cellStyle{}},
+		{name: "bold and color", writes: []string{"\x1b[1;31mx"}, want: cellStyle{fg: ansiColor(1), bold: true}},
+		{name: "bright colors", writes: []string{"\x1b[92;104mx"}, want: cellStyle{fg: ansiColor(10), bg: ansiColor(12)}},
+		{name: "palette color", writes: []string{"\x1b[38;5;196mx"}, want: cellStyle{fg: ansiColor(196)}},
+		{name: "rgb color", writes: []string{"\x1b[48;2;1;2;3mx"}, want: cellStyle{bg: color.NRGBA{R: 1, G: 2, B: 3, A: 0xff}}},
+		{name: "attributes", writes: []string{"\x1b[3;4;7mx"}, want: cellStyle{italic: true, underline: true, inverse: true}},
+		{name: "attributes turned off", writes: []string{"\x1b[1;3m\x1b[22;23mx"}, want: cellStyle{}},
+		{name: "default colors", writes: []string{"\x1b[31;41m\x1b[39;49mx"}, want: cellStyle{}},
+		{name: "reset", writes: []string{"\x1b[1;31m\x1b[0mx"}, want: cellStyle{}},
+		{name: "reset without arguments", writes: []string{"\x1b[1;31m\x1b[mx"}, want: cellStyle{}},
+		{name: "split sequence", writes: []string{"\x1b[1;3", "2mx"}, want: cellStyle{fg: ansiColor(2), bold: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			term := newTerminal(math.MaxInt32, math.MaxInt32)
+			for _, s := range test.writes {
+				term.write(s)
+			}
+
+			line := term.line(term.count - 1)
+			if got := line[len(line)-1].style; got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTerminalLimits(t *testing.T) {
+	tests := []struct {
+		name		string
+		maxLines	int
+		maxSize		int
+		writes		[]string
+		want		string
+		dropped		int
+	}{
+		{name: "within the limits", maxLines: 3, maxSize: 100, writes: []string{"a\nb\nc"}, want: "a\nb\nc"},
+		{name: "line limit", maxLines: 3, maxSize: 100, writes: []string{"a\nb\nc\nd\ne"}, want: "c\nd\ne", dropped: 2},
+		{name: "line limit with a trailing break", maxLines: 3, maxSize: 100, writes: []string{"a\nb\nc\n"}, want: "b\nc\n", dropped: 1},
+		{name: "ring grows past its initial size", maxLines: 100, maxSize: 1000, writes: []string{strings.Repeat("x\n", 150)}, want: strings.Repeat("x\n", 99), dropped: 51},
+		{name: "size limit", maxLines: 100, maxSize: 10, writes: []string{"0123\n4567\n89ab"}, want: "4567\n89ab", dropped: 1},
+		{name: "no line breaks", maxLines: 100, maxSize: 10, writes: []string{strings.Repeat("x", 20)}, want: strings.Repeat("x", 10), dropped: 1},
+		{name: "no line breaks over flushes", maxLines: 100, maxSize: 10, writes: strings.Split(strings.Repeat("x", 25), ""), want: strings.Repeat("x", 5), dropped: 2},
+		{name: "long line after short ones", maxLines: 100, maxSize: 10, writes: []string{"a\nb\n", strings.Repeat("x", 12)}, want: "xx", dropped: 3},
+		{name: "progress line doesn't grow", maxLines: 100, maxSize: 10, writes: []string{strings.Repeat("\r50%", 100)}, want: "50%"},
+		{name: "cursor past the size limit", maxLines: 100, maxSize: 10, writes: []string{"\x1b[20Cx"}, want: "\nx"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			term := newTerminal(test.maxLines, test.maxSize)
+			for _, s := range test.writes {
+				term.write(s)
+			}
+
+			if got := term.String(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if term.dropped != test.dropped {
+				t.Errorf("got %d dropped lines, want %d", term.dropped, test.dropped)
+			}
+			if term.count > test.maxLines || term.size > test.maxSize {
+				t.Errorf("%d lines and %d characters kept, past the limits", term.count, term.size)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// A position in the buffer, columns count runes rather than bytes
+type textPos struct {
+	row	int
+	col	int
+}
+
+func (p textPos) before(other textPos) bool {
+	return p.row < other.row || p.row == other.row && p.col < other.col
+}
+
+// Returns both positions in the order they appear in the buffer
+func orderPos(a, b textPos) (textPos, textPos) {
+	if b.before(a) {
+		return b, a
+	}
+
+	return a, b
+}
+
+// The code being edited, kept as lines so edits only touch the lines they
+// change. There is always at least one, possibly empty, line
+type buffer struct {
+	mu		sync.Mutex
+	lines	[][]rune
+	text	string
+	stale	bool
+}
+
+func newBuffer(text string) *buffer {
+	b := &buffer{}
+	b.setText(text)
+	return b
+}
+
+func (b *buffer) setText(text string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lines = splitLines(text)
+	b.text = text
+	b.stale = false
+}
+
+func splitLines(text string) [][]rune {
+	parts := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	lines := make([][]rune, 0, len(parts))
+	for _, part := range parts {
+		lines = append(lines, []rune(part))
+	}
+
+	return lines
+}
+
+// The whole code, joined only when it changed since the last call. Safe to
+// call from other goroutines, such as the session's autosave
+func (b *buffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.stale {
+		return b.text
+	}
+
+	var sb strings.Builder
+	for i, line := range b.lines {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(string(line))
+	}
+
+	b.text = sb.String()
+	b.stale = false
+	return b.text
+}
+
+func (b *buffer) lineCount() int {
+	return len(b.lines)
+}
+
+// The lines as they are now, which can be read from any goroutine as edits
+// replace lines instead of changing them
+func (b *buffer) snapshot() [][]rune {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.lines
+}
+
+func (b *buffer) line(row int) []rune {
+	return b.lines[row]
+}
+
+// Moves the position inside the buffer, so it can be used safely
+func (b *buffer) clamp(p textPos) textPos {
+	if p.row < 0 {
+		return textPos{}
+	} else if p.row >= len(b.lines) {
+		last := len(b.lines) - 1
+		return textPos{row: last, col: len(b.lines[last])}
+	}
+
+	p.col = min(max(p.col, 0), len(b.lines[p.row]))
+	return p
+}
+
+func (b *buffer) end() textPos {
+	last := len(b.lines) - 1
+	return textPos{row: last, col: len(b.lines[last])}
+}
+
+func (b *buffer) slice(start, end textPos) string {
+	start, end = orderPos(b.clamp(start), b.clamp(end))
+	if start.row == end.row {
+		return string(b.lines[start.row][start.col:end.col])
+	}
+
+	var sb strings.Builder
+	sb.WriteString(string(b.lines[start.row][start.col:]))
+	for row := start.row + 1; row < end.row; row++ {
+		sb.WriteByte('\n')
+		sb.WriteString(string(b.lines[row]))
+	}
+	sb.WriteByte('\n')
+	sb.WriteString(string(b.lines[end.row][:end.col]))
+
+	return sb.String()
+}
+
+// Replaces the code between both positions with the given text, which is
+// the single way the buffer is edited. Returns where the new text ends
+func (b *buffer) replace(start, end textPos, text string) textPos {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	start, end = orderPos(b.clamp(start), b.clamp(end))
+
+	head := b.lines[start.row][:start.col]
+	tail := b.lines[end.row][end.col:]
+	inserted := splitLines(text)
+
+	last := len(inserted) - 1
+	newEnd := textPos{row: start.row + last, col: len(inserted[last])}
+	if last == 0 {
+		newEnd.col += len(head)
+	}
+
+	replacement := make([][]rune, len(inserted))
+	for i, line := range inserted {
+		replacement[i] = line
+	}
+	replacement[0] = append(append([]rune{}, head...), replacement[0]...)
+	replacement[last] = append(append([]rune{}, replacement[last]...), tail...)
+
+	lines := make([][]rune, 0, len(b.lines)-(end.row-start.row)+last)
+	lines = append(lines, b.lines[:start.row]...)
+	lines = append(lines, replacement...)
+	lines = append(lines, b.lines[end.row+1:]...)
+	b.lines = lines
+	b.stale = true
+
+	return newEnd
+}
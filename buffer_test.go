@@ -0,0 +1,126 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import "testing"
+
+func TestBufferReplace(t *testing.T) {
+	tests := []struct {
+		name	string
+		text	string
+		start	textPos
+		end		textPos
+		insert	string
+		want	string
+		wantEnd	textPos
+	}{
+		{
+			name: "insert into a line",
+			text: "fmt.Println()",
+			start: textPos{0, 12},
+			end: textPos{0, 12},
+			insert: `"hi"`,
+			want: `fmt.Println("hi")`,
+			wantEnd: textPos{0, 16},
+		},
+		{
+			name: "insert lines",
+			text: "a\nd",
+			start: textPos{0, 1},
+			end: textPos{0, 1},
+			insert: "\nb\nc",
+			want: "a\nb\nc\nd",
+			wantEnd: textPos{2, 1},
+		},
+		{
+			name: "delete across lines",
+			text: "one\ntwo\nthree",
+			start: textPos{0, 2},
+			end: textPos{2, 2},
+			insert: "",
+			want: "onree",
+			wantEnd: textPos{0, 2},
+		},
+		{
+			name: "replace lines with lines",
+			text: "a\nb\nc",
+			start: textPos{0, 1},
+			end: textPos{1, 1},
+			insert: "x\ny",
+			want: "ax\ny\nc",
+			wantEnd: textPos{1, 1},
+		},
+		{
+			name: "positions in reverse order",
+			text: "hello world",
+			start: textPos{0, 11},
+			end: textPos{0, 5},
+			insert: "!",
+			want: "hello!",
+			wantEnd: textPos{0, 6},
+		},
+		{
+			name: "positions outside the buffer are clamped",
+			text: "a\nb",
+			start: textPos{-1, 0},
+			end: textPos{5, 5},
+			insert: "c",
+			want: "c",
+			wantEnd: textPos{0, 1},
+		},
+		{
+			name: "columns past the end of a line",
+			text: "ab\ncd",
+			start: textPos{0, 10},
+			end: textPos{1, 0},
+			insert: "",
+			want: "abcd",
+			wantEnd: textPos{0, 2},
+		},
+		{
+			name: "columns count runes",
+			text: "héllo",
+			start: textPos{0, 1},
+			end: textPos{0, 2},
+			insert: "ë",
+			want: "hëllo",
+			wantEnd: textPos{0, 2},
+		},
+		{
+			name: "carriage returns are dropped",
+			text: "",
+			start: textPos{0, 0},
+			end: textPos{0, 0},
+			insert: "a\r\nb",
+			want: "a\nb",
+			wantEnd: textPos{1, 1},
+		},
+		{
+			name: "trailing line break",
+			text: "a",
+			start: textPos{0, 1},
+			end: textPos{0, 1},
+			insert: "\n",
+			want: "a\n",
+			wantEnd: textPos{1, 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newBuffer(test.text)
+			end := b.replace(test.start, test.end, test.insert)
+			if got := b.String(); got != test.want {
+				t.Errorf("got text %q, want %q", got, test.want)
+			}
+			if end != test.wantEnd {
+				t.Errorf("got end %v, want %v", end, test.wantEnd)
+			}
+			if got := b.slice(textPos{}, b.end()); got != test.want {
+				t.Errorf("got slice %q, want %q", got, test.want)
+			}
+		})
+	}
+}
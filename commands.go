@@ -2,60 +2,135 @@
 	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
 	SPDX-License-Identifier: MIT
 */
-
-//go:build !windows
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"time"
+	"runtime"
 )
 
 // Either run code from an existing snippet, or create a temporary .go file
-// that gets executed and deleted
-func runCode(snippet string, data []byte) (string, error) {
+// that gets executed and deleted, with the arguments, environment and build
+// flags of the configuration. Every command is passed to onCommand before
+// it starts, what the program prints is written to stdout and stderr as it
+// prints it, and cancelling the context stops the program. The
+// exit code is -1 when it didn't exit on its own, and RUN_BUILD_FAILED when
+// it couldn't be built
+func runCode(ctx context.Context, snippet string, data []byte, config runConfig, onCommand func(args []string), stdout, stderr io.Writer) (int, error) {
+	if len(os.Getenv("RUNGO_GO_BIN")) == 0 {
+		return -1, errNoGoVersion
+	}
+
+	binDir, err := os.MkdirTemp(os.Getenv("RUNGO_CACHE_DIR"), "run-*")
+	if err != nil {
+		return -1, err
+	}
+	binary := filepath.Join(binDir, "main")
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+
 	if len(snippet) > 0 {
-		dir := filepath.Join(os.Getenv("RUNGO_APP_DIR"), SNIPPETS_DIR, snippet)
+		dir := filepath.Join(os.Getenv("RUNGO_DATA_DIR"), SNIPPETS_DIR, snippet)
 		err := os.WriteFile(filepath.Join(dir, "main.go"), data, 0644)
 		if err != nil {
-			return "", err
+			return -1, errors.Join(err, os.RemoveAll(binDir))
 		}
 
 		cmd := exec.Command(os.Getenv("RUNGO_GO_BIN"), "mod", "tidy")
 		cmd.Dir = dir
-		err = cmd.Run()
+		hideWindow(cmd)
+		tidyOutput, err := cmd.CombinedOutput()
 		if err != nil {
-			return "", err
+			return -1, errors.Join(&commandError{args: []string{"go", "mod", "tidy"}, output: string(tidyOutput), err: err}, os.RemoveAll(binDir))
 		}
 
-		cmd = exec.Command(os.Getenv("RUNGO_GO_BIN"), "run", "main.go")
-		cmd.Dir = dir
-		output, _ := cmd.CombinedOutput()
-
-		return string(output), nil
+		code, err := buildAndRun(ctx, dir, "main.go", binary, config, onCommand, stdout, stderr)
+		return code, errors.Join(err, os.RemoveAll(binDir))
 	}
 
-	file := filepath.Join(os.Getenv("RUNGO_APP_DIR"), fmt.Sprintf("%d.go", time.Now().Unix()))
-	err := os.WriteFile(file, data, 0644)
+	// Every run gets its own file, so runs of several tabs don't collide
+	f, err := os.CreateTemp(os.Getenv("RUNGO_CACHE_DIR"), "*.go")
+	if err != nil {
+		return -1, errors.Join(err, os.RemoveAll(binDir))
+	}
+	file := f.Name()
+	_, err = f.Write(data)
+	err = errors.Join(err, f.Close())
 	if err != nil {
-		return "", err
+		return -1, errors.Join(err, os.Remove(file), os.RemoveAll(binDir))
+	}
+
+	code, err := buildAndRun(ctx, "", file, binary, config, onCommand, stdout, stderr)
+	return code, errors.Join(err, os.Remove(file), os.RemoveAll(binDir))
+}
+
+// The program is built apart from running it, so the exit code is its own
+// rather than the one go run exits with. Build errors are written to stderr
+// like the program's
+func buildAndRun(ctx context.Context, dir, file, binary string, config runConfig, onCommand func(args []string), stdout, stderr io.Writer) (int, error) {
+	env := append(append(os.Environ(), consoleEnv()...), config.environ()...)
+
+	args := config.buildArgs(binary, file)
+	onCommand(append([]string{"go"}, args...))
+	cmd := exec.CommandContext(ctx, os.Getenv("RUNGO_GO_BIN"), args...)
+	cmd.Dir, cmd.Env = dir, env
+	stopTreeOnCancel(cmd)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	code, err := exitCode(cmd.Run())
+	switch {
+	case err != nil || ctx.Err() != nil:
+		return -1, err
+	case code != 0:
+		return RUN_BUILD_FAILED, nil
 	}
 
-	output, _ := exec.Command(os.Getenv("RUNGO_GO_BIN"), "run", file).CombinedOutput()
+	onCommand(append([]string{binary}, config.Args...))
+	cmd = exec.CommandContext(ctx, binary, config.Args...)
+	cmd.Dir, cmd.Env = dir, env
+	stopTreeOnCancel(cmd)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	return exitCode(cmd.Run())
+}
+
+// Runs the tests found next to the snippet's main.go, scratch code has
+// nowhere to keep tests so it can't be tested
+func testCode(ctx context.Context, snippet string, data []byte, config runConfig, onCommand func(args []string), stdout, stderr io.Writer) (int, error) {
+	if len(os.Getenv("RUNGO_GO_BIN")) == 0 {
+		return -1, errNoGoVersion
+	} else if len(snippet) == 0 {
+		return -1, errNotSnippet
+	}
 
-	err = os.Remove(file)
+	dir := filepath.Join(os.Getenv("RUNGO_DATA_DIR"), SNIPPETS_DIR, snippet)
+	err := os.WriteFile(filepath.Join(dir, "main.go"), data, 0644)
 	if err != nil {
-		return "", err
+		return -1, err
 	}
 
-	return string(output), nil
+	args := config.testArgs()
+	onCommand(append([]string{"go"}, args...))
+	cmd := exec.CommandContext(ctx, os.Getenv("RUNGO_GO_BIN"), args...)
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), consoleEnv()...), config.environ()...)
+	stopTreeOnCancel(cmd)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	return exitCode(cmd.Run())
 }
 
 func newSnippet(snippet string, data []byte) error {
-	dir := filepath.Join(os.Getenv("RUNGO_APP_DIR"), SNIPPETS_DIR, snippet)
+	if len(os.Getenv("RUNGO_GO_BIN")) == 0 {
+		return errNoGoVersion
+	}
+
+	dir := filepath.Join(os.Getenv("RUNGO_DATA_DIR"), SNIPPETS_DIR, snippet)
 	err := os.Mkdir(dir, 0755)
 	if err != nil {
 		return err
@@ -63,9 +138,11 @@ func newSnippet(snippet string, data []byte) error {
 
 	cmd := exec.Command(os.Getenv("RUNGO_GO_BIN"), "mod", "init", snippet)
 	cmd.Dir = dir
-	err = cmd.Run()
+	hideWindow(cmd)
+	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return err
+		os.RemoveAll(dir)
+		return &commandError{args: []string{"go", "mod", "init", snippet}, output: string(output), err: err}
 	}
 
 	err = os.WriteFile(filepath.Join(dir, "main.go"), data, 0644)
@@ -75,4 +152,3 @@ func newSnippet(snippet string, data []byte) error {
 
 	return nil
 }
-
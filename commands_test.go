@@ -0,0 +1,116 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestRunCode(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not installed")
+	}
+
+	tests := []struct {
+		name		string
+		code		string
+		config		runConfig
+		stopAfter	string
+		want		int
+		wantOutput	string
+	}{
+		{
+			name: "success",
+			code: "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(\"hi\") }\n",
+			want: 0,
+			wantOutput: "hi\n",
+		},
+		{
+			name: "exit code of the program",
+			code: "package main\n\nimport \"os\"\n\nfunc main() { os.Exit(3) }\n",
+			want: 3,
+		},
+		{
+			name: "arguments and environment",
+			code: "package main\n\nimport (\"fmt\"; \"os\")\n\nfunc main() { fmt.Println(os.Args[1:], os.Getenv(\"FOO\")) }\n",
+			config: runConfig{Args: []string{"a b", "c"}, Env: []string{"FOO=bar"}},
+			want: 0,
+			wantOutput: "[a b c] bar\n",
+		},
+		{
+			name: "build failure",
+			code: "package main\n\nfunc main() { undefined() }\n",
+			want: RUN_BUILD_FAILED,
+			wantOutput: "undefined: undefined",
+		},
+		{
+			name: "stopped",
+			code: "package main\n\nimport (\"fmt\"; \"time\")\n\nfunc main() { fmt.Println(\"started\"); time.Sleep(time.Hour) }\n",
+			stopAfter: "started\n",
+			want: -1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cacheDir := t.TempDir()
+			t.Setenv("RUNGO_GO_BIN", goBin)
+			t.Setenv("RUNGO_CACHE_DIR", cacheDir)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			output := &stopWriter{stopAfter: test.stopAfter, stop: cancel}
+			commands := make([]string, 0)
+			onCommand := func(args []string) {
+				commands = append(commands, test.config.commandLine(args))
+			}
+			got, err := runCode(ctx, "", []byte(test.code), test.config, onCommand, output, output)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != test.want {
+				t.Errorf("got exit code %d, want %d: %s", got, test.want, output.String())
+			}
+			if !strings.Contains(output.String(), test.wantOutput) {
+				t.Errorf("got output %q, want %q in it", output.String(), test.wantOutput)
+			}
+			if len(commands) == 0 || !strings.Contains(commands[0], "go build -o ") {
+				t.Errorf("got commands %q, want the build first", commands)
+			}
+			if entries, _ := os.ReadDir(cacheDir); len(entries) > 0 {
+				t.Errorf("%d temporary files were left behind", len(entries))
+			}
+		})
+	}
+}
+
+// Stops the program once it prints what it prints when it's started, how
+// long that takes depends on how long it takes to build
+type stopWriter struct {
+	output		bytes.Buffer
+	stopAfter	string
+	stop		context.CancelFunc
+}
+
+func (w *stopWriter) Write(p []byte) (int, error) {
+	n, err := w.output.Write(p)
+	if len(w.stopAfter) > 0 && strings.Contains(w.String(), w.stopAfter) {
+		w.stop()
+	}
+
+	return n, err
+}
+
+func (w *stopWriter) String() string {
+	return w.output.String()
+}
@@ -0,0 +1,32 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+
+//go:build !windows
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// Programs and the go command may start processes of their own, the whole
+// process group is killed so stopping a run doesn't leave them behind
+func stopTreeOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// Signal 0 only checks that the process exists, it exists but belongs to
+// someone else when it's not permitted
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Only Windows opens a console window for child processes
+func hideWindow(*exec.Cmd) {}
@@ -7,78 +7,30 @@
 package main
 
 import (
-	"fmt"
-	"os"
 	"os/exec"
-	"path/filepath"
-	"time"
 	"syscall"
 )
 
-// Either run code from an existing snippet, or create a temporary .go file
-// that gets executed and deleted
-func runCode(snippet string, data []byte) (string, error) {
-	if len(snippet) > 0 {
-		dir := filepath.Join(os.Getenv("RUNGO_APP_DIR"), SNIPPETS_DIR, snippet)
-		err := os.WriteFile(filepath.Join(dir, "main.go"), data, 0644)
-		if err != nil {
-			return "", err
-		}
-
-		cmd := exec.Command(os.Getenv("RUNGO_GO_BIN"), "mod", "tidy")
-		cmd.Dir = dir
-		cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
-		err = cmd.Run()
-		if err != nil {
-			return "", err
-		}
-
-		cmd = exec.Command(os.Getenv("RUNGO_GO_BIN"), "run", "main.go")
-		cmd.Dir = dir
-		cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
-		output, _ := cmd.CombinedOutput()
-
-		return string(output), nil
-	}
-
-	file := filepath.Join(os.Getenv("RUNGO_APP_DIR"), fmt.Sprintf("%d.go", time.Now().Unix()))
-	err := os.WriteFile(file, data, 0644)
-	if err != nil {
-		return "", err
-	}
-
-	cmd := exec.Command(os.Getenv("RUNGO_GO_BIN"), "run", file)
-	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
-	output, _ := cmd.CombinedOutput()
+// Programs get no console window of their own, their output goes to the
+// tab's console. Only the process itself is killed when a run is stopped
+func stopTreeOnCancel(cmd *exec.Cmd) {
+	hideWindow(cmd)
+}
 
-	err = os.Remove(file)
+// Processes that exited keep STILL_ACTIVE (259) out of their exit code
+func processAlive(pid int) bool {
+	handle, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
 	if err != nil {
-		return "", err
+		return false
 	}
+	defer syscall.CloseHandle(handle)
 
-	return string(output), nil
+	var code uint32
+	err = syscall.GetExitCodeProcess(handle, &code)
+	return err == nil && code == 259
 }
 
-func newSnippet(snippet string, data []byte) error {
-	dir := filepath.Join(os.Getenv("RUNGO_APP_DIR"), SNIPPETS_DIR, snippet)
-	err := os.Mkdir(dir, 0755)
-	if err != nil {
-		return err
-	}
-
-	cmd := exec.Command(os.Getenv("RUNGO_GO_BIN"), "mod", "init", snippet)
-	cmd.Dir = dir
+// Background processes such as language servers don't get a console window
+func hideWindow(cmd *exec.Cmd) {
 	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
-	err = cmd.Run()
-	if err != nil {
-		return err
-	}
-
-	err = os.WriteFile(filepath.Join(dir, "main.go"), data, 0644)
-	if err != nil {
-		return err
-	}
-
-	return nil
 }
-
@@ -5,19 +5,722 @@
 package main
 
 import (
+	"fmt"
+	"image/color"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
 	"fyne.io/fyne/v2"
-	"fyne.io/fyne/v2/data/binding"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 )
 
+// Shows what the code prints as a terminal would, while it prints it. Only
+// the lines in view are drawn, and the oldest ones are dropped past the
+// limits in the settings so programs that never stop printing can't
+// exhaust memory. Long lines scroll instead of wrapping so progress bars
+// and tables keep their shape
 type console struct {
-	widget.Label
+	mu				sync.Mutex
+	term			*terminal
+	// The widest line since the last full rescan, lines that were dropped
+	// or got shorter since may have been wider than the ones left
+	widest			int
+	// Whether every line is looked at again on the next refresh, rather
+	// than the ones changed since the last one
+	rescan			bool
+	// The first line changed since the log view last looked, as it only
+	// looks while it's shown
+	logsFrom		int
+	text			*consoleText
+	refreshTimer	*time.Timer
+	// Whether new output scrolls into view, scrolling up pauses it
+	follow			bool
+	dropped			int
+	// Lines passing the filter, counted from the first line ever printed,
+	// and the matches of the search among them
+	filter			*regexp.Regexp
+	exclude			bool
+	shown			[]int
+	search			*regexp.Regexp
+	matches			[]searchMatch
+	// Images and documents printed by the program, by row, and the first
+	// row of the console each line shown takes when there are any
+	embeds			map[int]*consoleEmbed
+	tops			[]int
+	// Shortcuts the console doesn't handle, such as the app's commands
+	onShortcut		func(fyne.Shortcut)
+	onRefresh		func()
+	onSaveEmbed		func(e *consoleEmbed)
+	*container.Scroll
 }
 
-func playgroundConsole(output binding.String) *console {
-	console := &console{}
-	console.Label.Wrapping = fyne.TextWrapBreak
-	console.Bind(output)
-	console.ExtendBaseWidget(console)
+func playgroundConsole() *console {
+	s := getSettings()
+	console := &console{term: newTerminal(s.ConsoleLines, s.ConsoleSize<<20), follow: true, embeds: make(map[int]*consoleEmbed)}
+	console.text = newConsoleText(console)
+	console.Scroll = container.NewScroll(console.text)
+	console.Scroll.OnScrolled = console.scrolled
 	return console
 }
+
+// Output is written as programs print it, the console is redrawn a few
+// times per second at most
+func (c *console) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.term.write(string(p))
+	if c.refreshTimer == nil {
+		c.refreshTimer = time.AfterFunc(CONSOLE_REFRESH_DELAY, func() { runOnUI(c.flush) })
+	}
+
+	return len(p), nil
+}
+
+// Refreshes now, a refresh still waiting for its timer would only redo it
+func (c *console) flush() {
+	c.mu.Lock()
+	if c.refreshTimer != nil {
+		c.refreshTimer.Stop()
+	}
+	c.refreshTimer = nil
+	c.mu.Unlock()
+
+	c.refresh()
+}
+
+// Only the lines changed since the last refresh are looked at, unless the
+// filter or the search changed. Lines dropped while new output is paused
+// would move the ones in view, the view is moved up along with them
+func (c *console) refresh() {
+	charWidth, _ := consoleMetrics()
+	c.mu.Lock()
+	from := c.term.takeChanged()
+	if c.rescan {
+		from, c.widest, c.rescan = 0, 0, false
+	}
+	c.logsFrom = min(c.logsFrom, from)
+	c.findEmbeds(from)
+	for i := max(from-c.term.dropped, 0); i < c.term.count; i++ {
+		width := len(c.term.line(i))
+		if e := c.embeds[c.term.dropped+i]; e != nil && e.object != nil {
+			width = int(math.Ceil(float64(e.size.Width / charWidth)))
+		}
+		c.widest = max(c.widest, width)
+	}
+	gone := c.filterLines(from)
+	c.layoutRows(from, gone)
+	c.findMatches(from)
+	dropped := c.term.dropped - c.dropped
+	c.dropped = c.term.dropped
+	c.mu.Unlock()
+
+	_, lineHeight := consoleMetrics()
+	if !c.follow && dropped > 0 {
+		c.Scroll.Offset.Y = max(0, c.Scroll.Offset.Y-float32(dropped)*lineHeight)
+	}
+
+	c.text.Refresh()
+	c.Scroll.Refresh()
+	if c.follow {
+		c.Scroll.ScrollToBottom()
+	}
+	if c.onRefresh != nil {
+		c.onRefresh()
+	}
+}
+
+func (c *console) scrolled(offset fyne.Position) {
+	_, lineHeight := consoleMetrics()
+	c.follow = offset.Y >= c.text.MinSize().Height-c.Scroll.Size().Height-lineHeight/2
+	c.text.Refresh()
+}
+
+// Empties the console, the limits changed in the settings since the last
+// time apply from here
+func (c *console) clear() {
+	s := getSettings()
+	c.mu.Lock()
+	c.term.setLimits(s.ConsoleLines, s.ConsoleSize<<20)
+	c.term.reset()
+	c.dropped = 0
+	c.embeds = make(map[int]*consoleEmbed)
+	c.rescan = true
+	c.mu.Unlock()
+
+	c.follow = true
+	c.text.anchor, c.text.cursor = textPos{}, textPos{}
+	c.refresh()
+}
+
+// Replaces the output, e.g. with the one of a restored session
+func (c *console) setText(text string) {
+	c.clear()
+	c.Write([]byte(text))
+	c.flush()
+}
+
+// The output without escape sequences, lines that were dropped aside
+func (c *console) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.term.String()
+}
+
+// The lines passing the filter, which are all of them when there is none
+func (c *console) shownText() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.filter == nil {
+		return c.term.String()
+	}
+
+	lines := make([]string, 0, len(c.shown))
+	for _, row := range c.shown {
+		line, ok := c.rowText(row)
+		if ok {
+			lines = append(lines, lineText(line))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// How many lines are shown, the callers of this and the functions below
+// hold the console's lock
+func (c *console) rowCount() int {
+	if c.filter == nil {
+		return c.term.count
+	}
+
+	return len(c.shown)
+}
+
+// The row of the line shown at the given index
+func (c *console) rowAt(i int) int {
+	if c.filter == nil {
+		return c.term.dropped + i
+	}
+
+	return c.shown[i]
+}
+
+// Where the line of the given row is shown, or the next one shown if it's
+// filtered out
+func (c *console) indexOf(row int) int {
+	if c.filter == nil {
+		return row - c.term.dropped
+	}
+
+	return sort.SearchInts(c.shown, row)
+}
+
+func (c *console) isShown(row int) bool {
+	i := c.indexOf(row)
+	return i >= 0 && i < c.rowCount() && c.rowAt(i) == row
+}
+
+// Looks for lines printed to be rendered from the given row on, the ones
+// already found are only decoded again when they change length, e.g. while
+// they are printed
+func (c *console) findEmbeds(from int) {
+	optIn := getSettings().ConsoleEmbeds
+	for row := range c.embeds {
+		if row < c.term.dropped {
+			delete(c.embeds, row)
+		}
+	}
+
+	for i := max(from-c.term.dropped, 0); i < c.term.count; i++ {
+		row, line := c.term.dropped+i, c.term.line(i)
+		if e, ok := c.embeds[row]; ok && e.length == len(line) {
+			continue
+		}
+
+		delete(c.embeds, row)
+		if e, ok := parseEmbed(line, optIn); ok {
+			c.embeds[row] = e
+		}
+	}
+}
+
+// Lines take a row each apart from embeds, which take as many as they are
+// tall. Without embeds every row is a line and nothing is kept. The lines
+// shown before the given row keep their rows, moved up by the ones of the
+// lines that are gone from the start
+func (c *console) layoutRows(from, gone int) {
+	tall := false
+	for _, e := range c.embeds {
+		tall = tall || e.object != nil && e.rows() > 1
+	}
+	if !tall {
+		c.tops = nil
+		return
+	}
+
+	start := 0
+	if c.tops != nil {
+		start = max(0, min(c.indexOf(max(from, c.term.dropped)), len(c.tops)-1-gone))
+	}
+	top := 0
+	if start > 0 {
+		top = c.tops[gone+start] - c.tops[gone]
+		for i := 0; i < start; i++ {
+			c.tops[i] = c.tops[gone+i] - c.tops[gone]
+		}
+	}
+
+	c.tops = c.tops[:start]
+	for i := start; i < c.rowCount(); i++ {
+		c.tops = append(c.tops, top)
+		top += c.rowsOf(c.rowAt(i))
+	}
+	c.tops = append(c.tops, top)
+}
+
+func (c *console) rowsOf(row int) int {
+	if e := c.embeds[row]; e != nil && e.object != nil {
+		return e.rows()
+	}
+
+	return 1
+}
+
+// The rows of the console the lines shown take. Lines written since the
+// last refresh take a row each until the next one
+func (c *console) displayRows() int {
+	if c.tops == nil {
+		return c.rowCount()
+	}
+
+	laid := len(c.tops) - 1
+	return c.tops[laid] + max(0, c.rowCount()-laid)
+}
+
+// The first row of the console the line shown at the given index takes
+func (c *console) displayRow(i int) int {
+	if c.tops == nil {
+		return i
+	}
+
+	laid := len(c.tops) - 1
+	if i >= laid {
+		return c.tops[laid] + i - laid
+	}
+	return c.tops[i]
+}
+
+// The index of the line shown at the given row of the console
+func (c *console) lineAt(row int) int {
+	if c.tops == nil {
+		return row
+	}
+
+	laid := len(c.tops) - 1
+	if row >= c.tops[laid] {
+		return laid + row - c.tops[laid]
+	}
+	return sort.Search(laid, func(i int) bool {
+		return c.tops[i+1] > row
+	})
+}
+
+// Rows of the console are counted from the first line ever printed, so the
+// selection stays on the same text when the oldest lines are dropped
+func (c *console) rowText(row int) ([]cell, bool) {
+	i := row - c.term.dropped
+	if i < 0 || i >= c.term.count {
+		return nil, false
+	}
+
+	return c.term.line(i), true
+}
+
+// Programs are told whether the console shows colors, most of them check
+// TERM or NO_COLOR as their output is not a terminal
+func consoleEnv() []string {
+	if getSettings().ConsoleColors {
+		return []string{"TERM=xterm-256color", "CLICOLOR_FORCE=1", "FORCE_COLOR=1"}
+	}
+
+	return []string{"TERM=dumb", "NO_COLOR=1"}
+}
+
+func consoleMetrics() (charWidth, lineHeight float32) {
+	size := fyne.MeasureText("M", theme.TextSize(), fyne.TextStyle{Monospace: true})
+	return size.Width, size.Height
+}
+
+// The lines of the console as tall and wide as they would be if all were
+// drawn, inside the console's scroll. Text can be selected with the mouse
+// and copied
+type consoleText struct {
+	widget.BaseWidget
+	console	*console
+	anchor	textPos
+	cursor	textPos
+	focused	bool
+}
+
+func newConsoleText(c *console) *consoleText {
+	text := &consoleText{console: c}
+	text.ExtendBaseWidget(text)
+	return text
+}
+
+func (c *consoleText) CreateRenderer() fyne.WidgetRenderer {
+	r := &consoleRenderer{text: c}
+	r.update()
+	return r
+}
+
+// The truncation notice takes the first row once lines are dropped
+func (c *consoleText) noticeRows() int {
+	if c.console.term.dropped > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+func (c *consoleText) posAt(pos fyne.Position) textPos {
+	charWidth, lineHeight := consoleMetrics()
+	c.console.mu.Lock()
+	defer c.console.mu.Unlock()
+
+	n := c.console.rowCount()
+	if n == 0 {
+		return textPos{row: c.console.term.dropped}
+	}
+
+	displayed := int(math.Floor(float64((pos.Y-theme.Padding())/lineHeight))) - c.noticeRows()
+	row := c.console.rowAt(min(c.console.lineAt(max(displayed, 0)), n-1))
+	line, _ := c.console.rowText(row)
+	col := int(math.Round(float64((pos.X - theme.Padding()) / charWidth)))
+	return textPos{row: row, col: min(max(col, 0), len(line))}
+}
+
+func (c *consoleText) selectedText() string {
+	c.console.mu.Lock()
+	defer c.console.mu.Unlock()
+
+	start, end := orderPos(c.anchor, c.cursor)
+	lines := make([]string, 0)
+	for row := start.row; row <= end.row; row++ {
+		line, ok := c.console.rowText(row)
+		if !ok || !c.console.isShown(row) {
+			continue
+		}
+
+		from, to := 0, len(line)
+		if row == start.row {
+			from = min(start.col, len(line))
+		}
+		if row == end.row {
+			to = min(end.col, len(line))
+		}
+		lines = append(lines, lineText(line[from:max(from, to)]))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (c *consoleText) MouseDown(ev *desktop.MouseEvent) {
+	fyne.CurrentApp().Driver().CanvasForObject(c).Focus(c)
+	c.cursor = c.posAt(ev.Position)
+	if ev.Modifier&fyne.KeyModifierShift == 0 {
+		c.anchor = c.cursor
+	}
+	c.Refresh()
+}
+
+func (c *consoleText) MouseUp(*desktop.MouseEvent) {}
+
+func (c *consoleText) Dragged(ev *fyne.DragEvent) {
+	c.cursor = c.posAt(ev.Position)
+	c.Refresh()
+}
+
+func (c *consoleText) DragEnd() {}
+
+func (c *consoleText) FocusGained() {
+	c.focused = true
+	c.Refresh()
+}
+
+func (c *consoleText) FocusLost() {
+	c.focused = false
+	c.Refresh()
+}
+
+// The embed drawn at the given position, if any
+func (c *consoleText) embedAt(pos fyne.Position) *consoleEmbed {
+	_, lineHeight := consoleMetrics()
+	c.console.mu.Lock()
+	defer c.console.mu.Unlock()
+
+	displayed := int(math.Floor(float64((pos.Y-theme.Padding())/lineHeight))) - c.noticeRows()
+	i := c.console.lineAt(max(displayed, 0))
+	if displayed < 0 || i >= c.console.rowCount() {
+		return nil
+	}
+
+	e := c.console.embeds[c.console.rowAt(i)]
+	if e == nil || e.object == nil || pos.X > theme.Padding()+e.size.Width {
+		return nil
+	}
+	return e
+}
+
+// Images can be saved from the menu shown when right clicking them
+func (c *consoleText) TappedSecondary(ev *fyne.PointEvent) {
+	e := c.embedAt(ev.Position)
+	if e == nil || !e.saveable() || c.console.onSaveEmbed == nil {
+		return
+	}
+
+	menu := fyne.NewMenu("", fyne.NewMenuItem("Save image as…", func() {
+		c.console.onSaveEmbed(e)
+	}))
+	widget.ShowPopUpMenuAtPosition(menu, fyne.CurrentApp().Driver().CanvasForObject(c), ev.AbsolutePosition)
+}
+
+func (c *consoleText) TypedRune(rune) {}
+
+func (c *consoleText) TypedKey(*fyne.KeyEvent) {}
+
+func (c *consoleText) TypedShortcut(shortcut fyne.Shortcut) {
+	switch s := shortcut.(type) {
+	case *fyne.ShortcutCopy:
+		if c.anchor != c.cursor {
+			s.Clipboard.SetContent(c.selectedText())
+		}
+	case *fyne.ShortcutSelectAll:
+		c.console.mu.Lock()
+		if n := c.console.rowCount(); n > 0 {
+			last := c.console.rowAt(n - 1)
+			line, _ := c.console.rowText(last)
+			c.anchor = textPos{row: c.console.rowAt(0)}
+			c.cursor = textPos{row: last, col: len(line)}
+		}
+		c.console.mu.Unlock()
+		c.Refresh()
+	default:
+		if c.console.onShortcut != nil {
+			c.console.onShortcut(shortcut)
+		}
+	}
+}
+
+// Runs of characters sharing a style are drawn as one text, on top of
+// their background. Only the rows and columns in the scroll's view are
+type consoleRenderer struct {
+	text		*consoleText
+	texts		[]*canvas.Text
+	rects		[]*canvas.Rectangle
+	objects		[]fyne.CanvasObject
+	embeds		[]fyne.CanvasObject
+	usedTexts	int
+	usedRects	int
+}
+
+func (r *consoleRenderer) Destroy() {}
+
+func (r *consoleRenderer) Layout(fyne.Size) {
+	r.update()
+}
+
+func (r *consoleRenderer) MinSize() fyne.Size {
+	charWidth, lineHeight := consoleMetrics()
+	c := r.text.console
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rows := c.displayRows() + r.text.noticeRows()
+	return fyne.NewSize(float32(c.widest)*charWidth, float32(rows)*lineHeight).Add(fyne.NewSize(theme.Padding()*2, theme.Padding()*2))
+}
+
+func (r *consoleRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *consoleRenderer) Refresh() {
+	r.update()
+	canvas.Refresh(r.text)
+}
+
+func (r *consoleRenderer) textAt(content string, col color.Color, style fyne.TextStyle, pos fyne.Position) {
+	if r.usedTexts == len(r.texts) {
+		r.texts = append(r.texts, canvas.NewText("", col))
+	}
+
+	t := r.texts[r.usedTexts]
+	r.usedTexts++
+
+	style.Monospace = true
+	if t.Text != content || t.Color != col || t.TextStyle != style || t.TextSize != theme.TextSize() || t.Hidden {
+		t.Text = content
+		t.Color = col
+		t.TextStyle = style
+		t.TextSize = theme.TextSize()
+		t.Show()
+		t.Refresh()
+	}
+	t.Move(pos)
+	t.Resize(t.MinSize())
+}
+
+func (r *consoleRenderer) rectAt(col color.Color, pos fyne.Position, size fyne.Size) {
+	if r.usedRects == len(r.rects) {
+		r.rects = append(r.rects, canvas.NewRectangle(col))
+	}
+
+	rect := r.rects[r.usedRects]
+	r.usedRects++
+
+	if rect.FillColor != col || rect.Hidden {
+		rect.FillColor = col
+		rect.Show()
+		rect.Refresh()
+	}
+	rect.Move(pos)
+	rect.Resize(size)
+}
+
+func (r *consoleRenderer) update() {
+	charWidth, lineHeight := consoleMetrics()
+	colors := getSettings().ConsoleColors
+	c := r.text.console
+	r.usedTexts, r.usedRects = 0, 0
+
+	c.mu.Lock()
+	term := c.term
+	offset, size := c.Scroll.Offset, c.Scroll.Size()
+	first := max(int((offset.Y-theme.Padding())/lineHeight), 0)
+	last := int((offset.Y+size.Height)/lineHeight) + 1
+	left := max(int((offset.X-theme.Padding())/charWidth), 0)
+	cols := int(size.Width/charWidth) + 2
+	notice := r.text.noticeRows()
+	start, end := orderPos(r.text.anchor, r.text.cursor)
+
+	r.embeds = r.embeds[:0]
+	if first < notice {
+		r.textAt(fmt.Sprintf("%s %d earlier lines were dropped", FOLDED_MARK, term.dropped), theme.DisabledColor(), fyne.TextStyle{Italic: true}, fyne.NewPos(theme.Padding()+float32(left)*charWidth, theme.Padding()))
+	}
+
+	for i := c.lineAt(max(first-notice, 0)); i < c.rowCount() && c.displayRow(i)+notice <= last; i++ {
+		y := theme.Padding() + float32(c.displayRow(i)+notice)*lineHeight
+		abs := c.rowAt(i)
+		line, ok := c.rowText(abs)
+		if !ok {
+			continue
+		}
+
+		// Embeds are drawn in place of their line, selected as a whole
+		if e := c.embeds[abs]; e != nil && e.object != nil {
+			pos := fyne.NewPos(theme.Padding(), y)
+			if start != end && abs >= start.row && abs <= end.row {
+				r.rectAt(theme.SelectionColor(), pos, e.size)
+			}
+			e.object.Move(pos)
+			e.object.Resize(e.size)
+			r.embeds = append(r.embeds, e.object)
+			continue
+		}
+
+		// Matches of the search are found in row order
+		for j := sort.Search(len(c.matches), func(j int) bool { return c.matches[j].start.row >= abs }); j < len(c.matches) && c.matches[j].start.row == abs; j++ {
+			from, to := max(c.matches[j].start.col, left), min(c.matches[j].end.col, left+cols)
+			if to > from {
+				r.rectAt(theme.FocusColor(), fyne.NewPos(theme.Padding()+float32(from)*charWidth, y), fyne.NewSize(float32(to-from)*charWidth, lineHeight))
+			}
+		}
+
+		// The selection covers the line break of the lines it goes past
+		if start != end && abs >= start.row && abs <= end.row {
+			from, to := 0, len(line)+1
+			if abs == start.row {
+				from = start.col
+			}
+			if abs == end.row {
+				to = end.col
+			}
+			from, to = max(from, left), min(to, left+cols)
+			if to > from {
+				r.rectAt(theme.SelectionColor(), fyne.NewPos(theme.Padding()+float32(from)*charWidth, y), fyne.NewSize(float32(to-from)*charWidth, lineHeight))
+			}
+		}
+
+		for from := left; from < min(len(line), left+cols); {
+			style := line[from].style
+			to := from + 1
+			for to < min(len(line), left+cols) && line[to].style == style {
+				to++
+			}
+
+			r.span(lineText(line[from:to]), style, colors, fyne.NewPos(theme.Padding()+float32(from)*charWidth, y), float32(to-from)*charWidth)
+			from = to
+		}
+	}
+	c.mu.Unlock()
+
+	for _, t := range r.texts[r.usedTexts:] {
+		t.Hide()
+	}
+	for _, rect := range r.rects[r.usedRects:] {
+		rect.Hide()
+	}
+
+	r.objects = r.objects[:0]
+	for _, rect := range r.rects {
+		r.objects = append(r.objects, rect)
+	}
+	for _, t := range r.texts {
+		r.objects = append(r.objects, t)
+	}
+	r.objects = append(r.objects, r.embeds...)
+}
+
+// Draws text in the given style, or in the theme's colors when the console
+// is set to strip them
+func (r *consoleRenderer) span(text string, style cellStyle, colors bool, pos fyne.Position, width float32) {
+	_, lineHeight := consoleMetrics()
+	if !colors {
+		style = cellStyle{}
+	}
+
+	fg, bg := style.fg, style.bg
+	if style.inverse {
+		fg, bg = bg, fg
+		if bg == nil {
+			bg = theme.ForegroundColor()
+		}
+		if fg == nil {
+			fg = theme.BackgroundColor()
+		}
+	}
+	if fg == nil {
+		fg = theme.ForegroundColor()
+	}
+
+	if bg != nil {
+		r.rectAt(bg, pos, fyne.NewSize(width, lineHeight))
+	}
+	if style.underline {
+		thickness := theme.InputBorderSize()
+		r.rectAt(fg, fyne.NewPos(pos.X, pos.Y+lineHeight-thickness), fyne.NewSize(width, thickness))
+	}
+	if len(strings.TrimSpace(text)) > 0 {
+		r.textAt(text, fg, fyne.TextStyle{Bold: style.bold, Italic: style.italic}, pos)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"fyne.io/fyne/v2/test"
+)
+
+// Refreshing after every write only looks at the lines that changed, what
+// is shown ends up as if every line was looked at once at the end
+func TestConsoleRefresh(t *testing.T) {
+	test.NewApp()
+	queueUI(t)
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewGray(image.Rect(0, 0, 2, 100)))
+	embed := "IMAGE:" + base64.StdEncoding.EncodeToString(img.Bytes()) + "\n"
+
+	tests := []struct {
+		name		string
+		maxLines	int
+		filter		string
+		exclude		bool
+		search		string
+		writes		[]string
+	}{
+		{name: "appended lines", filter: "err", search: "o", writes: []string{"ok\n", "error 1\n", "err", "or 2\nok\n"}},
+		{name: "progress line", search: "100", writes: []string{"10%", "\r50%", "\r100%\n", "done\n"}},
+		{name: "earlier line rewritten", filter: "x", exclude: true, search: "e", writes: []string{"one\ntwo\n", "\x1b[2A\x1b[2K\rerror\n\n", "three\n"}},
+		{name: "lines dropped", maxLines: 3, filter: "[02468]", search: "1", writes: []string{"0\n1\n", "2\n3\n4\n", "10\n11\n12\n"}},
+		{name: "screen cleared", search: "a", writes: []string{"a\nb\n", "\x1b[2Jc\na\n"}},
+		{name: "tall embeds", search: "x", writes: []string{"x\n", embed, "x\n", embed, "xx\n"}},
+		{name: "tall embeds dropped", maxLines: 4, writes: []string{"x\n", embed, "x\n", embed, "x\n", "x\n"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newConsole := func() *console {
+				c := playgroundConsole()
+				if test.maxLines > 0 {
+					c.term.setLimits(test.maxLines, 1<<20)
+					c.term.reset()
+				}
+				if len(test.filter) > 0 {
+					c.setFilter(regexp.MustCompile(test.filter), test.exclude)
+				}
+				if len(test.search) > 0 {
+					c.setSearch(regexp.MustCompile(test.search))
+				}
+				return c
+			}
+
+			c := newConsole()
+			for i, w := range test.writes {
+				c.Write([]byte(w))
+				c.flush()
+
+				want := newConsole()
+				want.Write([]byte(strings.Join(test.writes[:i+1], "")))
+				want.flush()
+				if !reflect.DeepEqual(append([]int{}, c.shown...), append([]int{}, want.shown...)) {
+					t.Errorf("after write %d got shown %v, want %v", i, c.shown, want.shown)
+				}
+				if !reflect.DeepEqual(append([]searchMatch{}, c.matches...), append([]searchMatch{}, want.matches...)) {
+					t.Errorf("after write %d got matches %v, want %v", i, c.matches, want.matches)
+				}
+				if !reflect.DeepEqual(c.tops, want.tops) {
+					t.Errorf("after write %d got tops %v, want %v", i, c.tops, want.tops)
+				}
+			}
+		})
+	}
+}
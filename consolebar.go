@@ -0,0 +1,478 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Only the lines the filter matches are shown, or the ones it doesn't when
+// excluding. Lines from the given row on are filtered again, returns how
+// many of the lines shown before are gone from the start. The callers hold
+// the console's lock
+func (c *console) filterLines(from int) int {
+	if c.filter == nil {
+		c.shown = c.shown[:0]
+		return c.term.dropped - c.dropped
+	}
+
+	gone := sort.SearchInts(c.shown, c.term.dropped)
+	kept := sort.SearchInts(c.shown, from)
+	c.shown = append(c.shown[:0], c.shown[gone:max(gone, kept)]...)
+	for i := max(from-c.term.dropped, 0); i < c.term.count; i++ {
+		if c.filter.MatchString(lineText(c.term.line(i))) != c.exclude {
+			c.shown = append(c.shown, c.term.dropped+i)
+		}
+	}
+
+	return gone
+}
+
+// Matches are looked up in the lines shown, up to SEARCH_MATCHES_LIMIT of
+// them. The callers hold the console's lock
+func (c *console) findMatches(from int) {
+	if c.search == nil {
+		c.matches = c.matches[:0]
+		return
+	}
+
+	// Lines past the limit were never looked at, they can have matches now
+	// that older ones are gone
+	if len(c.matches) >= SEARCH_MATCHES_LIMIT {
+		from = min(from, c.matches[len(c.matches)-1].start.row)
+	}
+	gone := sort.Search(len(c.matches), func(i int) bool {
+		return c.matches[i].start.row >= c.term.dropped
+	})
+	kept := sort.Search(len(c.matches), func(i int) bool {
+		return c.matches[i].start.row >= from
+	})
+	c.matches = append(c.matches[:0], c.matches[gone:max(gone, kept)]...)
+
+	for i := c.indexOf(max(from, c.term.dropped)); i < c.rowCount() && len(c.matches) < SEARCH_MATCHES_LIMIT; i++ {
+		row := c.rowAt(i)
+		line, ok := c.rowText(row)
+		if !ok {
+			continue
+		}
+
+		text := lineText(line)
+		for _, m := range c.search.FindAllStringIndex(text, -1) {
+			if m[1] > m[0] {
+				start := utf8.RuneCountInString(text[:m[0]])
+				end := start + utf8.RuneCountInString(text[m[0]:m[1]])
+				c.matches = append(c.matches, searchMatch{start: textPos{row: row, col: start}, end: textPos{row: row, col: end}})
+			}
+		}
+	}
+}
+
+// Highlights every match of the given search, or none if it's nil
+func (c *console) setSearch(search *regexp.Regexp) {
+	c.mu.Lock()
+	c.search, c.rescan = search, true
+	c.mu.Unlock()
+
+	c.refresh()
+}
+
+// Hides the lines that don't match the filter, or the ones that do when
+// excluding. A nil filter shows every line
+func (c *console) setFilter(filter *regexp.Regexp, exclude bool) {
+	c.mu.Lock()
+	c.filter, c.exclude, c.rescan = filter, exclude, true
+	c.mu.Unlock()
+
+	c.refresh()
+}
+
+// The match that is currently selected, if any
+func (c *console) currentMatch() (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	start, end := orderPos(c.text.anchor, c.text.cursor)
+	for i, m := range c.matches {
+		if m.start == start && m.end == end {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// Selects the next match after the selection, or the previous one before
+// it, wrapping around the ends of the output
+func (c *console) findNext(backward bool) {
+	c.mu.Lock()
+	if len(c.matches) == 0 {
+		c.mu.Unlock()
+		return
+	}
+
+	start, end := orderPos(c.text.anchor, c.text.cursor)
+	next := 0
+	if backward {
+		next = len(c.matches) - 1
+		for i := len(c.matches) - 1; i >= 0; i-- {
+			if !start.before(c.matches[i].end) {
+				next = i
+				break
+			}
+		}
+	} else {
+		for i, m := range c.matches {
+			if !m.start.before(end) {
+				next = i
+				break
+			}
+		}
+	}
+	m := c.matches[next]
+	c.mu.Unlock()
+
+	c.text.anchor, c.text.cursor = m.start, m.end
+	c.reveal(m.start)
+}
+
+// Scrolls the given position into view, which pauses following new output
+// unless it's at the bottom
+func (c *console) reveal(pos textPos) {
+	charWidth, lineHeight := consoleMetrics()
+	c.mu.Lock()
+	i := c.displayRow(c.indexOf(pos.row)) + c.text.noticeRows()
+	c.mu.Unlock()
+
+	x := theme.Padding() + float32(pos.col)*charWidth
+	y := theme.Padding() + float32(i)*lineHeight
+	offset, size := c.Scroll.Offset, c.Scroll.Size()
+	if y < offset.Y || y+lineHeight > offset.Y+size.Height {
+		c.Scroll.Offset.Y = max(0, y-(size.Height-lineHeight)/2)
+	}
+	if x < offset.X || x+charWidth > offset.X+size.Width {
+		c.Scroll.Offset.X = max(0, x-size.Width/2)
+	}
+
+	c.Scroll.Refresh()
+	c.scrolled(c.Scroll.Offset)
+}
+
+// Searches and filters the console's output, and copies, saves or clears it
+type consoleBar struct {
+	console		*console
+	window		fyne.Window
+	query		*findEntry
+	matchCase	*widget.Check
+	regex		*widget.Check
+	count		*widget.Label
+	searchRow	*fyne.Container
+	filter		*findEntry
+	filterRegex	*widget.Check
+	exclude		*widget.Check
+	shown		*widget.Label
+	filterRow	*fyne.Container
+	logs		*logView
+	// Whether the log view was shown or hidden by hand, otherwise it's
+	// shown while the output looks like JSON logs
+	logsChosen	bool
+	*fyne.Container
+}
+
+func newConsoleBar(c *console, window fyne.Window, onShortcut func(shortcut fyne.Shortcut)) *consoleBar {
+	b := &consoleBar{
+		console: c,
+		window: window,
+		query: newFindEntry("Find in output"),
+		filter: newFindEntry("Filter lines"),
+		count: widget.NewLabel(""),
+		shown: widget.NewLabel(""),
+		logs: newLogView(c, onShortcut),
+	}
+
+	b.matchCase = widget.NewCheck("Case", func(bool) {
+		b.updateSearch()
+	})
+	b.regex = widget.NewCheck("Regex", func(bool) {
+		b.updateSearch()
+	})
+	b.query.OnChanged = func(string) {
+		b.updateSearch()
+	}
+	b.query.onKey = func(key *fyne.KeyEvent, shift bool) bool {
+		switch key.Name {
+		case fyne.KeyReturn, fyne.KeyEnter:
+			c.findNext(shift)
+			b.updateCount()
+		case fyne.KeyEscape:
+			b.closeSearch()
+		default:
+			return false
+		}
+
+		return true
+	}
+	b.query.onShortcut = onShortcut
+
+	b.filterRegex = widget.NewCheck("Regex", func(bool) {
+		b.updateFilter()
+	})
+	b.exclude = widget.NewCheck("Exclude", func(bool) {
+		b.updateFilter()
+	})
+	b.filter.OnChanged = func(string) {
+		b.updateFilter()
+	}
+	b.filter.onKey = func(key *fyne.KeyEvent, shift bool) bool {
+		if key.Name == fyne.KeyEscape {
+			b.closeFilter()
+			return true
+		}
+
+		return false
+	}
+	b.filter.onShortcut = onShortcut
+
+	b.searchRow = container.NewBorder(nil, nil, nil,
+		container.NewHBox(
+			b.count,
+			b.matchCase,
+			b.regex,
+			widget.NewButtonWithIcon("", theme.MoveUpIcon(), func() {
+				c.findNext(true)
+				b.updateCount()
+			}),
+			widget.NewButtonWithIcon("", theme.MoveDownIcon(), func() {
+				c.findNext(false)
+				b.updateCount()
+			}),
+			widget.NewButtonWithIcon("", theme.CancelIcon(), b.closeSearch),
+		),
+		b.query,
+	)
+	b.searchRow.Hide()
+
+	b.filterRow = container.NewBorder(nil, nil, nil,
+		container.NewHBox(
+			b.shown,
+			b.filterRegex,
+			b.exclude,
+			widget.NewButtonWithIcon("", theme.CancelIcon(), b.closeFilter),
+		),
+		b.filter,
+	)
+	b.filterRow.Hide()
+
+	b.Container = container.NewVBox(
+		widget.NewToolbar(
+			widget.NewToolbarAction(theme.SearchIcon(), b.showSearch),
+			widget.NewToolbarAction(theme.ListIcon(), b.showFilter),
+			widget.NewToolbarAction(theme.GridIcon(), b.toggleLogs),
+			widget.NewToolbarSpacer(),
+			widget.NewToolbarAction(theme.ContentCopyIcon(), b.copyAll),
+			widget.NewToolbarAction(theme.DocumentSaveIcon(), b.save),
+			widget.NewToolbarAction(theme.DeleteIcon(), c.clear),
+		),
+		b.searchRow,
+		b.filterRow,
+	)
+
+	c.onRefresh = func() {
+		b.updateCount()
+		b.updateShown()
+		b.updateLogs()
+	}
+	c.onSaveEmbed = func(e *consoleEmbed) {
+		b.saveFile("Saving image", "image."+e.format, e.data)
+	}
+
+	return b
+}
+
+// Shows the search, looking for the selected text if it's a single line
+func (b *consoleBar) showSearch() {
+	selected := b.console.text.selectedText()
+	if len(selected) > 0 && utf8.RuneCountInString(selected) < 200 && !strings.Contains(selected, "\n") {
+		if b.regex.Checked {
+			selected = regexp.QuoteMeta(selected)
+		}
+		b.query.SetText(selected)
+	}
+
+	b.searchRow.Show()
+	b.updateSearch()
+	b.window.Canvas().Focus(b.query)
+}
+
+func (b *consoleBar) closeSearch() {
+	b.searchRow.Hide()
+	b.console.setSearch(nil)
+	b.window.Canvas().Focus(b.console.text)
+}
+
+func (b *consoleBar) showFilter() {
+	b.filterRow.Show()
+	b.updateFilter()
+	b.window.Canvas().Focus(b.filter)
+}
+
+func (b *consoleBar) closeFilter() {
+	b.filterRow.Hide()
+	b.console.setFilter(nil, false)
+	b.window.Canvas().Focus(b.console.text)
+}
+
+// Queries are literal unless they are marked as regular expressions
+func consolePattern(query string, regex, matchCase bool) (*regexp.Regexp, error) {
+	if !regex {
+		query = regexp.QuoteMeta(query)
+	}
+	if !matchCase {
+		query = `(?i)` + query
+	}
+
+	return regexp.Compile(query)
+}
+
+func (b *consoleBar) updateSearch() {
+	if !b.searchRow.Visible() || len(b.query.Text) == 0 {
+		b.console.setSearch(nil)
+		return
+	}
+
+	// An invalid regex searches for nothing, which the count tells apart
+	search, _ := consolePattern(b.query.Text, b.regex.Checked, b.matchCase.Checked)
+	b.console.setSearch(search)
+}
+
+// The filter ignores case, as logs rarely agree on it
+func (b *consoleBar) updateFilter() {
+	if !b.filterRow.Visible() || len(b.filter.Text) == 0 {
+		b.console.setFilter(nil, false)
+		return
+	}
+
+	filter, _ := consolePattern(b.filter.Text, b.filterRegex.Checked, false)
+	b.console.setFilter(filter, b.exclude.Checked)
+}
+
+// How many matches there are, and which one is selected
+func (b *consoleBar) updateCount() {
+	c := b.console
+	c.mu.Lock()
+	search, matches := c.search, len(c.matches)
+	c.mu.Unlock()
+
+	switch {
+	case !b.searchRow.Visible() || len(b.query.Text) == 0:
+		b.count.SetText("")
+	case search == nil:
+		b.count.SetText("Invalid regex")
+	case matches == 0:
+		b.count.SetText("No results")
+	default:
+		i, ok := c.currentMatch()
+		if ok {
+			b.count.SetText(fmt.Sprintf("%d of %d", i+1, matches))
+		} else {
+			b.count.SetText(fmt.Sprintf("%d results", matches))
+		}
+	}
+}
+
+// How many lines pass the filter
+func (b *consoleBar) updateShown() {
+	c := b.console
+	c.mu.Lock()
+	filter, shown, count := c.filter, len(c.shown), c.term.count
+	c.mu.Unlock()
+
+	switch {
+	case !b.filterRow.Visible() || len(b.filter.Text) == 0:
+		b.shown.SetText("")
+	case filter == nil:
+		b.shown.SetText("Invalid regex")
+	default:
+		b.shown.SetText(fmt.Sprintf("%d of %d lines", shown, count))
+	}
+}
+
+// Switches between the output as printed and the log view, which then
+// stays as chosen
+func (b *consoleBar) toggleLogs() {
+	b.logsChosen = true
+	b.showLogs(!b.logs.Visible())
+}
+
+func (b *consoleBar) showLogs(show bool) {
+	if show == b.logs.Visible() {
+		return
+	}
+
+	if show {
+		b.console.Hide()
+		b.logs.Show()
+		b.logs.update()
+	} else {
+		b.logs.Hide()
+		b.console.Show()
+	}
+}
+
+// Shows the log view while the output looks like JSON logs, unless it was
+// chosen by hand
+func (b *consoleBar) updateLogs() {
+	if !b.logsChosen {
+		b.console.mu.Lock()
+		logs := b.console.looksLikeLogs()
+		b.console.mu.Unlock()
+		b.showLogs(logs)
+	}
+
+	if b.logs.Visible() {
+		b.logs.update()
+	}
+}
+
+// Copies the lines shown, which are all of them unless they are filtered
+func (b *consoleBar) copyAll() {
+	b.window.Clipboard().SetContent(b.console.shownText())
+}
+
+// Saves the lines shown, as they would be copied
+func (b *consoleBar) save() {
+	b.saveFile("Saving output", CONSOLE_OUTPUT_FILE, []byte(b.console.shownText()))
+}
+
+// Asks where to save the data, suggesting the given file name
+func (b *consoleBar) saveFile(op, name string, data []byte) {
+	saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			showError(b.window, op, err)
+			return
+		}
+		if writer == nil {
+			return
+		}
+
+		_, err = writer.Write(data)
+		err = errors.Join(err, writer.Close())
+		if err != nil {
+			showError(b.window, op, err)
+		}
+	}, b.window)
+	saveDialog.SetFileName(name)
+	saveDialog.Show()
+}
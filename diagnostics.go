@@ -0,0 +1,250 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var errNotStd = errors.New("not part of the standard library")
+
+// Standard library packages of a Go version type-checked from its sources,
+// shared by every tab. Only their declarations are checked, which is all
+// the code importing them needs
+type stdImporter struct {
+	mu			sync.Mutex
+	context		build.Context
+	fset		*token.FileSet
+	packages	map[string]*types.Package
+}
+
+var (
+	stdImportersMu	sync.Mutex
+	stdImporters	= make(map[string]*stdImporter)
+)
+
+func loadStdImporter(goroot string) *stdImporter {
+	stdImportersMu.Lock()
+	defer stdImportersMu.Unlock()
+
+	importer, ok := stdImporters[goroot]
+	if !ok {
+		ctx := build.Default
+		ctx.GOROOT = goroot
+		ctx.GOPATH = ""
+		ctx.CgoEnabled = false
+		importer = &stdImporter{context: ctx, fset: token.NewFileSet(), packages: make(map[string]*types.Package)}
+		stdImporters[goroot] = importer
+	}
+
+	return importer
+}
+
+func (s *stdImporter) Import(path string) (*types.Package, error) {
+	return s.ImportFrom(path, "", 0)
+}
+
+// Packages the standard library vendors are found next to it, e.g. the
+// golang.org/x/net packages imported by net/http
+func (s *stdImporter) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+
+	src := filepath.Join(s.context.GOROOT, "src")
+	importPath := path
+	if first, _, _ := strings.Cut(path, "/"); strings.Contains(first, ".") {
+		if !strings.HasPrefix(dir, src) {
+			return nil, errNotStd
+		}
+		importPath = "vendor/" + path
+	}
+
+	pkg, ok := s.packages[importPath]
+	if ok {
+		return pkg, nil
+	}
+
+	bp, err := s.context.ImportDir(filepath.Join(src, filepath.FromSlash(importPath)), 0)
+	if err != nil {
+		return nil, errNotStd
+	}
+
+	files := make([]*ast.File, 0, len(bp.GoFiles))
+	for _, name := range bp.GoFiles {
+		file, err := parser.ParseFile(s.fset, filepath.Join(bp.Dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	// Errors in the standard library, e.g. code newer than go/types knows
+	// of, don't keep the rest of the package from being used
+	conf := types.Config{Importer: s, IgnoreFuncBodies: true, FakeImportC: true, Error: func(error) {}}
+	pkg, _ = conf.Check(importPath, s.fset, files, nil)
+	s.packages[importPath] = pkg
+	return pkg, nil
+}
+
+// Type errors in the code, as found against the standard library of the Go
+// version at goroot. Imports from outside of it are left to the compiler
+// and gopls, as the sources of modules are not at hand
+func typeCheckMarkers(goroot, code string) []marker {
+	importer := loadStdImporter(goroot)
+	importer.mu.Lock()
+	defer importer.mu.Unlock()
+
+	fset := token.NewFileSet()
+	src := []byte(code)
+	lines := strings.Split(code, "\n")
+	markerAt := func(position token.Position, message string) marker {
+		m := marker{row: max(position.Line-1, 0), kind: markerError, message: message}
+		if m.row < len(lines) {
+			// Columns are counted in bytes from 1
+			line := lines[m.row]
+			m.col, m.endCol = wordCols([]rune(line), utf8.RuneCountInString(line[:min(max(position.Column-1, 0), len(line))]))
+		}
+		return m
+	}
+
+	markers := make([]marker, 0)
+	file, err := parser.ParseFile(fset, "main.go", src, parser.SkipObjectResolution)
+	if err != nil {
+		var list scanner.ErrorList
+		if errors.As(err, &list) {
+			for _, e := range list {
+				markers = append(markers, markerAt(e.Pos, e.Msg))
+			}
+		}
+		return markers
+	}
+
+	external := make(map[token.Pos]bool)
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		if first, _, _ := strings.Cut(path, "/"); strings.Contains(first, ".") {
+			external[spec.Path.Pos()] = true
+		}
+	}
+
+	conf := types.Config{
+		Importer: importer,
+		Error: func(err error) {
+			var typeErr types.Error
+			if errors.As(err, &typeErr) && !external[typeErr.Pos] {
+				markers = append(markers, markerAt(fset.Position(typeErr.Pos), typeErr.Msg))
+			}
+		},
+	}
+	conf.Check("main", fset, []*ast.File{file}, nil)
+
+	return markers
+}
+
+// The code is type-checked once typing pauses, read-only code is not as
+// it belongs to packages that can't be checked on their own
+func (e *editor) typeCheckChanged() {
+	if e.readOnly {
+		return
+	}
+
+	if e.typeCheckTimer != nil {
+		e.typeCheckTimer.Stop()
+	}
+	e.typeCheckTimer = time.AfterFunc(TYPE_CHECK_DELAY, e.typeCheck)
+}
+
+// Runs on the timer's goroutine, the markers are only set on the UI one if
+// the code wasn't changed while it was checked
+func (e *editor) typeCheck() {
+	goroot, err := goRoot()
+	if err != nil {
+		return
+	}
+
+	code := e.Text()
+	markers := typeCheckMarkers(goroot, code)
+	runOnUI(func() {
+		if e.Text() == code {
+			e.setMarkers("types", markers)
+		}
+	})
+}
+
+// Runs go vet in the background, what it reports is underlined until the
+// next time it runs
+func (e *editor) vet() {
+	snippet, err := e.snippet.Get()
+	if err != nil {
+		e.banner.showError("Vetting code", err)
+		return
+	}
+
+	code := e.Text()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), VET_TIMEOUT)
+		defer cancel()
+
+		output, err := vetCode(ctx, snippet, []byte(code))
+		runOnUI(func() {
+			if err != nil {
+				e.banner.showError("Vetting code", err)
+				return
+			}
+
+			if e.Text() == code {
+				e.setMarkers("vet", compileMarkers(output, code, markerWarning))
+			}
+		})
+	}()
+}
+
+// Writes the code where go vet can read it, scratch code is written to a
+// temporary file that is removed once vetted
+func vetCode(ctx context.Context, snippet string, data []byte) (string, error) {
+	if len(os.Getenv("RUNGO_GO_BIN")) == 0 {
+		return "", errNoGoVersion
+	}
+
+	dir := filepath.Join(os.Getenv("RUNGO_DATA_DIR"), SNIPPETS_DIR, snippet)
+	target := "."
+	if len(snippet) > 0 {
+		err := os.WriteFile(filepath.Join(dir, "main.go"), data, 0644)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		dir = os.Getenv("RUNGO_CACHE_DIR")
+		target = fmt.Sprintf("vet-%d.go", time.Now().UnixNano())
+		err := os.WriteFile(filepath.Join(dir, target), data, 0644)
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(filepath.Join(dir, target))
+	}
+
+	cmd := exec.CommandContext(ctx, os.Getenv("RUNGO_GO_BIN"), "vet", target)
+	cmd.Dir = dir
+	hideWindow(cmd)
+	output, _ := cmd.CombinedOutput()
+	return string(output), nil
+}
@@ -0,0 +1,61 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+// The check runs in the background while the code is typed, run with -race
+func TestTypeCheck(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not installed")
+	}
+
+	tests := []struct {
+		name	string
+		code	string
+		typed	string
+		want	[]string
+	}{
+		{name: "valid", code: "package main\n\nfunc main() {\n}\n", want: []string{}},
+		{name: "undefined name", code: "package main\n\nfunc main() {\n\tx++\n}\n", want: []string{"undefined: x"}},
+		{name: "fixed while checking", code: "package main\n\nfunc main() {\n\tx++\n}\n", typed: "\nvar x int\n", want: []string{}},
+		{name: "broken while checking", code: "package main\n\nfunc main() {\n}\n", typed: "\nvar _ = y\n", want: []string{"undefined: y"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("RUNGO_GO_BIN", goBin)
+			queue := queueUI(t)
+			e := playgroundEditor(playgroundConsole(), nil, newErrorBanner())
+			e.SetText(test.code)
+
+			go e.typeCheck()
+			e.cursor = e.buf.end()
+			e.anchor = e.cursor
+			e.insert(test.typed)
+
+			checked := func() bool {
+				e.markersMu.Lock()
+				defer e.markersMu.Unlock()
+				_, ok := e.markers["types"]
+				return ok
+			}
+			waitUI(t, queue, checked)
+
+			got := []string{}
+			for _, m := range e.problems() {
+				got = append(got, m.message)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+)
+
+type appDirs struct {
+	config	string
+	data	string
+	cache	string
+}
+
+// Resolves where RunGo keeps its files, in order of precedence: the -data-dir
+// flag or RUNGO_HOME, portable mode, and lastly the XDG base directories
+func resolveAppDirs(dataDir string, portable bool) (appDirs, error) {
+	if len(dataDir) == 0 {
+		dataDir = os.Getenv("RUNGO_HOME")
+	}
+
+	if len(dataDir) > 0 {
+		root, err := filepath.Abs(dataDir)
+		if err != nil {
+			return appDirs{}, err
+		}
+
+		return appDirs{config: root, data: root, cache: root}, nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return appDirs{}, err
+	}
+
+	exeDir := filepath.Dir(exe)
+	if !portable {
+		portable = len(os.Getenv("RUNGO_PORTABLE")) > 0
+	}
+
+	if !portable {
+		_, err = os.Stat(filepath.Join(exeDir, PORTABLE_FILE))
+		portable = err == nil
+	}
+
+	if portable {
+		root := filepath.Join(exeDir, PORTABLE_DIR)
+		return appDirs{config: root, data: root, cache: root}, nil
+	}
+
+	configDir, err := xdgDir("XDG_CONFIG_HOME", os.UserConfigDir)
+	if err != nil {
+		return appDirs{}, err
+	}
+
+	dataHome, err := xdgDir("XDG_DATA_HOME", userDataDir)
+	if err != nil {
+		return appDirs{}, err
+	}
+
+	cacheDir, err := xdgDir("XDG_CACHE_HOME", os.UserCacheDir)
+	if err != nil {
+		return appDirs{}, err
+	}
+
+	return appDirs{
+		config: filepath.Join(configDir, APP_DIR),
+		data: filepath.Join(dataHome, APP_DIR),
+		cache: filepath.Join(cacheDir, APP_DIR),
+	}, nil
+}
+
+// The XDG specification requires absolute paths, relative ones are ignored
+func xdgDir(env string, fallback func() (string, error)) (string, error) {
+	dir := os.Getenv(env)
+	if len(dir) > 0 && filepath.IsAbs(dir) {
+		return dir, nil
+	}
+
+	return fallback()
+}
+
+// The standard library has no counterpart of os.UserConfigDir for data files,
+// outside of Linux and BSD they are stored along with the configuration
+func userDataDir() (string, error) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		return os.UserConfigDir()
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, ".local", "share"), nil
+}
+
+// Returns the ~/run-go directory used by previous releases, if it exists and
+// the user has not been asked to migrate it yet
+func legacyAppDir(dirs appDirs) (string, bool) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", false
+	}
+
+	legacyDir := filepath.Join(homeDir, APP_DIR)
+	if legacyDir == dirs.data {
+		return "", false
+	}
+
+	info, err := os.Stat(legacyDir)
+	if err != nil || !info.IsDir() {
+		return "", false
+	}
+
+	_, err = os.Stat(filepath.Join(dirs.config, MIGRATED_FILE))
+	if err == nil {
+		return "", false
+	}
+
+	return legacyDir, true
+}
+
+// Moves snippets and Go versions out of the legacy directory, entries that
+// already exist at the destination are left untouched
+func migrateLegacyDir(legacyDir string, dirs appDirs) error {
+	moves := map[string]string{
+		filepath.Join(legacyDir, SNIPPETS_DIR): filepath.Join(dirs.data, SNIPPETS_DIR),
+		filepath.Join(legacyDir, GOS_DIR): filepath.Join(dirs.cache, GOS_DIR),
+	}
+
+	for src, dst := range moves {
+		entries, err := os.ReadDir(src)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			target := filepath.Join(dst, entry.Name())
+			_, err = os.Stat(target)
+			if err == nil {
+				continue
+			}
+
+			err = moveDir(filepath.Join(src, entry.Name()), target)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return markLegacyDirMigrated(dirs)
+}
+
+// Remembers that the migration was either performed or declined, so the user
+// is only asked once
+func markLegacyDirMigrated(dirs appDirs) error {
+	return os.WriteFile(filepath.Join(dirs.config, MIGRATED_FILE), nil, 0644)
+}
+
+// Renames src to dst, falling back to copying when they live on different
+// devices, as it is usual with synced drives. Any other error is returned
+// as is, so the legacy directory is never removed because of it
+func moveDir(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !crossDevice(err) {
+		return err
+	}
+
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			return os.Symlink(link, target)
+		}
+
+		return copyFile(path, target, info.Mode().Perm())
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(src)
+}
+
+// Windows reports renames across volumes as ERROR_NOT_SAME_DEVICE, which
+// syscall doesn't name
+func crossDevice(err error) bool {
+	if runtime.GOOS == "windows" {
+		return errors.Is(err, syscall.Errno(17))
+	}
+
+	return errors.Is(err, syscall.EXDEV)
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	_, err = io.Copy(dstFile, srcFile)
+	return err
+}
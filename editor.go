@@ -5,61 +5,781 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
 	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/data/binding"
 	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
-	"go.uber.org/zap"
 )
 
+// A code editor for Go, only the visible lines are highlighted and drawn
+// so large snippets stay responsive
 type editor struct {
-	output binding.String
-	snippet binding.String
-	widget.Entry
+	widget.BaseWidget
+	console			*console
+	snippet			binding.String
+	banner			*errorBanner
+	buf				*buffer
+	highlighter		*highlighter
+	cursor			textPos
+	anchor			textPos
+	goalCol			int
+	top				int
+	left			int
+	scrolled		fyne.Delta
+	focused			bool
+	shift			bool
+	// Set from background work such as the type checker, see setMarkers
+	markersMu		sync.Mutex
+	markers			map[string][]marker
+	onProblems		func()
+	typeCheckTimer	*time.Timer
+	OnChanged		func()
+	onCursorChanged	func()
+	onFocusLost		func()
+	onSaved			func(code string)
+	onRun			func(r runRecord)
+	onShortcut		func(shortcut fyne.Shortcut)
+	runMu			sync.Mutex
+	stopRun			context.CancelFunc
+	// Counts the runs started, a run that was superseded by a newer one
+	// can't write to the console or report how it ended
+	runs			int
+	// How the code is built and run, set from the tab's run configuration
+	config			runConfig
+	file			string
+	readOnly		bool
+	lsp				editorLSP
+	completion		*completionPopup
+	info			*widget.PopUp
+	hoverInfo		bool
+	hoverTimer		*time.Timer
+	onDefinition	func(path string, pos lspPosition)
+	history			history
+	search			*regexp.Regexp
+	matches			[]searchMatch
+	folds			[]foldRange
+	structureTimer	*time.Timer
+	onOutline		func(items []outlineItem)
+	mode			keyMode
+	keybindings		string
+	onCommand		func(id string)
+	isBound			func(shortcut fyne.Shortcut) bool
+	clipboard		fyne.Clipboard
 }
 
-func playgroundEditor(output, snippet binding.String) *editor {
-	editor := &editor{output: output, snippet: snippet}
-	editor.MultiLine = true
+func playgroundEditor(console *console, snippet binding.String, banner *errorBanner) *editor {
+	editor := &editor{console: console, snippet: snippet, banner: banner, buf: newBuffer("")}
+	editor.highlighter = newHighlighter(editor.buf.lineCount())
+	editor.completion = newCompletionPopup(editor)
 	editor.ExtendBaseWidget(editor)
 	return editor
 }
 
-func (e *editor) TypedShortcut(shortcut fyne.Shortcut) {
-	customShortcut, ok := shortcut.(*desktop.CustomShortcut)
-	if !ok {
-		e.Entry.TypedShortcut(shortcut)
+func (e *editor) CreateRenderer() fyne.WidgetRenderer {
+	r := &editorRenderer{
+		editor: e,
+		background: canvas.NewRectangle(theme.InputBackgroundColor()),
+		cursor: canvas.NewRectangle(theme.PrimaryColor()),
+	}
+	r.update()
+	return r
+}
+
+func (e *editor) Text() string {
+	return e.buf.String()
+}
+
+// Replaces the whole code as a single edit that can be undone, the cursor
+// is kept where it was if possible
+func (e *editor) SetText(text string) {
+	cursor := e.cursor
+	e.replace(textPos{}, e.buf.end(), text)
+	e.top = min(e.top, e.buf.lineCount()-1)
+	e.cursor = e.buf.clamp(cursor)
+	e.anchor = e.cursor
+	e.changed()
+}
+
+func (e *editor) setCursor(pos textPos) {
+	e.cursor = e.buf.clamp(pos)
+	e.anchor = e.cursor
+	e.goalCol = visualCol(e.buf.line(e.cursor.row), e.cursor.col)
+	e.scrollToCursor()
+	e.Refresh()
+	e.cursorChanged()
+}
+
+// The single place code is edited through, returns where the new text ends.
+// Read-only code, such as standard library sources, is left as is
+func (e *editor) replace(start, end textPos, text string) textPos {
+	start, end = orderPos(e.buf.clamp(start), e.buf.clamp(end))
+	if e.readOnly {
+		return end
+	}
+
+	oldText := e.buf.slice(start, end)
+	newEnd := e.buf.replace(start, end, text)
+	e.highlighter.edited(start.row, end.row-start.row+1, newEnd.row-start.row+1)
+	e.shiftMarkers(start, end, newEnd)
+	e.shiftFolds(start, end, newEnd)
+	e.recordEdit(edit{start: start, oldEnd: end, newEnd: newEnd, oldText: oldText, newText: text})
+	return newEnd
+}
+
+func (e *editor) changed() {
+	e.closeEditGroup()
+	if e.search != nil {
+		e.findMatches()
+	}
+
+	e.goalCol = visualCol(e.buf.line(e.cursor.row), e.cursor.col)
+	e.scrollToCursor()
+	e.Refresh()
+	e.cursorChanged()
+	e.lspChanged()
+	e.structureChanged()
+	e.typeCheckChanged()
+
+	if e.OnChanged != nil {
+		e.OnChanged()
+	}
+}
+
+// Replaces the selection, if any, with the given text
+func (e *editor) insert(text string) {
+	e.cursor = e.replace(e.anchor, e.cursor, text)
+	e.anchor = e.cursor
+	e.changed()
+}
+
+func (e *editor) hasSelection() bool {
+	return e.anchor != e.cursor
+}
+
+func (e *editor) selectedText() string {
+	return e.buf.slice(e.anchor, e.cursor)
+}
+
+func (e *editor) deleteSelection() {
+	if e.hasSelection() {
+		e.insert("")
+	}
+}
+
+// Moves the cursor, extending the selection when asked to
+func (e *editor) moveTo(pos textPos, extend bool) {
+	e.cursor = e.buf.clamp(pos)
+	if !extend {
+		e.anchor = e.cursor
+	}
+	e.scrollToCursor()
+	e.Refresh()
+	e.cursorChanged()
+}
+
+func (e *editor) cursorChanged() {
+	if e.onCursorChanged != nil {
+		e.onCursorChanged()
+	}
+}
+
+// Line and column of the cursor as shown to the user, along with what the
+// markers of the current line say
+func (e *editor) statusText() string {
+	line := e.buf.line(e.cursor.row)
+	status := fmt.Sprintf("Ln %d, Col %d", e.cursor.row+1, visualCol(line, e.cursor.col)+1)
+	if mode := e.keyMode(); mode != nil && len(mode.status()) > 0 {
+		status = mode.status() + " · " + status
+	}
+	if e.hasSelection() {
+		status += fmt.Sprintf(" (%d selected)", utf8.RuneCountInString(e.selectedText()))
+	}
+
+	markers := e.markersAt(e.cursor.row)
+	if len(markers) > 0 {
+		status += " · " + markers[0].message
+	}
+
+	return status
+}
+
+// Moves by visible lines, going to either end of the code when there are
+// not as many lines left
+func (e *editor) moveVertically(rows int, extend bool) {
+	row, ok := e.stepRows(e.cursor.row, rows)
+	pos := textPos{row: row, col: colAtVisual(e.buf.line(row), e.goalCol)}
+	switch {
+	case !ok && rows < 0:
+		pos = textPos{}
+	case !ok:
+		pos = textPos{row: row, col: len(e.buf.line(row))}
+	}
+
+	goalCol := e.goalCol
+	e.moveTo(pos, extend)
+	e.goalCol = goalCol
+}
+
+func (e *editor) moveHorizontally(pos textPos, extend bool) {
+	e.moveTo(pos, extend)
+	e.goalCol = visualCol(e.buf.line(e.cursor.row), e.cursor.col)
+}
+
+func (e *editor) prevPos(pos textPos) textPos {
+	switch {
+	case pos.col > 0:
+		return textPos{row: pos.row, col: pos.col - 1}
+	case pos.row > 0:
+		return textPos{row: pos.row - 1, col: len(e.buf.line(pos.row - 1))}
+	}
+
+	return pos
+}
+
+func (e *editor) nextPos(pos textPos) textPos {
+	switch {
+	case pos.col < len(e.buf.line(pos.row)):
+		return textPos{row: pos.row, col: pos.col + 1}
+	case pos.row < e.buf.lineCount()-1:
+		return textPos{row: pos.row + 1}
 	}
 
-	switch customShortcut.ShortcutName() {
-	case ALT_RETURN:
-		snippet, err := e.snippet.Get()
-		if err != nil {
-			logger.Fatal("e.snippet.Get()", zap.Error(err))
+	return pos
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Skips whitespace and then a run of either word or punctuation runes
+func (e *editor) prevWordPos(pos textPos) textPos {
+	if pos.col == 0 {
+		return e.prevPos(pos)
+	}
+
+	line := e.buf.line(pos.row)
+	col := pos.col
+	for col > 0 && unicode.IsSpace(line[col-1]) {
+		col--
+	}
+
+	word := col > 0 && isWordRune(line[col-1])
+	for col > 0 && !unicode.IsSpace(line[col-1]) && isWordRune(line[col-1]) == word {
+		col--
+	}
+
+	return textPos{row: pos.row, col: col}
+}
+
+func (e *editor) nextWordPos(pos textPos) textPos {
+	line := e.buf.line(pos.row)
+	if pos.col == len(line) {
+		return e.nextPos(pos)
+	}
+
+	col := pos.col
+	for col < len(line) && unicode.IsSpace(line[col]) {
+		col++
+	}
+
+	word := col < len(line) && isWordRune(line[col])
+	for col < len(line) && !unicode.IsSpace(line[col]) && isWordRune(line[col]) == word {
+		col++
+	}
+
+	return textPos{row: pos.row, col: col}
+}
+
+// Home goes to the first non blank character of the line, or to the start
+// of the line when already there
+func (e *editor) homePos(pos textPos) textPos {
+	line := e.buf.line(pos.row)
+	indent := 0
+	for indent < len(line) && (line[indent] == ' ' || line[indent] == '\t') {
+		indent++
+	}
+
+	if pos.col == indent {
+		return textPos{row: pos.row}
+	}
+
+	return textPos{row: pos.row, col: indent}
+}
+
+func (e *editor) selectWord(pos textPos) {
+	line := e.buf.line(pos.row)
+	start, end := pos.col, pos.col
+	for start > 0 && isWordRune(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isWordRune(line[end]) {
+		end++
+	}
+
+	e.anchor = textPos{row: pos.row, col: start}
+	e.moveHorizontally(textPos{row: pos.row, col: end}, true)
+}
+
+func (e *editor) metrics() (charWidth, lineHeight float32) {
+	size := fyne.MeasureText("M", theme.TextSize(), fyne.TextStyle{Monospace: true})
+	return size.Width, size.Height
+}
+
+// Where the first visible column of the first visible line is drawn
+func (e *editor) textOrigin() fyne.Position {
+	return fyne.NewPos(e.gutterWidth()+theme.Padding()*2, theme.Padding())
+}
+
+func (e *editor) visibleRows() int {
+	_, lineHeight := e.metrics()
+	return max(1, int((e.Size().Height-e.textOrigin().Y-theme.Padding())/lineHeight))
+}
+
+func (e *editor) visibleCols() int {
+	charWidth, _ := e.metrics()
+	return max(1, int((e.Size().Width-e.textOrigin().X-theme.Padding())/charWidth))
+}
+
+// Scrolls by whole lines and columns, so text is never drawn partially
+// outside of the editor. The cursor's line is unfolded if it was hidden
+func (e *editor) scrollToCursor() {
+	e.revealRow(e.cursor.row)
+	e.keepVisible()
+
+	cols := e.visibleCols()
+	first, _ := e.stepRows(e.cursor.row, 1-e.visibleRows())
+	switch {
+	case e.cursor.row < e.top:
+		e.top = e.cursor.row
+	case first > e.top:
+		e.top = first
+	}
+
+	col := visualCol(e.buf.line(e.cursor.row), e.cursor.col)
+	switch {
+	case col < e.left:
+		e.left = col
+	case col >= e.left+cols:
+		e.left = col - cols + 1
+	}
+}
+
+func (e *editor) posAt(pos fyne.Position) textPos {
+	charWidth, lineHeight := e.metrics()
+	origin := e.textOrigin()
+
+	row, ok := e.stepRows(e.top, int((pos.Y-origin.Y)/lineHeight))
+	if pos.Y < origin.Y {
+		row, ok = e.stepRows(e.top, -1)
+		if !ok {
+			return textPos{}
 		}
+	} else if !ok {
+		return textPos{row: row, col: len(e.buf.line(row))}
+	}
 
-		if len(snippet) > 0 {
-			output, err := runCode(snippet, []byte(e.Text))
-			if err != nil {
-				logger.Fatal("runCode()", zap.Error(err))
-			}
+	col := e.left + int((pos.X-origin.X)/charWidth+0.5)
+	return textPos{row: row, col: colAtVisual(e.buf.line(row), max(col, 0))}
+}
 
-			err = e.output.Set(output)
-			if err != nil {
-				logger.Fatal("e.output.Set()", zap.Error(err))
-			}
+func (e *editor) Scrolled(ev *fyne.ScrollEvent) {
+	charWidth, lineHeight := e.metrics()
+	e.scrolled.DX -= ev.Scrolled.DX
+	e.scrolled.DY -= ev.Scrolled.DY
+
+	rows := int(e.scrolled.DY / lineHeight)
+	cols := int(e.scrolled.DX / charWidth)
+	e.scrolled.DY -= float32(rows) * lineHeight
+	e.scrolled.DX -= float32(cols) * charWidth
 
+	last, _ := e.stepRows(e.lastVisibleRow(), 1-e.visibleRows())
+	e.top, _ = e.stepRows(e.top, rows)
+	e.top = min(e.top, last)
+	e.left = max(e.left+cols, 0)
+	e.Refresh()
+}
+
+func (e *editor) Cursor() desktop.Cursor {
+	return desktop.TextCursor
+}
+
+func (e *editor) requestFocus() {
+	c := fyne.CurrentApp().Driver().CanvasForObject(e)
+	if c != nil && c.Focused() != e {
+		c.Focus(e)
+	}
+}
+
+func (e *editor) MouseDown(ev *desktop.MouseEvent) {
+	e.requestFocus()
+	if ev.Button != desktop.MouseButtonPrimary {
+		return
+	}
+
+	e.completion.hide()
+	e.hideInfo()
+
+	// Clicking a line number selects the whole line, and clicking next to
+	// it folds or unfolds the lines that follow
+	pos := e.posAt(ev.Position)
+	if ev.Position.X >= e.foldToggleX() && ev.Position.X < e.gutterWidth() {
+		e.toggleFold(pos.row)
+		return
+	}
+	if ev.Position.X < e.gutterWidth() {
+		e.anchor = textPos{row: pos.row}
+		e.moveHorizontally(e.nextPos(textPos{row: pos.row, col: len(e.buf.line(pos.row))}), true)
+		return
+	}
+
+	e.moveHorizontally(pos, ev.Modifier&fyne.KeyModifierShift != 0)
+	if ev.Modifier&fyne.KeyModifierShortcutDefault != 0 {
+		e.gotoDefinition(pos)
+	}
+}
+
+func (e *editor) MouseUp(*desktop.MouseEvent) {}
+
+func (e *editor) Dragged(ev *fyne.DragEvent) {
+	e.moveHorizontally(e.posAt(ev.Position), true)
+}
+
+func (e *editor) DragEnd() {}
+
+func (e *editor) DoubleTapped(ev *fyne.PointEvent) {
+	e.selectWord(e.posAt(ev.Position))
+}
+
+func (e *editor) AcceptsTab() bool {
+	return true
+}
+
+func (e *editor) FocusGained() {
+	e.focused = true
+	e.Refresh()
+	e.ensureLSP()
+}
+
+func (e *editor) FocusLost() {
+	e.focused = false
+	e.shift = false
+	e.Refresh()
+	e.hideInfo()
+
+	if e.onFocusLost != nil {
+		e.onFocusLost()
+	}
+}
+
+func (e *editor) KeyDown(key *fyne.KeyEvent) {
+	if key.Name == desktop.KeyShiftLeft || key.Name == desktop.KeyShiftRight {
+		e.shift = true
+	}
+}
+
+func (e *editor) KeyUp(key *fyne.KeyEvent) {
+	if key.Name == desktop.KeyShiftLeft || key.Name == desktop.KeyShiftRight {
+		e.shift = false
+	}
+}
+
+// Typing a selector asks for completions and typing a call shows the
+// signature of the function being called
+func (e *editor) TypedRune(r rune) {
+	if mode := e.keyMode(); mode != nil && mode.typedRune(r) {
+		return
+	}
+
+	e.typeRune(r)
+
+	switch {
+	case r == '.':
+		e.completion.hide()
+		e.complete()
+	case r == '(' || r == ',':
+		e.signatureHelp()
+	case r == ')':
+		e.hideInfo()
+	}
+
+	if e.completion.visible() {
+		e.completion.filter()
+	}
+}
+
+func (e *editor) TypedKey(key *fyne.KeyEvent) {
+	if e.completion.typedKey(key) {
+		return
+	}
+	if mode := e.keyMode(); mode != nil && mode.typedKey(key) {
+		return
+	}
+
+	switch key.Name {
+	case fyne.KeyReturn, fyne.KeyEnter:
+		e.newline()
+	case fyne.KeyTab:
+		first, last := e.selectedRows()
+		switch {
+		case e.shift:
+			e.indentRows(true)
+		case last > first:
+			e.indentRows(false)
+		default:
+			e.insert("\t")
+		}
+	case fyne.KeyBackspace:
+		e.backspace()
+		if e.completion.visible() {
+			e.completion.filter()
+		}
+	case fyne.KeyDelete:
+		if !e.hasSelection() {
+			e.anchor = e.nextPos(e.cursor)
+		}
+		e.deleteSelection()
+	case fyne.KeyLeft:
+		start, _ := orderPos(e.anchor, e.cursor)
+		if e.hasSelection() && !e.shift {
+			e.moveHorizontally(start, false)
 			return
 		}
+		e.moveHorizontally(e.prevPos(e.cursor), e.shift)
+	case fyne.KeyRight:
+		_, end := orderPos(e.anchor, e.cursor)
+		if e.hasSelection() && !e.shift {
+			e.moveHorizontally(end, false)
+			return
+		}
+		e.moveHorizontally(e.nextPos(e.cursor), e.shift)
+	case fyne.KeyUp:
+		e.moveVertically(-1, e.shift)
+	case fyne.KeyDown:
+		e.moveVertically(1, e.shift)
+	case fyne.KeyPageUp:
+		e.moveVertically(-e.visibleRows(), e.shift)
+	case fyne.KeyPageDown:
+		e.moveVertically(e.visibleRows(), e.shift)
+	case fyne.KeyHome:
+		e.moveHorizontally(e.homePos(e.cursor), e.shift)
+	case fyne.KeyEnd:
+		e.moveHorizontally(textPos{row: e.cursor.row, col: len(e.buf.line(e.cursor.row))}, e.shift)
+	case fyne.KeyEscape:
+		e.hideInfo()
+		e.moveTo(e.cursor, false)
+	}
+}
 
-		output, err := runCode("", []byte(e.Text))
-		if err != nil {
-			logger.Fatal("runCode()", zap.Error(err))
+// Keys handled by the editor itself, they move the cursor around so they
+// are not part of the configurable keymap
+func (e *editor) typedEditorShortcut(shortcut *desktop.CustomShortcut) bool {
+	extend := shortcut.Modifier&fyne.KeyModifierShift != 0
+	switch shortcut.Modifier &^ fyne.KeyModifierShift {
+	case fyne.KeyModifierShortcutDefault:
+		switch shortcut.KeyName {
+		case fyne.KeyLeft:
+			e.moveHorizontally(e.prevWordPos(e.cursor), extend)
+		case fyne.KeyRight:
+			e.moveHorizontally(e.nextWordPos(e.cursor), extend)
+		case fyne.KeyHome:
+			e.moveHorizontally(textPos{}, extend)
+		case fyne.KeyEnd:
+			e.moveHorizontally(e.buf.end(), extend)
+		case fyne.KeyBackspace:
+			if !e.hasSelection() {
+				e.anchor = e.prevWordPos(e.cursor)
+			}
+			e.deleteSelection()
+		case fyne.KeyDelete:
+			if !e.hasSelection() {
+				e.anchor = e.nextWordPos(e.cursor)
+			}
+			e.deleteSelection()
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+
+	return true
+}
+
+func (e *editor) TypedShortcut(shortcut fyne.Shortcut) {
+	if e.boundAltShortcut(shortcut) {
+		e.onShortcut(shortcut)
+		return
+	}
+	if mode := e.keyMode(); mode != nil && mode.typedShortcut(shortcut) {
+		return
+	}
+
+	switch s := shortcut.(type) {
+	case *fyne.ShortcutCopy:
+		if e.hasSelection() {
+			s.Clipboard.SetContent(e.selectedText())
+		}
+	case *fyne.ShortcutCut:
+		if e.hasSelection() {
+			s.Clipboard.SetContent(e.selectedText())
+			e.deleteSelection()
+		}
+	case *fyne.ShortcutPaste:
+		e.insert(strings.ReplaceAll(s.Clipboard.Content(), "\r\n", "\n"))
+	case *fyne.ShortcutSelectAll:
+		e.anchor = textPos{}
+		e.moveHorizontally(e.buf.end(), true)
+	case *desktop.CustomShortcut:
+		if e.typedEditorShortcut(s) {
+			return
 		}
 
-		err = e.output.Set(output)
-		if err != nil {
-			logger.Fatal("e.output.Set()", zap.Error(err))
+		// Shortcuts are delivered to the focused widget instead of the
+		// canvas, the rest are handed over so they act on the selected tab
+		if e.onShortcut != nil {
+			e.onShortcut(shortcut)
 		}
 	}
 }
+
+func (e *editor) run() {
+	switch {
+	case getSettings().ImportsOnRun:
+		e.organizeImports()
+	case getSettings().FormatOnRun:
+		e.format()
+	}
+
+	e.execute("Running code", runCode)
+}
+
+func (e *editor) test() {
+	switch {
+	case getSettings().ImportsOnRun:
+		e.organizeImports()
+	case getSettings().FormatOnRun:
+		e.format()
+	}
+
+	e.execute("Testing code", testCode)
+}
+
+// Stops the program that is currently running, if any
+func (e *editor) stop() {
+	e.runMu.Lock()
+	defer e.runMu.Unlock()
+
+	if e.stopRun != nil {
+		e.stopRun()
+		e.stopRun = nil
+	}
+}
+
+// Compile errors are part of the output, only failures to get the code to
+// the compiler are reported in the console's banner. Programs run in the
+// background so they can be stopped, starting a new one stops the previous
+// and drops whatever it still prints or reports.
+// Their output is streamed into the console as they print it, and kept
+// apart along with how they ended in the tab's history. Every command a
+// run starts is shown above its output
+func (e *editor) execute(op string, fn func(ctx context.Context, snippet string, data []byte, config runConfig, onCommand func(args []string), stdout, stderr io.Writer) (int, error)) {
+	snippet, err := e.snippet.Get()
+	if err != nil {
+		e.banner.showError(op, err)
+		return
+	}
+
+	e.stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	e.runMu.Lock()
+	e.stopRun = cancel
+	e.runs++
+	run := e.runs
+	e.runMu.Unlock()
+
+	code, config := e.Text(), e.config
+	e.console.clear()
+	console := &runWriter{editor: e, run: run}
+	onCommand := func(args []string) {
+		fmt.Fprintf(console, "\x1b[90m$ %s\x1b[0m\n", config.commandLine(args))
+	}
+	go func() {
+		defer cancel()
+
+		started := time.Now()
+		stdout, stderr := &cappedBuffer{}, &cappedBuffer{}
+		exitCode, err := fn(ctx, snippet, []byte(code), config, onCommand, io.MultiWriter(console, stdout), io.MultiWriter(console, stderr))
+		duration := time.Since(started)
+		runOnUI(func() {
+			if !e.currentRun(run) {
+				return
+			}
+
+			e.console.flush()
+			if err != nil {
+				e.banner.showError(op, err)
+				return
+			}
+
+			// Running a snippet writes its code to disk
+			if len(snippet) > 0 && e.onSaved != nil {
+				e.onSaved(code)
+			}
+
+			e.setMarkers("run", compileMarkers(e.console.String(), code, markerError))
+			e.banner.Hide()
+
+			if e.onRun != nil {
+				e.onRun(runRecord{
+					started: started,
+					goVersion: os.Getenv("RUNGO_GO_VER"),
+					code: code,
+					hash: sourceHash(code),
+					exitCode: exitCode,
+					duration: duration,
+					stdout: stdout.String(),
+					stderr: stderr.String(),
+				})
+			}
+		})
+	}()
+}
+
+// Whether no other run was started after the given one
+func (e *editor) currentRun(run int) bool {
+	e.runMu.Lock()
+	defer e.runMu.Unlock()
+
+	return e.runs == run
+}
+
+// Writes a run's output to the console until a newer run is started, the
+// lock is held while writing so nothing gets in after the console is
+// cleared for the newer one
+type runWriter struct {
+	editor	*editor
+	run		int
+}
+
+func (w *runWriter) Write(p []byte) (int, error) {
+	w.editor.runMu.Lock()
+	defer w.editor.runMu.Unlock()
+
+	if w.editor.runs != w.run {
+		return len(p), nil
+	}
+	return w.editor.console.Write(p)
+}
@@ -0,0 +1,367 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+)
+
+// Emacs' movement, mark and kill ring keys. Alt shortcuts bound to the
+// app's commands take precedence over the Meta keys they overlap with
+type emacsMode struct {
+	editor		*editor
+	mark		bool
+	prefix		bool
+	killRing	[]string
+	yanked		int
+	yankStart	textPos
+	lastCommand	string
+}
+
+func newEmacsMode(e *editor) *emacsMode {
+	return &emacsMode{editor: e, yanked: -1}
+}
+
+func (m *emacsMode) status() string {
+	switch {
+	case m.prefix:
+		return "C-x-"
+	case m.mark:
+		return "Mark set"
+	}
+
+	return ""
+}
+
+func (m *emacsMode) blockCursor() (textPos, bool) {
+	return textPos{}, false
+}
+
+// Typing replaces nothing while the mark is set, it only stops selecting
+func (m *emacsMode) typedRune(r rune) bool {
+	m.lastCommand = ""
+	if m.prefix {
+		m.prefix = false
+		m.editor.cursorChanged()
+		m.prefixedRune(r)
+		return true
+	}
+
+	m.stopMark()
+	return false
+}
+
+// Arrow keys extend the selection from the mark while it's set
+func (m *emacsMode) typedKey(key *fyne.KeyEvent) bool {
+	e := m.editor
+	m.lastCommand = ""
+	if m.prefix {
+		// Runes are typed after their key, the prefix is left for them
+		return key.Name != fyne.KeyEscape
+	}
+
+	if !m.mark {
+		return false
+	}
+
+	switch key.Name {
+	case fyne.KeyLeft:
+		m.move(e.prevPos(e.cursor))
+	case fyne.KeyRight:
+		m.move(e.nextPos(e.cursor))
+	case fyne.KeyUp:
+		e.moveVertically(-1, true)
+	case fyne.KeyDown:
+		e.moveVertically(1, true)
+	case fyne.KeyPageUp:
+		e.moveVertically(-e.visibleRows(), true)
+	case fyne.KeyPageDown:
+		e.moveVertically(e.visibleRows(), true)
+	case fyne.KeyHome:
+		m.move(e.homePos(e.cursor))
+	case fyne.KeyEnd:
+		m.move(textPos{row: e.cursor.row, col: len(e.buf.line(e.cursor.row))})
+	default:
+		m.stopMark()
+		return false
+	}
+
+	return true
+}
+
+func (m *emacsMode) typedShortcut(shortcut fyne.Shortcut) bool {
+	s, ok := ctrlShortcut(shortcut)
+	if !ok {
+		return false
+	}
+
+	// Whatever follows Ctrl+X is taken, as emacs does with undefined keys
+	if m.prefix {
+		m.prefix = false
+		m.editor.cursorChanged()
+		m.prefixed(s)
+		return true
+	}
+
+	command := ""
+	switch s.Modifier {
+	case fyne.KeyModifierControl:
+		command = m.control(s.KeyName)
+	case fyne.KeyModifierAlt:
+		command = m.meta(s.KeyName)
+	case fyne.KeyModifierAlt | fyne.KeyModifierShift:
+		command = m.meta(map[fyne.KeyName]fyne.KeyName{fyne.KeyComma: "<", fyne.KeyPeriod: ">"}[s.KeyName])
+	case fyne.KeyModifierControl | fyne.KeyModifierShift:
+		if s.KeyName == fyne.KeyMinus {
+			m.editor.undo()
+			command = "undo"
+		}
+	}
+
+	if len(command) == 0 {
+		return false
+	}
+
+	m.lastCommand = command
+	m.editor.cursorChanged()
+	return true
+}
+
+// Runs a Ctrl key, returning the command it ran if any
+func (m *emacsMode) control(key fyne.KeyName) string {
+	e := m.editor
+	switch key {
+	case fyne.KeyF:
+		m.move(e.nextPos(e.cursor))
+	case fyne.KeyB:
+		m.move(e.prevPos(e.cursor))
+	case fyne.KeyN:
+		e.moveVertically(1, m.mark)
+	case fyne.KeyP:
+		e.moveVertically(-1, m.mark)
+	case fyne.KeyA:
+		m.move(textPos{row: e.cursor.row})
+	case fyne.KeyE:
+		m.move(textPos{row: e.cursor.row, col: len(e.buf.line(e.cursor.row))})
+	case fyne.KeyV:
+		e.moveVertically(e.visibleRows(), m.mark)
+	case fyne.KeyD:
+		m.stopMark()
+		e.anchor = e.nextPos(e.cursor)
+		e.deleteSelection()
+	case fyne.KeyK:
+		m.killLine()
+		return "kill"
+	case fyne.KeyW:
+		if e.hasSelection() {
+			m.kill(e.anchor, e.cursor)
+			m.mark = false
+		}
+		return "kill"
+	case fyne.KeyY:
+		m.yank()
+		return "yank"
+	case fyne.KeySpace:
+		m.mark = true
+		e.anchor = e.cursor
+		e.Refresh()
+	case fyne.KeyG:
+		m.stopMark()
+		e.completion.hide()
+		e.hideInfo()
+	case fyne.KeyO:
+		cursor := e.cursor
+		m.stopMark()
+		e.insert("\n")
+		e.setCursor(cursor)
+	case fyne.KeyL:
+		// Centers the cursor's line
+		e.top, _ = e.stepRows(e.cursor.row, -e.visibleRows()/2)
+		e.Refresh()
+	case fyne.KeySlash:
+		e.undo()
+	case fyne.KeyS, fyne.KeyR:
+		e.runCommand("find")
+	case fyne.KeyX:
+		m.prefix = true
+	default:
+		return ""
+	}
+
+	return string(key)
+}
+
+// Runs an Alt key, known as Meta in emacs
+func (m *emacsMode) meta(key fyne.KeyName) string {
+	e := m.editor
+	switch key {
+	case fyne.KeyF:
+		m.move(e.nextWordPos(e.cursor))
+	case fyne.KeyB:
+		m.move(e.prevWordPos(e.cursor))
+	case fyne.KeyV:
+		e.moveVertically(-e.visibleRows(), m.mark)
+	case "<":
+		m.move(textPos{})
+	case ">":
+		m.move(e.buf.end())
+	case fyne.KeyD:
+		m.stopMark()
+		m.kill(e.cursor, e.nextWordPos(e.cursor))
+		return "kill"
+	case fyne.KeyBackspace:
+		m.stopMark()
+		m.kill(e.prevWordPos(e.cursor), e.cursor)
+		return "kill"
+	case fyne.KeyW:
+		if e.hasSelection() {
+			m.pushKill(e.selectedText())
+			m.stopMark()
+		}
+	case fyne.KeyY:
+		if m.lastCommand != "yank" {
+			return ""
+		}
+		m.yankPop()
+		return "yank"
+	default:
+		return ""
+	}
+
+	return "M-" + string(key)
+}
+
+// Keys typed with Ctrl after Ctrl+X
+func (m *emacsMode) prefixed(s *desktop.CustomShortcut) {
+	e := m.editor
+	if s.Modifier != fyne.KeyModifierControl {
+		return
+	}
+
+	switch s.KeyName {
+	case fyne.KeyS:
+		e.runCommand("save")
+	case fyne.KeyW:
+		e.runCommand("save-as")
+	case fyne.KeyX:
+		// Exchanges the cursor and the mark
+		e.anchor, e.cursor = e.cursor, e.anchor
+		m.mark = e.hasSelection()
+		e.moveTo(e.cursor, true)
+	}
+}
+
+// Plain keys typed after Ctrl+X
+func (m *emacsMode) prefixedRune(r rune) {
+	e := m.editor
+	switch r {
+	case 'h':
+		e.anchor = textPos{}
+		e.moveTo(e.buf.end(), true)
+		m.mark = true
+	case 'u':
+		e.undo()
+	case 'k':
+		e.runCommand("tab.close")
+	}
+}
+
+// Moving extends the selection from the mark while it's set
+func (m *emacsMode) move(pos textPos) {
+	m.editor.moveHorizontally(pos, m.mark)
+}
+
+func (m *emacsMode) stopMark() {
+	if m.mark {
+		m.mark = false
+		m.editor.moveTo(m.editor.cursor, false)
+	}
+}
+
+// Kills from the cursor to the end of the line, or the line break when
+// already there. Consecutive kills are yanked back at once
+func (m *emacsMode) killLine() {
+	e := m.editor
+	m.stopMark()
+	end := textPos{row: e.cursor.row, col: len(e.buf.line(e.cursor.row))}
+	if e.cursor == end {
+		end = e.nextPos(end)
+	}
+	m.kill(e.cursor, end)
+}
+
+// Kills made one after another are joined, killing backwards such as with
+// Alt+Backspace puts the text before the one killed last
+func (m *emacsMode) kill(start, end textPos) {
+	e := m.editor
+	backward := e.cursor == end && start != end
+	start, end = orderPos(start, end)
+	text := e.buf.slice(start, end)
+	if len(text) == 0 {
+		return
+	}
+
+	if m.lastCommand == "kill" && len(m.killRing) > 0 {
+		last := &m.killRing[len(m.killRing)-1]
+		if backward {
+			*last = text + *last
+		} else {
+			*last += text
+		}
+		if e.clipboard != nil {
+			e.clipboard.SetContent(m.killRing[len(m.killRing)-1])
+		}
+	} else {
+		m.pushKill(text)
+	}
+
+	e.anchor, e.cursor = start, end
+	e.deleteSelection()
+}
+
+// Killed text is shared with the clipboard, so it can be pasted elsewhere
+func (m *emacsMode) pushKill(text string) {
+	m.killRing = append(m.killRing, text)
+	if len(m.killRing) > KILL_RING_LIMIT {
+		m.killRing = m.killRing[1:]
+	}
+
+	if m.editor.clipboard != nil {
+		m.editor.clipboard.SetContent(text)
+	}
+}
+
+// Inserts the last killed text, or what was copied elsewhere since then
+func (m *emacsMode) yank() {
+	e := m.editor
+	m.stopMark()
+	if e.clipboard != nil {
+		content := e.clipboard.Content()
+		if len(content) > 0 && (len(m.killRing) == 0 || content != m.killRing[len(m.killRing)-1]) {
+			m.pushKill(content)
+		}
+	}
+
+	if len(m.killRing) == 0 {
+		return
+	}
+
+	m.yanked = len(m.killRing) - 1
+	m.yankStart = e.cursor
+	e.insert(m.killRing[m.yanked])
+}
+
+// Replaces the text just yanked with the one killed before it
+func (m *emacsMode) yankPop() {
+	e := m.editor
+	if m.yanked < 0 || len(m.killRing) == 0 {
+		return
+	}
+
+	m.yanked = (m.yanked - 1 + len(m.killRing)) % len(m.killRing)
+	e.anchor = m.yankStart
+	e.insert(m.killRing[m.yanked])
+}
@@ -0,0 +1,117 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+)
+
+// Types keys written as emacs writes them and separated by spaces, e.g.
+// "C-x C-s". Anything else is typed as it is
+func typeEmacsKeys(e *editor, keys string) {
+	names := map[string]fyne.KeyName{"<": fyne.KeyComma, ">": fyne.KeyPeriod, "<BS>": fyne.KeyBackspace, "Space": fyne.KeySpace}
+	for _, key := range strings.Fields(keys) {
+		modifier := fyne.KeyModifier(0)
+		switch {
+		case strings.HasPrefix(key, "C-"):
+			modifier = fyne.KeyModifierControl
+		case strings.HasPrefix(key, "M-"):
+			modifier = fyne.KeyModifierAlt
+		default:
+			for _, r := range key {
+				e.TypedRune(r)
+			}
+			continue
+		}
+
+		name, ok := names[key[2:]]
+		if !ok {
+			name = fyne.KeyName(strings.ToUpper(key[2:]))
+		}
+		if name == fyne.KeyComma || name == fyne.KeyPeriod {
+			modifier |= fyne.KeyModifierShift
+		}
+		e.TypedShortcut(&desktop.CustomShortcut{KeyName: name, Modifier: modifier})
+	}
+}
+
+func TestEmacsMotions(t *testing.T) {
+	tests := []struct {
+		name	string
+		text	string
+		keys	string
+		want	textPos
+	}{
+		{name: "forward", text: "foo bar", keys: "C-f C-f", want: textPos{0, 2}},
+		{name: "backward", text: "foo bar", keys: "C-e C-b", want: textPos{0, 6}},
+		{name: "line end", text: "foo bar", keys: "C-e", want: textPos{0, 7}},
+		{name: "line start", text: "foo bar", keys: "C-e C-a", want: textPos{0, 0}},
+		{name: "next line", text: "ab\ncd", keys: "C-f C-n", want: textPos{1, 1}},
+		{name: "previous line", text: "ab\ncd", keys: "C-n C-p", want: textPos{0, 0}},
+		{name: "word forward", text: "foo bar", keys: "M-f", want: textPos{0, 3}},
+		{name: "word backward", text: "foo bar", keys: "C-e M-b", want: textPos{0, 4}},
+		{name: "end of the code", text: "a\nbc", keys: "M->", want: textPos{1, 2}},
+		{name: "start of the code", text: "a\nbc", keys: "M-> M-<", want: textPos{0, 0}},
+		{name: "exchange cursor and mark", text: "foo bar", keys: "C-Space C-e C-x C-x", want: textPos{0, 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, _ := newModeEditor(t, KEYBINDINGS_EMACS, test.text)
+			typeEmacsKeys(e, test.keys)
+
+			if e.cursor != test.want {
+				t.Errorf("got cursor %v, want %v", e.cursor, test.want)
+			}
+		})
+	}
+}
+
+func TestEmacsEdits(t *testing.T) {
+	tests := []struct {
+		name			string
+		text			string
+		keys			string
+		want			string
+		wantCommands	[]string
+	}{
+		{name: "delete char", text: "abc", keys: "C-d", want: "bc"},
+		{name: "kill line", text: "foo bar\nbaz", keys: "C-k", want: "\nbaz"},
+		{name: "kill line break", text: "foo bar\nbaz", keys: "C-k C-k", want: "baz"},
+		{name: "kills yanked at once", text: "foo bar\nbaz", keys: "C-k C-k C-y", want: "foo bar\nbaz"},
+		{name: "kill word", text: "foo bar", keys: "M-d", want: " bar"},
+		{name: "kill word backward", text: "foo bar", keys: "C-e M-<BS>", want: "foo "},
+		{name: "kill region", text: "foo bar", keys: "C-Space C-f C-f C-w", want: "o bar"},
+		{name: "copy region", text: "foo bar", keys: "C-Space M-f M-w C-e C-y", want: "foo barfoo"},
+		{name: "yank pop", text: "foo bar baz", keys: "M-d C-e M-<BS> C-y M-y", want: " bar foo"},
+		{name: "typing stops the mark", text: "foo", keys: "C-Space C-f x", want: "fxoo"},
+		{name: "open line", text: "ab", keys: "C-f C-o", want: "a\nb"},
+		{name: "undo", text: "foo bar", keys: "C-k C-/", want: "foo bar"},
+		{name: "select all and kill", text: "a\nb", keys: "C-x h C-w", want: ""},
+		{name: "save", text: "a", keys: "C-x C-s", want: "a", wantCommands: []string{"save"}},
+		{name: "save as", text: "a", keys: "C-x C-w", want: "a", wantCommands: []string{"save-as"}},
+		{name: "close", text: "a", keys: "C-x k", want: "a", wantCommands: []string{"tab.close"}},
+		{name: "find", text: "a", keys: "C-s", want: "a", wantCommands: []string{"find"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, commands := newModeEditor(t, KEYBINDINGS_EMACS, test.text)
+			typeEmacsKeys(e, test.keys)
+
+			if got := e.Text(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if !slices.Equal(*commands, test.wantCommands) {
+				t.Errorf("got commands %q, want %q", *commands, test.wantCommands)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/widget"
+	"github.com/PuerkitoBio/goquery"
+)
+
+type embedKind int
+
+const (
+	embedImage embedKind = iota
+	embedSVG
+	embedMarkdown
+	embedHTML
+)
+
+// Lines starting with a marker followed by base64 are rendered instead of
+// shown as text. IMAGE: is the Go Playground's, the rest are opt-in as
+// plain output could start with them
+var embedMarkers = []struct {
+	prefix	string
+	kind	embedKind
+	optIn	bool
+}{
+	{prefix: "IMAGE:", kind: embedImage},
+	{prefix: "SVG:", kind: embedSVG, optIn: true},
+	{prefix: "MARKDOWN:", kind: embedMarkdown, optIn: true},
+	{prefix: "HTML:", kind: embedHTML, optIn: true},
+}
+
+// Content a program printed to be rendered in the console, lines that start
+// with a marker but can't be rendered are kept with a nil object so they
+// aren't decoded again
+type consoleEmbed struct {
+	kind	embedKind
+	length	int
+	data	[]byte
+	format	string
+	object	fyne.CanvasObject
+	size	fyne.Size
+}
+
+// How many rows of the console the embed takes
+func (e *consoleEmbed) rows() int {
+	_, lineHeight := consoleMetrics()
+	return max(1, int(math.Ceil(float64(e.size.Height/lineHeight))))
+}
+
+// Images and SVGs can be saved, as the files they were printed from
+func (e *consoleEmbed) saveable() bool {
+	return e.object != nil && (e.kind == embedImage || e.kind == embedSVG)
+}
+
+// The embed a line stands for, if it starts with one of the markers
+func parseEmbed(line []cell, optIn bool) (*consoleEmbed, bool) {
+	for _, marker := range embedMarkers {
+		if marker.optIn && !optIn || !hasCellPrefix(line, marker.prefix) {
+			continue
+		}
+
+		e := &consoleEmbed{kind: marker.kind, length: len(line)}
+		payload := strings.TrimSpace(lineText(line[len(marker.prefix):]))
+		data, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			data, err = base64.RawStdEncoding.DecodeString(payload)
+		}
+		if err == nil {
+			e.data = data
+			e.render()
+		}
+
+		return e, true
+	}
+
+	return nil, false
+}
+
+func hasCellPrefix(line []cell, prefix string) bool {
+	i := 0
+	for _, r := range prefix {
+		if i >= len(line) || line[i].r != r {
+			return false
+		}
+		i++
+	}
+
+	return true
+}
+
+// Creates the object drawn for the embed, images taller than EMBED_HEIGHT
+// are scaled down
+func (e *consoleEmbed) render() {
+	switch e.kind {
+	case embedImage:
+		img, format, err := image.Decode(bytes.NewReader(e.data))
+		if err != nil {
+			return
+		}
+
+		bounds := img.Bounds()
+		object := canvas.NewImageFromImage(img)
+		object.FillMode = canvas.ImageFillContain
+		e.object, e.format = object, format
+		e.size = fitEmbed(float32(bounds.Dx()), float32(bounds.Dy()))
+	case embedSVG:
+		object := canvas.NewImageFromReader(bytes.NewReader(e.data), "image.svg")
+		if object == nil || object.Resource == nil {
+			return
+		}
+
+		object.FillMode = canvas.ImageFillContain
+		e.object, e.format = object, "svg"
+		width, height, ok := svgSize(e.data)
+		if !ok {
+			height = EMBED_HEIGHT
+			width = height * object.Aspect()
+		}
+		e.size = fitEmbed(width, height)
+	case embedMarkdown, embedHTML:
+		text := string(e.data)
+		if e.kind == embedHTML {
+			text = htmlMarkdown(e.data)
+		}
+
+		object := widget.NewRichTextFromMarkdown(text)
+		e.object = object
+		e.size = object.MinSize()
+	}
+}
+
+func fitEmbed(width, height float32) fyne.Size {
+	if height > EMBED_HEIGHT {
+		width, height = width*EMBED_HEIGHT/height, EMBED_HEIGHT
+	}
+
+	return fyne.NewSize(max(width, 1), max(height, 1))
+}
+
+// The width and height an SVG asks for, in pixels
+func svgSize(data []byte) (float32, float32, bool) {
+	var root struct {
+		Width	string	`xml:"width,attr"`
+		Height	string	`xml:"height,attr"`
+	}
+	if xml.Unmarshal(data, &root) != nil {
+		return 0, 0, false
+	}
+
+	width, widthErr := strconv.ParseFloat(strings.TrimSuffix(root.Width, "px"), 32)
+	height, heightErr := strconv.ParseFloat(strings.TrimSuffix(root.Height, "px"), 32)
+	if widthErr != nil || heightErr != nil || width <= 0 || height <= 0 {
+		return 0, 0, false
+	}
+
+	return float32(width), float32(height), true
+}
+
+var blankLinesRe = regexp.MustCompile(`\n{3,}`)
+
+// Fyne can't render HTML, it's turned into the markdown closest to it.
+// Scripts, styles and whatever can't be written as markdown are left out
+func htmlMarkdown(data []byte) string {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	if err != nil {
+		return string(data)
+	}
+
+	var b strings.Builder
+	var walk func(s *goquery.Selection)
+	walk = func(s *goquery.Selection) {
+		s.Contents().Each(func(_ int, node *goquery.Selection) {
+			switch name := goquery.NodeName(node); name {
+			case "#text":
+				// Whitespace is collapsed as browsers do
+				raw := node.Text()
+				fields := strings.Fields(raw)
+				text := strings.Join(fields, " ")
+				if len(raw) > 0 && unicode.IsSpace(rune(raw[0])) {
+					text = " " + text
+				}
+				if len(fields) > 0 && unicode.IsSpace(rune(raw[len(raw)-1])) {
+					text += " "
+				}
+				b.WriteString(text)
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				b.WriteString("\n\n" + strings.Repeat("#", int(name[1]-'0')) + " ")
+				walk(node)
+				b.WriteString("\n\n")
+			case "p", "div", "section", "article", "header", "footer", "table", "tr", "blockquote":
+				b.WriteString("\n\n")
+				walk(node)
+				b.WriteString("\n\n")
+			case "br":
+				b.WriteString("\n\n")
+			case "hr":
+				b.WriteString("\n\n---\n\n")
+			case "li":
+				b.WriteString("\n- ")
+				walk(node)
+			case "ul", "ol":
+				b.WriteString("\n")
+				walk(node)
+				b.WriteString("\n\n")
+			case "a":
+				href, _ := node.Attr("href")
+				b.WriteString("[")
+				walk(node)
+				b.WriteString("](" + href + ")")
+			case "strong", "b":
+				b.WriteString("**")
+				walk(node)
+				b.WriteString("**")
+			case "em", "i":
+				b.WriteString("*")
+				walk(node)
+				b.WriteString("*")
+			case "code":
+				b.WriteString("`" + node.Text() + "`")
+			case "pre":
+				b.WriteString("\n\n```\n" + strings.Trim(node.Text(), "\n") + "\n```\n\n")
+			case "img":
+				alt, _ := node.Attr("alt")
+				b.WriteString(alt)
+			case "head", "script", "style", "#comment":
+			default:
+				walk(node)
+			}
+		})
+	}
+	walk(doc.Selection)
+
+	return strings.TrimSpace(blankLinesRe.ReplaceAllString(b.String(), "\n\n"))
+}
@@ -0,0 +1,149 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"go.uber.org/zap"
+)
+
+var (
+	errNoGoVersion	= errors.New("no Go version is installed")
+	errNotSnippet	= errors.New("the code is not saved as a snippet")
+)
+
+// Wraps the failure of an external command, keeping what it printed so it
+// can be shown to the user
+type commandError struct {
+	args	[]string
+	output	string
+	err		error
+}
+
+func (c *commandError) Error() string {
+	return fmt.Sprintf("%s: %v", strings.Join(c.args, " "), c.err)
+}
+
+func (c *commandError) Unwrap() error {
+	return c.err
+}
+
+// Describes in a user-friendly way what went wrong, the underlying error
+// is kept for the details section and the logs
+func errorSummary(op string, err error) string {
+	var cmdErr *commandError
+	switch {
+	case errors.Is(err, errRequestFailed), errors.Is(err, errUnexpectedStatus):
+		return fmt.Sprintf("%s failed, check your internet connection and try again", op)
+	case errors.Is(err, errNoGoVersion):
+		return "No Go version is installed yet, pick one from the versions list"
+	case errors.Is(err, errNotSnippet):
+		return fmt.Sprintf("%s failed, save the code as a snippet first", op)
+	case errors.Is(err, os.ErrNotExist):
+		return fmt.Sprintf("%s failed, a file or directory does not exist", op)
+	case errors.Is(err, os.ErrExist):
+		return fmt.Sprintf("%s failed, it already exists", op)
+	case errors.Is(err, os.ErrPermission):
+		return fmt.Sprintf("%s failed, permission denied", op)
+	case errors.As(err, &cmdErr):
+		return fmt.Sprintf("%s failed, %s exited with an error", op, cmdErr.args[0])
+	}
+
+	return fmt.Sprintf("%s failed", op)
+}
+
+func errorDetails(err error) string {
+	details := err.Error()
+
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) && len(cmdErr.output) > 0 {
+		details = fmt.Sprintf("%s\n\n%s", details, strings.TrimSpace(cmdErr.output))
+	}
+
+	return details
+}
+
+func logError(op string, err error) {
+	fields := []zap.Field{zap.Error(err)}
+
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		fields = append(fields, zap.Strings("args", cmdErr.args), zap.String("output", cmdErr.output))
+	}
+
+	logger.Error(op, fields...)
+}
+
+func newErrorDetails(err error) *widget.Accordion {
+	details := widget.NewLabel(errorDetails(err))
+	details.Wrapping = fyne.TextWrapBreak
+
+	return widget.NewAccordion(widget.NewAccordionItem("Details", details))
+}
+
+// Logs the error along with what the user was doing, and shows it in a
+// dialog instead of terminating the application
+func showError(window fyne.Window, op string, err error) {
+	newErrorDialog(window, op, err).Show()
+}
+
+func newErrorDialog(window fyne.Window, op string, err error) *dialog.CustomDialog {
+	logError(op, err)
+
+	summary := widget.NewLabel(errorSummary(op, err))
+	summary.Wrapping = fyne.TextWrapWord
+
+	content := container.NewBorder(summary, nil, nil, nil, newErrorDetails(err))
+	errDialog := dialog.NewCustom("An error occurred", "Close", content, window)
+	errDialog.Resize(fyne.NewSize(440, 0))
+
+	return errDialog
+}
+
+// Shown on top of a tab's console for errors related to running its code
+type errorBanner struct {
+	summary	*widget.Label
+	details	*fyne.Container
+	*fyne.Container
+}
+
+func newErrorBanner() *errorBanner {
+	errorBanner := &errorBanner{
+		summary: widget.NewLabel(""),
+		details: container.NewStack(),
+	}
+	errorBanner.summary.Wrapping = fyne.TextWrapWord
+
+	errorBanner.Container = container.NewBorder(
+		container.NewBorder(nil, nil, widget.NewIcon(theme.ErrorIcon()), widget.NewButtonWithIcon("", theme.CancelIcon(), func() {
+			errorBanner.Hide()
+		}), errorBanner.summary),
+		nil,
+		nil,
+		nil,
+		errorBanner.details,
+	)
+	errorBanner.Hide()
+
+	return errorBanner
+}
+
+func (e *errorBanner) showError(op string, err error) {
+	logError(op, err)
+
+	e.summary.SetText(errorSummary(op, err))
+	e.details.Objects = []fyne.CanvasObject{newErrorDetails(err)}
+	e.details.Refresh()
+	e.Show()
+}
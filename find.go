@@ -0,0 +1,383 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// A match of the search in the code, along with the byte offsets of its
+// capture groups used to expand replacements
+type searchMatch struct {
+	start		textPos
+	end			textPos
+	submatches	[]int
+}
+
+// Highlights every match of the given search, or none if it's nil
+func (e *editor) setSearch(search *regexp.Regexp) {
+	e.search = search
+	e.findMatches()
+	e.Refresh()
+}
+
+// Matches are looked up again after every edit, empty matches can't be
+// highlighted or selected so they are left out
+func (e *editor) findMatches() {
+	e.matches = e.matches[:0]
+	if e.search == nil {
+		return
+	}
+
+	text := e.Text()
+	found := e.search.FindAllStringSubmatchIndex(text, SEARCH_MATCHES_LIMIT)
+
+	offsets := make([]int, 0, len(found)*2)
+	for _, submatches := range found {
+		if submatches[1] > submatches[0] {
+			offsets = append(offsets, submatches[0], submatches[1])
+		}
+	}
+
+	positions := positionsAt(text, offsets)
+	i := 0
+	for _, submatches := range found {
+		if submatches[1] > submatches[0] {
+			e.matches = append(e.matches, searchMatch{start: positions[i], end: positions[i+1], submatches: submatches})
+			i += 2
+		}
+	}
+}
+
+// Converts ascending byte offsets of the text into positions
+func positionsAt(text string, offsets []int) []textPos {
+	positions := make([]textPos, 0, len(offsets))
+	pos, prev := textPos{}, 0
+	for _, offset := range offsets {
+		for _, r := range text[prev:offset] {
+			if r == '\n' {
+				pos = textPos{row: pos.row + 1}
+				continue
+			}
+			pos.col++
+		}
+		prev = offset
+		positions = append(positions, pos)
+	}
+
+	return positions
+}
+
+// The match that is currently selected, if any
+func (e *editor) currentMatch() (int, bool) {
+	start, end := orderPos(e.anchor, e.cursor)
+	for i, m := range e.matches {
+		if m.start == start && m.end == end {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// Selects the next match after the cursor, or the previous one before the
+// selection, wrapping around the ends of the code
+func (e *editor) findNext(backward bool) {
+	if len(e.matches) == 0 {
+		return
+	}
+
+	start, end := orderPos(e.anchor, e.cursor)
+	next := 0
+	if backward {
+		next = len(e.matches) - 1
+		for i := len(e.matches) - 1; i >= 0; i-- {
+			if !start.before(e.matches[i].end) {
+				next = i
+				break
+			}
+		}
+	} else {
+		for i, m := range e.matches {
+			if !m.start.before(end) {
+				next = i
+				break
+			}
+		}
+	}
+
+	e.selectMatch(e.matches[next])
+}
+
+func (e *editor) selectMatch(m searchMatch) {
+	e.anchor = m.start
+	e.moveTo(m.end, true)
+}
+
+// Replaces the selected match and moves on to the next one, capture groups
+// such as $1 are expanded when the search is a regular expression
+func (e *editor) replaceMatch(replacement string, literal bool) {
+	i, ok := e.currentMatch()
+	if !ok {
+		e.findNext(false)
+		return
+	}
+
+	m := e.matches[i]
+	if !literal {
+		replacement = string(e.search.ExpandString(nil, replacement, e.Text(), m.submatches))
+	}
+
+	e.anchor, e.cursor = m.start, m.end
+	e.insert(replacement)
+	e.findNext(false)
+}
+
+// Replaces every match as a single edit
+func (e *editor) replaceAll(replacement string, literal bool) {
+	if e.search == nil || len(e.matches) == 0 {
+		return
+	}
+
+	text := e.Text()
+	if literal {
+		e.replaceText(e.search.ReplaceAllLiteralString(text, replacement))
+	} else {
+		e.replaceText(e.search.ReplaceAllString(text, replacement))
+	}
+}
+
+// An entry that hands Return, Shift+Return and Escape over to the find bar
+type findEntry struct {
+	shift		bool
+	onKey		func(key *fyne.KeyEvent, shift bool) bool
+	onShortcut	func(shortcut fyne.Shortcut)
+	widget.Entry
+}
+
+func newFindEntry(placeHolder string) *findEntry {
+	entry := &findEntry{}
+	entry.PlaceHolder = placeHolder
+	entry.ExtendBaseWidget(entry)
+	return entry
+}
+
+func (f *findEntry) KeyDown(key *fyne.KeyEvent) {
+	if key.Name == desktop.KeyShiftLeft || key.Name == desktop.KeyShiftRight {
+		f.shift = true
+	}
+	f.Entry.KeyDown(key)
+}
+
+func (f *findEntry) KeyUp(key *fyne.KeyEvent) {
+	if key.Name == desktop.KeyShiftLeft || key.Name == desktop.KeyShiftRight {
+		f.shift = false
+	}
+	f.Entry.KeyUp(key)
+}
+
+func (f *findEntry) TypedKey(key *fyne.KeyEvent) {
+	if f.onKey != nil && f.onKey(key, f.shift) {
+		return
+	}
+
+	f.Entry.TypedKey(key)
+}
+
+// Shortcuts that are not about editing the entry act on the selected tab
+func (f *findEntry) TypedShortcut(shortcut fyne.Shortcut) {
+	_, ok := shortcut.(*desktop.CustomShortcut)
+	if ok && f.onShortcut != nil {
+		f.onShortcut(shortcut)
+		return
+	}
+
+	f.Entry.TypedShortcut(shortcut)
+}
+
+// Searches the code of a tab as the query is typed
+type findBar struct {
+	editor		*editor
+	window		fyne.Window
+	query		*findEntry
+	replacement	*findEntry
+	matchCase	*widget.Check
+	wholeWord	*widget.Check
+	regex		*widget.Check
+	count		*widget.Label
+	replaceRow	*fyne.Container
+	*fyne.Container
+}
+
+func newFindBar(e *editor, window fyne.Window, onShortcut func(shortcut fyne.Shortcut)) *findBar {
+	f := &findBar{
+		editor: e,
+		window: window,
+		query: newFindEntry("Find"),
+		replacement: newFindEntry("Replace"),
+		count: widget.NewLabel(""),
+	}
+
+	update := func(bool) {
+		f.update()
+	}
+	f.matchCase = widget.NewCheck("Case", update)
+	f.wholeWord = widget.NewCheck("Word", update)
+	f.regex = widget.NewCheck("Regex", update)
+	f.query.OnChanged = func(string) {
+		f.update()
+	}
+
+	onKey := func(key *fyne.KeyEvent, shift bool) bool {
+		switch key.Name {
+		case fyne.KeyReturn, fyne.KeyEnter:
+			f.editor.findNext(shift)
+		case fyne.KeyEscape:
+			f.close()
+		default:
+			return false
+		}
+
+		return true
+	}
+	f.query.onKey = onKey
+	f.query.onShortcut = onShortcut
+	f.replacement.onKey = func(key *fyne.KeyEvent, shift bool) bool {
+		if key.Name == fyne.KeyReturn || key.Name == fyne.KeyEnter {
+			f.editor.replaceMatch(f.replacement.Text, !f.regex.Checked)
+			return true
+		}
+
+		return onKey(key, shift)
+	}
+	f.replacement.onShortcut = onShortcut
+
+	f.replaceRow = container.NewBorder(nil, nil, nil,
+		container.NewHBox(
+			widget.NewButton("Replace", func() {
+				f.editor.replaceMatch(f.replacement.Text, !f.regex.Checked)
+			}),
+			widget.NewButton("Replace all", func() {
+				f.editor.replaceAll(f.replacement.Text, !f.regex.Checked)
+			}),
+		),
+		f.replacement,
+	)
+
+	f.Container = container.NewVBox(
+		container.NewBorder(nil, nil, nil,
+			container.NewHBox(
+				f.count,
+				f.matchCase,
+				f.wholeWord,
+				f.regex,
+				widget.NewButtonWithIcon("", theme.MoveUpIcon(), func() {
+					f.editor.findNext(true)
+				}),
+				widget.NewButtonWithIcon("", theme.MoveDownIcon(), func() {
+					f.editor.findNext(false)
+				}),
+				widget.NewButtonWithIcon("", theme.CancelIcon(), f.close),
+			),
+			f.query,
+		),
+		f.replaceRow,
+	)
+	f.Container.Hide()
+
+	return f
+}
+
+// Shows the bar, searching for the selected text if it's a single line
+func (f *findBar) show(replace bool) {
+	selected := f.editor.selectedText()
+	if len(selected) > 0 && utf8.RuneCountInString(selected) < 200 && !strings.Contains(selected, "\n") {
+		if f.regex.Checked {
+			selected = regexp.QuoteMeta(selected)
+		}
+		f.query.SetText(selected)
+	}
+
+	if replace {
+		f.replaceRow.Show()
+	} else {
+		f.replaceRow.Hide()
+	}
+
+	f.Container.Show()
+	f.update()
+	f.window.Canvas().Focus(f.query)
+}
+
+func (f *findBar) close() {
+	f.Container.Hide()
+	f.editor.setSearch(nil)
+	f.editor.requestFocus()
+}
+
+// The search built from the query and the toggles
+func (f *findBar) search() (*regexp.Regexp, error) {
+	pattern := f.query.Text
+	if !f.regex.Checked {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if f.wholeWord.Checked {
+		pattern = `\b(?:` + pattern + `)\b`
+	}
+	if !f.matchCase.Checked {
+		pattern = `(?i)` + pattern
+	}
+
+	return regexp.Compile(pattern)
+}
+
+func (f *findBar) update() {
+	if !f.Container.Visible() {
+		return
+	}
+
+	if len(f.query.Text) == 0 {
+		f.editor.setSearch(nil)
+		f.updateCount()
+		return
+	}
+
+	search, err := f.search()
+	if err != nil {
+		f.editor.setSearch(nil)
+		f.count.SetText("Invalid regex")
+		return
+	}
+
+	f.editor.setSearch(search)
+	f.updateCount()
+}
+
+// How many matches there are, and which one is selected
+func (f *findBar) updateCount() {
+	e := f.editor
+	switch {
+	case !f.Container.Visible() || e.search == nil:
+		f.count.SetText("")
+	case len(e.matches) == 0:
+		f.count.SetText("No results")
+	default:
+		i, ok := e.currentMatch()
+		if ok {
+			f.count.SetText(fmt.Sprintf("%d of %d", i+1, len(e.matches)))
+		} else {
+			f.count.SetText(fmt.Sprintf("%d results", len(e.matches)))
+		}
+	}
+}
@@ -0,0 +1,279 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// Lines that can be folded away, the first one stays visible and the ones
+// after it up to end are hidden. The closing brace of a block is kept
+// visible, so folded code reads as "func main() { ⋯ }"
+type foldRange struct {
+	start	int
+	end		int
+	folded	bool
+}
+
+// Function bodies, composite literals and comment blocks spanning several
+// lines, in the order they start
+func foldRanges(fset *token.FileSet, file *ast.File) []foldRange {
+	ranges := make([]foldRange, 0)
+	add := func(start, end token.Pos, keepLast bool) {
+		if !start.IsValid() || !end.IsValid() {
+			return
+		}
+
+		first, last := fset.Position(start).Line-1, fset.Position(end).Line-1
+		if keepLast {
+			last--
+		}
+		if last > first {
+			ranges = append(ranges, foldRange{start: first, end: last})
+		}
+	}
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.FuncDecl:
+			if n.Body != nil {
+				add(n.Body.Lbrace, n.Body.Rbrace, true)
+			}
+		case *ast.FuncLit:
+			add(n.Body.Lbrace, n.Body.Rbrace, true)
+		case *ast.CompositeLit:
+			add(n.Lbrace, n.Rbrace, true)
+		}
+
+		return true
+	})
+
+	for _, group := range file.Comments {
+		add(group.Pos(), group.End(), false)
+	}
+
+	// Ranges starting on the same line, e.g. a literal returned by a
+	// function literal, are folded as the outermost one
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].start != ranges[j].start {
+			return ranges[i].start < ranges[j].start
+		}
+		return ranges[i].end > ranges[j].end
+	})
+
+	unique := ranges[:0]
+	for _, f := range ranges {
+		if len(unique) == 0 || unique[len(unique)-1].start != f.start {
+			unique = append(unique, f)
+		}
+	}
+
+	return unique
+}
+
+// Replaces the ranges that can be folded, keeping folded the ones that
+// still start on a line that was folded
+func (e *editor) setFolds(folds []foldRange) {
+	folded := make(map[int]bool)
+	for _, f := range e.folds {
+		if f.folded {
+			folded[f.start] = true
+		}
+	}
+
+	for i := range folds {
+		folds[i].folded = folded[folds[i].start] && folds[i].end < e.buf.lineCount()
+	}
+
+	e.folds = folds
+	e.keepVisible()
+	e.Refresh()
+}
+
+// Keeps folds on the lines they span after the lines between start and end
+// are replaced by the ones up to newEnd. Editing hidden lines unfolds them
+func (e *editor) shiftFolds(start, end, newEnd textPos) {
+	offset := newEnd.row - end.row
+	folds := e.folds[:0]
+	for _, f := range e.folds {
+		switch {
+		case f.end < start.row:
+		case f.start > end.row:
+			f.start += offset
+			f.end += offset
+		case end.row == f.start && newEnd.col < len(e.buf.line(newEnd.row)):
+			// What is left of the first line, e.g. its opening brace, still
+			// leads into the folded lines
+			f.start = newEnd.row
+			f.end += offset
+		case f.start <= start.row && end.row <= f.end:
+			if end.row > f.start || newEnd.row > f.start {
+				f.folded = false
+			}
+			f.end += offset
+		default:
+			continue
+		}
+
+		if f.end > f.start {
+			folds = append(folds, f)
+		}
+	}
+
+	e.folds = folds
+}
+
+// Whether the line is hidden inside a folded range
+func (e *editor) hiddenRow(row int) bool {
+	for _, f := range e.folds {
+		if f.folded && row > f.start && row <= f.end {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The range starting at the given line, if any
+func (e *editor) foldAt(row int) (*foldRange, bool) {
+	for i := range e.folds {
+		if e.folds[i].start == row {
+			return &e.folds[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// Moves the given number of visible lines down, or up when negative,
+// reporting whether it could before reaching either end of the code
+func (e *editor) stepRows(row, rows int) (int, bool) {
+	for ; rows > 0; rows-- {
+		next := row + 1
+		for next < e.buf.lineCount() && e.hiddenRow(next) {
+			next++
+		}
+		if next >= e.buf.lineCount() {
+			return row, false
+		}
+		row = next
+	}
+
+	for ; rows < 0; rows++ {
+		prev := row - 1
+		for prev > 0 && e.hiddenRow(prev) {
+			prev--
+		}
+		if prev < 0 {
+			return row, false
+		}
+		row = prev
+	}
+
+	return row, true
+}
+
+// The lines drawn from the first visible one, skipping the folded ones
+func (e *editor) displayedRows() []int {
+	count := e.visibleRows()
+	rows := make([]int, 0, count)
+	for row := min(e.top, e.buf.lineCount()-1); row < e.buf.lineCount() && len(rows) < count; row++ {
+		if !e.hiddenRow(row) {
+			rows = append(rows, row)
+		}
+	}
+
+	return rows
+}
+
+// The last line that is not hidden
+func (e *editor) lastVisibleRow() int {
+	row := e.buf.lineCount() - 1
+	for row > 0 && e.hiddenRow(row) {
+		row--
+	}
+
+	return row
+}
+
+// Unfolds whatever hides the given line, e.g. when the cursor moves into it
+func (e *editor) revealRow(row int) {
+	for i := range e.folds {
+		f := &e.folds[i]
+		if f.folded && row > f.start && row <= f.end {
+			f.folded = false
+		}
+	}
+}
+
+// Neither the first visible line nor the cursor can be hidden, folding the
+// lines they are on moves them to the line the fold starts at
+func (e *editor) keepVisible() {
+	for e.top > 0 && e.hiddenRow(e.top) {
+		e.top--
+	}
+
+	if e.hiddenRow(e.cursor.row) {
+		row := e.cursor.row
+		for row > 0 && e.hiddenRow(row) {
+			row--
+		}
+		e.cursor = textPos{row: row, col: len(e.buf.line(row))}
+		e.anchor = e.cursor
+		e.cursorChanged()
+	} else if e.hiddenRow(e.anchor.row) {
+		e.anchor = e.cursor
+		e.cursorChanged()
+	}
+}
+
+func (e *editor) toggleFold(row int) {
+	f, ok := e.foldAt(row)
+	if !ok {
+		return
+	}
+
+	f.folded = !f.folded
+	e.keepVisible()
+	e.Refresh()
+}
+
+// Folds the innermost range the cursor is in
+func (e *editor) fold() {
+	row := e.cursor.row
+	var innermost *foldRange
+	for i := range e.folds {
+		f := &e.folds[i]
+		if !f.folded && row >= f.start && row <= f.end+1 && (innermost == nil || f.start > innermost.start) {
+			innermost = f
+		}
+	}
+
+	if innermost != nil {
+		innermost.folded = true
+		e.keepVisible()
+		e.Refresh()
+	}
+}
+
+// Unfolds the range starting at the cursor's line
+func (e *editor) unfold() {
+	f, ok := e.foldAt(e.cursor.row)
+	if ok && f.folded {
+		f.folded = false
+		e.Refresh()
+	}
+}
+
+func (e *editor) foldAll(folded bool) {
+	for i := range e.folds {
+		e.folds[i].folded = folded
+	}
+
+	e.keepVisible()
+	e.Refresh()
+}
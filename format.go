@@ -0,0 +1,131 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"errors"
+	"go/format"
+	"go/scanner"
+	"strings"
+	"unicode"
+)
+
+// Formats the code with go/format. Code with syntax errors is left as is and
+// the errors are shown as markers instead. Returns whether it was formatted
+func (e *editor) format() bool {
+	src := e.Text()
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		e.setMarkers("format", syntaxMarkers(err))
+		return false
+	}
+
+	e.setMarkers("format", nil)
+	e.replaceText(string(formatted))
+	return true
+}
+
+// Markers for the errors found while parsing the code
+func syntaxMarkers(err error) []marker {
+	var list scanner.ErrorList
+	if !errors.As(err, &list) {
+		return []marker{{row: 0, kind: markerError, message: err.Error()}}
+	}
+
+	markers := make([]marker, 0, len(list))
+	for _, e := range list {
+		markers = append(markers, marker{row: max(e.Pos.Line-1, 0), kind: markerError, message: e.Msg})
+	}
+
+	return markers
+}
+
+// Replaces the whole code as a single edit that only touches the lines that
+// changed. The cursor and selection stay next to the same characters, as
+// whitespace is what changes the most when code is rewritten
+func (e *editor) replaceText(text string) {
+	if text == e.Text() {
+		return
+	}
+
+	anchor := significantRunes(e.buf.lines, e.anchor)
+	cursor := significantRunes(e.buf.lines, e.cursor)
+
+	oldLines := e.buf.lines
+	newLines := strings.Split(text, "\n")
+
+	suffix := 0
+	for suffix < len(oldLines) && suffix < len(newLines) && string(oldLines[len(oldLines)-1-suffix]) == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	prefix := 0
+	for prefix < min(len(oldLines), len(newLines))-suffix && string(oldLines[prefix]) == newLines[prefix] {
+		prefix++
+	}
+
+	changed := newLines[prefix : len(newLines)-suffix]
+	switch {
+	case suffix > 0:
+		// Every changed line is followed by a line break, even the last one
+		replacement := ""
+		for _, line := range changed {
+			replacement += line + "\n"
+		}
+		e.replace(textPos{row: prefix}, textPos{row: len(oldLines) - suffix}, replacement)
+	case len(changed) > 0:
+		e.replace(textPos{row: prefix}, e.buf.end(), strings.Join(changed, "\n"))
+	default:
+		// The lines after the common ones were removed, along with the line
+		// break leading to them
+		e.replace(textPos{row: prefix - 1, col: len(oldLines[prefix-1])}, e.buf.end(), "")
+	}
+
+	e.anchor = posAfterSignificantRunes(e.buf.lines, anchor)
+	e.cursor = posAfterSignificantRunes(e.buf.lines, cursor)
+	e.changed()
+}
+
+// How many non whitespace runes there are before the given position
+func significantRunes(lines [][]rune, pos textPos) int {
+	count := 0
+	for row := 0; row <= pos.row && row < len(lines); row++ {
+		line := lines[row]
+		if row == pos.row {
+			line = line[:min(pos.col, len(line))]
+		}
+
+		for _, r := range line {
+			if !unicode.IsSpace(r) {
+				count++
+			}
+		}
+	}
+
+	return count
+}
+
+// The position right after the given number of non whitespace runes
+func posAfterSignificantRunes(lines [][]rune, count int) textPos {
+	if count == 0 {
+		return textPos{}
+	}
+
+	for row, line := range lines {
+		for col, r := range line {
+			if unicode.IsSpace(r) {
+				continue
+			}
+
+			count--
+			if count == 0 {
+				return textPos{row: row, col: col + 1}
+			}
+		}
+	}
+
+	last := len(lines) - 1
+	return textPos{row: last, col: len(lines[last])}
+}
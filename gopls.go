@@ -0,0 +1,156 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/semver"
+)
+
+var (
+	// Installing gopls for a Go version is only attempted by one tab at a
+	// time, and only once if it fails until the app is restarted
+	goplsInstallMu		sync.Mutex
+	goplsInstallErrs	= make(map[string]error)
+
+	// The newest gopls that builds with each Go version, newest first. The
+	// latest gopls often needs a newer Go than the one being installed for
+	goplsVersions = []struct {
+		goVersion	string
+		gopls		string
+	}{
+		{"go1.25", "v0.21.1"},
+		{"go1.24.2", "v0.20.0"},
+		{"go1.23.4", "v0.18.1"},
+		{"go1.21", "v0.16.2"},
+		{"go1.20", "v0.15.3"},
+		{"go1.18", "v0.14.2"},
+		{"go1.17", "v0.11.0"},
+		{"go1.15", "v0.9.5"},
+		{"go1.12", "v0.7.5"},
+	}
+)
+
+// gopls is installed with and for each Go version, as it only supports
+// the Go versions it was built with
+func goplsBinPath(version string) string {
+	gopls := filepath.Join(os.Getenv("RUNGO_CACHE_DIR"), GOPLS_DIR, longGoVersion(version), "gopls")
+	if runtime.GOOS == "windows" {
+		return gopls + ".exe"
+	}
+
+	return gopls
+}
+
+// The gopls package pinned for a Go version, e.g. "go1.21.5" gets
+// "golang.org/x/tools/gopls@v0.16.2"
+func goplsPackage(version string) (string, error) {
+	for _, v := range goplsVersions {
+		if semver.Compare(goSemver(version), goSemver(v.goVersion)) >= 0 {
+			return GOPLS_MODULE + "@" + v.gopls, nil
+		}
+	}
+
+	return "", fmt.Errorf("gopls does not support %s", version)
+}
+
+// Go versions as semantic versions, e.g. "go1.21rc2" is "v1.21.0-rc2"
+func goSemver(version string) string {
+	v := strings.Replace(version, "go", "v", 1)
+	i := strings.IndexAny(v, "rb")
+	if i < 0 {
+		return v
+	}
+
+	release := v[:i]
+	if strings.Count(release, ".") == 1 {
+		release += ".0"
+	}
+	return release + "-" + v[i:]
+}
+
+func installGopls(version string) error {
+	goplsInstallMu.Lock()
+	defer goplsInstallMu.Unlock()
+
+	_, err := os.Stat(goplsBinPath(version))
+	if err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	err, failed := goplsInstallErrs[version]
+	if failed {
+		return err
+	}
+
+	err = installGoplsPackage(version)
+	if err != nil {
+		goplsInstallErrs[version] = err
+	}
+
+	return err
+}
+
+func installGoplsPackage(version string) error {
+	pkg, err := goplsPackage(version)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(goBinPath(version), "install", pkg)
+	cmd.Env = append(os.Environ(), "GOBIN="+filepath.Dir(goplsBinPath(version)), "GOTOOLCHAIN=local")
+	hideWindow(cmd)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return &commandError{args: []string{"go", "install", pkg}, output: string(output), err: err}
+	}
+
+	return nil
+}
+
+// Runs gopls in the given directory, with the go command of the Go version
+// first in the PATH so packages are loaded with it
+func goplsCommand(version, dir string) *exec.Cmd {
+	goBinDir := filepath.Dir(goBinPath(version))
+
+	cmd := exec.Command(goplsBinPath(version), "serve")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "PATH="+goBinDir+string(os.PathListSeparator)+os.Getenv("PATH"), "GOTOOLCHAIN=local")
+	hideWindow(cmd)
+	return cmd
+}
+
+// gopls needs a module to analyze code, scratch code gets one of its own in
+// a temporary directory that is removed along with the tab
+func newScratchWorkspace() (string, error) {
+	root := filepath.Join(os.Getenv("RUNGO_CACHE_DIR"), SCRATCH_DIR)
+	err := os.MkdirAll(root, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	return os.MkdirTemp(root, "tab-")
+}
+
+// Writes the go.mod of a scratch workspace, targeting the given Go version
+// so the language features it allows are not flagged
+func writeScratchModule(dir, version string) error {
+	goMod := "module scratch\n"
+	majorMinor := semver.MajorMinor(strings.Replace(version, "go", "v", 1))
+	if len(majorMinor) > 0 {
+		goMod += fmt.Sprintf("\ngo %s\n", strings.TrimPrefix(majorMinor, "v"))
+	}
+
+	return os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0644)
+}
@@ -0,0 +1,36 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import "testing"
+
+func TestGoplsPackage(t *testing.T) {
+	tests := []struct {
+		name	string
+		version	string
+		want	string
+		wantErr	bool
+	}{
+		{name: "latest", version: "go1.26.1", want: "golang.org/x/tools/gopls@v0.21.1"},
+		{name: "first of its minor", version: "go1.25", want: "golang.org/x/tools/gopls@v0.21.1"},
+		{name: "before the patch it needs", version: "go1.24.1", want: "golang.org/x/tools/gopls@v0.18.1"},
+		{name: "after the patch it needs", version: "go1.24.2", want: "golang.org/x/tools/gopls@v0.20.0"},
+		{name: "release candidate", version: "go1.21rc2", want: "golang.org/x/tools/gopls@v0.15.3"},
+		{name: "between pinned versions", version: "go1.19.13", want: "golang.org/x/tools/gopls@v0.14.2"},
+		{name: "too old", version: "go1.11.13", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := goplsPackage(test.version)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+func longGoVersion(version string) string {
+	return fmt.Sprintf("%s.%s-%s", version, runtime.GOOS, runtime.GOARCH)
+}
+
+func goBinPath(version string) string {
+	goBin := filepath.Join(os.Getenv("RUNGO_CACHE_DIR"), GOS_DIR, longGoVersion(version), "bin", "go")
+	if runtime.GOOS == "windows" {
+		return goBin + ".exe"
+	}
+
+	return goBin
+}
+
+// Downloads and uncompresses the given Go version unless it's already
+// installed, a failed download doesn't leave any leftovers behind
+func installGoVersion(version string) error {
+	cacheDir := os.Getenv("RUNGO_CACHE_DIR")
+	longVersion := longGoVersion(version)
+
+	_, err := os.Stat(filepath.Join(cacheDir, GOS_DIR, longVersion))
+	if err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	file := fmt.Sprintf("%s.%s", longVersion, "tar.gz")
+	uncompress := uncompressTarFile
+	if runtime.GOOS == "windows" {
+		file = fmt.Sprintf("%s.%s", longVersion, "zip")
+		uncompress = uncompressZipFile
+	}
+
+	err = getGoSource(file, cacheDir)
+	if err != nil {
+		os.Remove(filepath.Join(cacheDir, file))
+		return err
+	}
+
+	err = uncompress(filepath.Join(cacheDir, file), filepath.Join(cacheDir, GOS_DIR))
+	if err != nil {
+		os.Remove(filepath.Join(cacheDir, file))
+		os.RemoveAll(filepath.Join(cacheDir, GOS_DIR, "go"))
+		return err
+	}
+
+	return os.Rename(filepath.Join(cacheDir, GOS_DIR, "go"), filepath.Join(cacheDir, GOS_DIR, longVersion))
+}
+
+// Returns the most recent Go version available offline, used as a fallback
+// when go.dev can't be reached
+func latestInstalledGoVersion() (string, error) {
+	entries, err := os.ReadDir(filepath.Join(os.Getenv("RUNGO_CACHE_DIR"), GOS_DIR))
+	if err != nil {
+		return "", err
+	}
+
+	suffix := fmt.Sprintf(".%s-%s", runtime.GOOS, runtime.GOARCH)
+	latest := ""
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasSuffix(entry.Name(), suffix) {
+			continue
+		}
+
+		version := strings.TrimSuffix(entry.Name(), suffix)
+		if len(latest) == 0 || semver.Compare(strings.Replace(version, "go", "v", 1), strings.Replace(latest, "go", "v", 1)) > 0 {
+			latest = version
+		}
+	}
+
+	if len(latest) == 0 {
+		return "", errNoGoVersion
+	}
+
+	return latest, nil
+}
+
+// Makes the given, already installed, Go version the one used to run code
+func useGoVersion(version string) error {
+	goVerErr := os.Setenv("RUNGO_GO_VER", version)
+	goBinErr := os.Setenv("RUNGO_GO_BIN", goBinPath(version))
+	return errors.Join(goVerErr, goBinErr)
+}
+
+func isGoVersionInstalled(version string) bool {
+	_, err := os.Stat(filepath.Join(os.Getenv("RUNGO_CACHE_DIR"), GOS_DIR, longGoVersion(version)))
+	return err == nil
+}
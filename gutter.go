@@ -0,0 +1,176 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"image/color"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"fyne.io/fyne/v2/theme"
+)
+
+type markerKind int
+
+const (
+	markerInfo markerKind = iota
+	markerWarning
+	markerError
+)
+
+// Annotates a line in the gutter, such as a compile error or a test result.
+// The columns between col and endCol, if any, are underlined
+type marker struct {
+	row		int
+	col		int
+	endCol	int
+	kind	markerKind
+	message	string
+}
+
+// Errors printed by the go command, e.g. "./main.go:12:5: undefined: x"
+var compileErrorRe = regexp.MustCompile(`(?m)^(vet: )?(?:.*[/\\])?[^/\\\s]+\.go:(\d+)(?::(\d+))?: (.+)$`)
+
+func (k markerKind) color() color.Color {
+	switch k {
+	case markerError:
+		return theme.ErrorColor()
+	case markerWarning:
+		return theme.WarningColor()
+	}
+
+	return theme.PrimaryColor()
+}
+
+// Replaces the markers set by the given source, each feature annotating
+// lines uses its own so they don't clear each other's markers. Safe to call
+// from any goroutine, the editor is refreshed on the UI one
+func (e *editor) setMarkers(source string, markers []marker) {
+	e.markersMu.Lock()
+	if e.markers == nil {
+		e.markers = make(map[string][]marker)
+	}
+	e.markers[source] = append([]marker{}, markers...)
+	e.markersMu.Unlock()
+
+	runOnUI(func() {
+		e.Refresh()
+		e.cursorChanged()
+
+		if e.onProblems != nil {
+			e.onProblems()
+		}
+	})
+}
+
+// Markers of a line, the most severe first
+func (e *editor) markersAt(row int) []marker {
+	e.markersMu.Lock()
+	defer e.markersMu.Unlock()
+
+	markers := make([]marker, 0)
+	for _, sourceMarkers := range e.markers {
+		for _, m := range sourceMarkers {
+			if m.row == row {
+				markers = append(markers, m)
+			}
+		}
+	}
+
+	sort.SliceStable(markers, func(i, j int) bool {
+		return markers[i].kind > markers[j].kind
+	})
+
+	return markers
+}
+
+// Keeps markers on the lines they annotate after the lines between start and
+// end are replaced by the ones up to newEnd
+func (e *editor) shiftMarkers(start, end, newEnd textPos) {
+	e.markersMu.Lock()
+	defer e.markersMu.Unlock()
+
+	offset := newEnd.row - end.row
+	for _, markers := range e.markers {
+		for i := range markers {
+			switch {
+			case markers[i].row > end.row:
+				markers[i].row += offset
+			case markers[i].row == end.row && markers[i].col >= end.col:
+				// The text after the edit moves along with its underline
+				markers[i].row = newEnd.row
+				markers[i].col += newEnd.col - end.col
+				markers[i].endCol += newEnd.col - end.col
+			case markers[i].row > start.row:
+				markers[i].row = min(markers[i].row, newEnd.row)
+			}
+		}
+	}
+}
+
+func (e *editor) gutterDigits() int {
+	return max(3, len(strconv.Itoa(e.buf.lineCount())))
+}
+
+// Room for the line numbers, a marker to their left and whether the lines
+// that follow are folded to their right
+func (e *editor) gutterWidth() float32 {
+	charWidth, _ := e.metrics()
+	return float32(e.gutterDigits()+3) * charWidth
+}
+
+// Where the fold toggles start, right after the line numbers
+func (e *editor) foldToggleX() float32 {
+	charWidth, _ := e.metrics()
+	return theme.Padding() + float32(e.gutterDigits()+1)*charWidth
+}
+
+// Markers for the errors the go command printed while building the given
+// code, and for what go vet reports as warnings unless it couldn't build it
+func compileMarkers(output, code string, kind markerKind) []marker {
+	lines := strings.Split(code, "\n")
+	markers := make([]marker, 0)
+	for _, match := range compileErrorRe.FindAllStringSubmatch(output, -1) {
+		line, err := strconv.Atoi(match[2])
+		if err != nil || line < 1 {
+			continue
+		}
+
+		m := marker{row: line - 1, kind: kind, message: match[4]}
+		if len(match[1]) > 0 {
+			m.kind = markerError
+		}
+
+		// Columns are counted in bytes from 1
+		column, err := strconv.Atoi(match[3])
+		if err == nil && column > 0 && line <= len(lines) {
+			text := lines[line-1]
+			m.col, m.endCol = wordCols([]rune(text), utf8.RuneCountInString(text[:min(column-1, len(text))]))
+		}
+		markers = append(markers, m)
+	}
+
+	return markers
+}
+
+// The columns of the word starting at col, or of the single character there
+// when it's not part of a word
+func wordCols(line []rune, col int) (int, int) {
+	if col >= len(line) {
+		return max(len(line)-1, 0), len(line)
+	}
+
+	end := col + 1
+	if isWordRune(line[col]) {
+		for end < len(line) && isWordRune(line[end]) {
+			end++
+		}
+	}
+
+	return col, end
+}
@@ -0,0 +1,88 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestShiftMarkers(t *testing.T) {
+	tests := []struct {
+		name	string
+		text	string
+		marker	marker
+		start	textPos
+		end		textPos
+		insert	string
+		want	marker
+	}{
+		{name: "line added above", text: "a\nb", marker: marker{row: 1}, start: textPos{0, 0}, end: textPos{0, 0}, insert: "x\n", want: marker{row: 2}},
+		{name: "line removed above", text: "a\nb\nc", marker: marker{row: 2}, start: textPos{0, 1}, end: textPos{1, 1}, insert: "", want: marker{row: 1}},
+		{name: "edit below", text: "a\nb", marker: marker{row: 0}, start: textPos{1, 0}, end: textPos{1, 0}, insert: "x\n", want: marker{row: 0}},
+		{name: "text before the underline", text: "x := y", marker: marker{row: 0, col: 5, endCol: 6}, start: textPos{0, 0}, end: textPos{0, 0}, insert: "var ", want: marker{row: 0, col: 9, endCol: 10}},
+		{name: "underline moved to a new line", text: "a b", marker: marker{row: 0, col: 2, endCol: 3}, start: textPos{0, 1}, end: textPos{0, 2}, insert: "\n", want: marker{row: 1, col: 0, endCol: 1}},
+		{name: "annotated line removed", text: "a\nb\nc", marker: marker{row: 1}, start: textPos{0, 1}, end: textPos{2, 0}, insert: "", want: marker{row: 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := playgroundEditor(playgroundConsole(), nil, newErrorBanner())
+			e.SetText(test.text)
+			e.setMarkers("test", []marker{test.marker})
+			e.replace(test.start, test.end, test.insert)
+
+			got := e.markers["test"]
+			if len(got) != 1 || got[0] != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+// Markers are set from background work while the UI edits the code and
+// draws them, run with -race
+func TestSetMarkersConcurrently(t *testing.T) {
+	queue := queueUI(t)
+	e := playgroundEditor(playgroundConsole(), nil, newErrorBanner())
+	e.SetText("package main\n\nfunc main() {\n}\n")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(source string) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				e.setMarkers(source, []marker{{row: j % 4, kind: markerError, message: source}})
+			}
+		}(fmt.Sprint("source", i))
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for finished := false; !finished; {
+		select {
+		case fn := <-queue:
+			fn()
+		case <-done:
+			finished = true
+		default:
+			e.insert("x")
+			e.markersAt(1)
+			e.problems()
+		}
+	}
+	for len(queue) > 0 {
+		(<-queue)()
+	}
+
+	if got := len(e.problems()); got != 4 {
+		t.Errorf("got %d problems, want one per source", got)
+	}
+}
@@ -0,0 +1,249 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"go/scanner"
+	"go/token"
+	"image/color"
+	"strings"
+	"unicode/utf8"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+)
+
+type tokenClass int
+
+const (
+	classPlain tokenClass = iota
+	classKeyword
+	classIdentifier
+	classBuiltin
+	classString
+	classRune
+	classNumber
+	classComment
+)
+
+// Tokens that span several lines leave the next one in the middle of them
+type scanState int
+
+const (
+	stateUnknown scanState = iota - 1
+	stateCode
+	stateComment
+	stateRawString
+)
+
+// A run of runes in a line sharing the same class
+type span struct {
+	start	int
+	end		int
+	class	tokenClass
+}
+
+var builtins = map[string]bool{
+	"any": true, "bool": true, "byte": true, "comparable": true, "complex64": true, "complex128": true,
+	"error": true, "float32": true, "float64": true, "int": true, "int8": true, "int16": true,
+	"int32": true, "int64": true, "rune": true, "string": true, "uint": true, "uint8": true,
+	"uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"true": true, "false": true, "iota": true, "nil": true,
+	"append": true, "cap": true, "clear": true, "close": true, "complex": true, "copy": true,
+	"delete": true, "imag": true, "len": true, "make": true, "max": true, "min": true, "new": true,
+	"panic": true, "print": true, "println": true, "real": true, "recover": true,
+}
+
+// Light and dark variants of the color of each class
+var syntaxColors = map[tokenClass][2]color.Color{
+	classKeyword: {color.NRGBA{R: 0xaf, G: 0x00, B: 0xdb, A: 0xff}, color.NRGBA{R: 0xc5, G: 0x86, B: 0xc0, A: 0xff}},
+	classBuiltin: {color.NRGBA{R: 0x26, G: 0x7f, B: 0x99, A: 0xff}, color.NRGBA{R: 0x4e, G: 0xc9, B: 0xb0, A: 0xff}},
+	classString: {color.NRGBA{R: 0xa3, G: 0x15, B: 0x15, A: 0xff}, color.NRGBA{R: 0xce, G: 0x91, B: 0x78, A: 0xff}},
+	classRune: {color.NRGBA{R: 0x81, G: 0x1f, B: 0x3f, A: 0xff}, color.NRGBA{R: 0xd7, G: 0xba, B: 0x7d, A: 0xff}},
+	classNumber: {color.NRGBA{R: 0x09, G: 0x86, B: 0x58, A: 0xff}, color.NRGBA{R: 0xb5, G: 0xce, B: 0xa8, A: 0xff}},
+	classComment: {color.NRGBA{R: 0x00, G: 0x80, B: 0x00, A: 0xff}, color.NRGBA{R: 0x6a, G: 0x99, B: 0x55, A: 0xff}},
+}
+
+// Keeps the tokens of every line, lines are only tokenized again when they
+// are edited or when the line above ends in a different state than before
+type highlighter struct {
+	spans	[][]span
+	states	[]scanState
+	stale	[]bool
+	dirty	int
+}
+
+func newHighlighter(lines int) *highlighter {
+	h := &highlighter{}
+	h.reset(lines)
+	return h
+}
+
+func (h *highlighter) reset(lines int) {
+	h.spans = make([][]span, lines)
+	h.states = make([]scanState, lines)
+	h.stale = make([]bool, lines)
+	for i := range h.stale {
+		h.states[i] = stateUnknown
+		h.stale[i] = true
+	}
+	h.dirty = 0
+}
+
+// Accounts for the lines between row and row+removed being replaced by
+// inserted lines, all of them need to be tokenized again
+func (h *highlighter) edited(row, removed, inserted int) {
+	spans := make([][]span, inserted)
+	states := make([]scanState, inserted)
+	stale := make([]bool, inserted)
+	for i := range stale {
+		states[i] = stateUnknown
+		stale[i] = true
+	}
+
+	h.spans = append(h.spans[:row], append(spans, h.spans[row+removed:]...)...)
+	h.states = append(h.states[:row], append(states, h.states[row+removed:]...)...)
+	h.stale = append(h.stale[:row], append(stale, h.stale[row+removed:]...)...)
+	h.dirty = min(h.dirty, row)
+}
+
+// Tokenizes the stale lines up to the given row, the ones below are left
+// for when they become visible
+func (h *highlighter) update(lines [][]rune, upto int) {
+	carry := false
+	for row := h.dirty; row < len(lines); row++ {
+		if !h.stale[row] && !carry {
+			continue
+		}
+
+		if row > upto {
+			h.stale[row] = true
+			h.dirty = row
+			return
+		}
+
+		state := stateCode
+		if row > 0 {
+			state = h.states[row-1]
+		}
+
+		previous := h.states[row]
+		h.spans[row], h.states[row] = tokenizeLine(lines[row], state)
+		h.stale[row] = false
+		carry = h.states[row] != previous
+	}
+
+	h.dirty = len(lines)
+}
+
+func (h *highlighter) line(row int) []span {
+	if row < 0 || row >= len(h.spans) {
+		return nil
+	}
+
+	return h.spans[row]
+}
+
+// Tokenizes a single line with go/scanner, finishing first whatever comment
+// or raw string the previous line left open
+func tokenizeLine(line []rune, state scanState) ([]span, scanState) {
+	src := string(line)
+	spans := make([]span, 0)
+	offset := 0
+
+	closer := ""
+	class := classPlain
+	switch state {
+	case stateComment:
+		closer, class = "*/", classComment
+	case stateRawString:
+		closer, class = "`", classString
+	}
+
+	if len(closer) > 0 {
+		i := strings.Index(src, closer)
+		if i < 0 {
+			return append(spans, span{start: 0, end: len(line), class: class}), state
+		}
+
+		offset = i + len(closer)
+		spans = append(spans, span{start: 0, end: utf8.RuneCountInString(src[:offset]), class: class})
+	}
+
+	rest := []byte(src[offset:])
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(rest))
+
+	var s scanner.Scanner
+	s.Init(file, rest, func(token.Position, string) {}, scanner.ScanComments)
+
+	end := stateCode
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+
+		class := classify(tok, lit)
+		if class == classPlain {
+			continue
+		}
+
+		start := offset + file.Offset(pos)
+		if len(lit) == 0 {
+			lit = tok.String()
+		}
+
+		switch {
+		case tok == token.COMMENT && strings.HasPrefix(lit, "/*") && (len(lit) < 4 || !strings.HasSuffix(lit, "*/")):
+			end = stateComment
+		case tok == token.STRING && strings.HasPrefix(lit, "`") && (len(lit) < 2 || !strings.HasSuffix(lit, "`")):
+			end = stateRawString
+		}
+
+		startCol := utf8.RuneCountInString(src[:start])
+		endCol := startCol + utf8.RuneCountInString(src[start:min(start+len(lit), len(src))])
+		spans = append(spans, span{start: startCol, end: endCol, class: class})
+	}
+
+	return spans, end
+}
+
+func classify(tok token.Token, lit string) tokenClass {
+	switch {
+	case tok.IsKeyword():
+		return classKeyword
+	case tok == token.IDENT && builtins[lit]:
+		return classBuiltin
+	case tok == token.IDENT:
+		return classIdentifier
+	case tok == token.STRING:
+		return classString
+	case tok == token.CHAR:
+		return classRune
+	case tok == token.INT, tok == token.FLOAT, tok == token.IMAG:
+		return classNumber
+	case tok == token.COMMENT:
+		return classComment
+	}
+
+	return classPlain
+}
+
+// Colors follow the theme variant, identifiers and operators use the
+// regular text color
+func syntaxColor(class tokenClass) color.Color {
+	dark := fyne.CurrentApp().Settings().ThemeVariant() == theme.VariantDark
+	colors, ok := syntaxColors[class]
+	if !ok {
+		return theme.ForegroundColor()
+	}
+
+	if dark {
+		return colors[1]
+	}
+
+	return colors[0]
+}
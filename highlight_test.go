@@ -0,0 +1,100 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTokenizeLine(t *testing.T) {
+	tests := []struct {
+		name	string
+		lines	[]string
+		// The spans of the last line, and the state every line ends in
+		spans	[]span
+		states	[]scanState
+	}{
+		{
+			name: "keywords and identifiers",
+			lines: []string{"func main() {"},
+			spans: []span{{0, 4, classKeyword}, {5, 9, classIdentifier}},
+			states: []scanState{stateCode},
+		},
+		{
+			name: "builtins and numbers",
+			lines: []string{"n := len(s) + 0x1f"},
+			spans: []span{{0, 1, classIdentifier}, {5, 8, classBuiltin}, {9, 10, classIdentifier}, {14, 18, classNumber}},
+			states: []scanState{stateCode},
+		},
+		{
+			name: "columns count runes",
+			lines: []string{`s := "héllo" // ü`},
+			spans: []span{{0, 1, classIdentifier}, {5, 12, classString}, {13, 17, classComment}},
+			states: []scanState{stateCode},
+		},
+		{
+			name: "multi-line raw string",
+			lines: []string{"x := `a", "b", "c` + y"},
+			spans: []span{{0, 2, classString}, {5, 6, classIdentifier}},
+			states: []scanState{stateRawString, stateRawString, stateCode},
+		},
+		{
+			name: "raw string opened on a line of its own",
+			lines: []string{"`", "`"},
+			spans: []span{{0, 1, classString}},
+			states: []scanState{stateRawString, stateCode},
+		},
+		{
+			name: "multi-line comment",
+			lines: []string{"a /* one", "two", "three */ b"},
+			spans: []span{{0, 8, classComment}, {9, 10, classIdentifier}},
+			states: []scanState{stateComment, stateComment, stateCode},
+		},
+		{
+			name: "comment closed and opened again",
+			lines: []string{"/* a */ x /* b"},
+			spans: []span{{0, 7, classComment}, {8, 9, classIdentifier}, {10, 14, classComment}},
+			states: []scanState{stateComment},
+		},
+		{
+			name: "comment ending a raw string line",
+			lines: []string{"s := `a", "b` /* c", "*/"},
+			spans: []span{{0, 2, classComment}},
+			states: []scanState{stateRawString, stateComment, stateCode},
+		},
+		{
+			name: "openers inside line comments",
+			lines: []string{"// a /* b `c"},
+			spans: []span{{0, 12, classComment}},
+			states: []scanState{stateCode},
+		},
+		{
+			name: "backquote inside a string",
+			lines: []string{"s := \"`\""},
+			spans: []span{{0, 1, classIdentifier}, {5, 8, classString}},
+			states: []scanState{stateCode},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var spans []span
+			state := stateCode
+			states := make([]scanState, 0, len(test.lines))
+			for _, line := range test.lines {
+				spans, state = tokenizeLine([]rune(line), state)
+				states = append(states, state)
+			}
+
+			if !slices.Equal(spans, test.spans) {
+				t.Errorf("got spans %v, want %v", spans, test.spans)
+			}
+			if !slices.Equal(states, test.states) {
+				t.Errorf("got states %v, want %v", states, test.states)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+// A single replacement of the code, with what is needed to revert it
+type edit struct {
+	start	textPos
+	oldEnd	textPos
+	newEnd	textPos
+	oldText	string
+	newText	string
+}
+
+// The edits made by one action, such as a paste, a format or a run of
+// typed characters, which are undone and redone together
+type editGroup struct {
+	edits			[]edit
+	cursorBefore	textPos
+	anchorBefore	textPos
+	cursorAfter		textPos
+	anchorAfter		textPos
+	at				time.Time
+}
+
+// Undo and redo stacks of an editor, edits are recorded as they are made
+// and grouped once the action making them is done. Undoing and redoing
+// don't start a group, so the redo stack is only cleared by new edits
+type history struct {
+	undo	[]*editGroup
+	redo	[]*editGroup
+	pending	*editGroup
+	replay	bool
+	holding	bool
+}
+
+// Called for every edit, the first one of an action starts a new group
+func (e *editor) recordEdit(ed edit) {
+	h := &e.history
+	if h.replay {
+		return
+	}
+
+	if h.pending == nil {
+		h.pending = &editGroup{cursorBefore: e.cursor, anchorBefore: e.anchor}
+	}
+	h.pending.edits = append(h.pending.edits, ed)
+}
+
+// Closes the group of the action that just finished, runs of typed or
+// deleted characters are merged into a single group
+func (e *editor) closeEditGroup() {
+	h := &e.history
+	group := h.pending
+	if group == nil || h.holding {
+		return
+	}
+
+	h.pending = nil
+	h.redo = nil
+	group.cursorAfter, group.anchorAfter, group.at = e.cursor, e.anchor, time.Now()
+
+	if len(h.undo) > 0 && mergeable(h.undo[len(h.undo)-1], group) {
+		prev := h.undo[len(h.undo)-1]
+		prev.edits = append(prev.edits, group.edits...)
+		prev.cursorAfter, prev.anchorAfter, prev.at = group.cursorAfter, group.anchorAfter, group.at
+		return
+	}
+
+	h.undo = append(h.undo, group)
+	if len(h.undo) > HISTORY_LIMIT {
+		h.undo = h.undo[1:]
+	}
+}
+
+// Keeps the edits made until released in a single group, e.g. everything
+// typed between entering and leaving vim's insert mode
+func (e *editor) holdEditGroup() {
+	e.history.holding = true
+}
+
+func (e *editor) releaseEditGroup() {
+	e.history.holding = false
+	e.closeEditGroup()
+}
+
+// Whether the edit is a single character being typed or deleted
+func singleRune(ed edit) (typed, deleted bool) {
+	typed = len(ed.oldText) == 0 && utf8.RuneCountInString(ed.newText) == 1 && ed.newText != "\n"
+	deleted = len(ed.newText) == 0 && utf8.RuneCountInString(ed.oldText) == 1 && ed.oldText != "\n"
+	return typed, deleted
+}
+
+// Characters typed or deleted one after the other, without pausing for
+// too long, are undone at once
+func mergeable(prev, next *editGroup) bool {
+	if len(prev.edits) == 0 || len(next.edits) != 1 || time.Since(prev.at) > HISTORY_GROUP_DELAY {
+		return false
+	}
+
+	last, ed := prev.edits[len(prev.edits)-1], next.edits[0]
+	lastTyped, lastDeleted := singleRune(last)
+	typed, deleted := singleRune(ed)
+	switch {
+	case lastTyped && typed:
+		return ed.start == last.newEnd
+	case lastDeleted && deleted:
+		// Backspace deletes towards the start, Delete keeps the position
+		return ed.oldEnd == last.start || ed.start == last.start
+	}
+
+	return false
+}
+
+// Reverts the last group of edits, restoring the cursor and selection
+// from before it was made
+func (e *editor) undo() {
+	h := &e.history
+	e.releaseEditGroup()
+	if len(h.undo) == 0 {
+		return
+	}
+
+	group := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+
+	h.replay = true
+	for i := len(group.edits) - 1; i >= 0; i-- {
+		ed := group.edits[i]
+		e.replace(ed.start, ed.newEnd, ed.oldText)
+	}
+	h.replay = false
+
+	h.redo = append(h.redo, group)
+	e.anchor, e.cursor = e.buf.clamp(group.anchorBefore), e.buf.clamp(group.cursorBefore)
+	e.changed()
+}
+
+func (e *editor) redo() {
+	h := &e.history
+	e.releaseEditGroup()
+	if len(h.redo) == 0 {
+		return
+	}
+
+	group := h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+
+	h.replay = true
+	for _, ed := range group.edits {
+		e.replace(ed.start, ed.oldEnd, ed.newText)
+	}
+	h.replay = false
+
+	h.undo = append(h.undo, group)
+	e.anchor, e.cursor = e.buf.clamp(group.anchorAfter), e.buf.clamp(group.cursorAfter)
+	e.changed()
+}
+
+// Forgets every edit, e.g. after the code of a tab is first loaded
+func (e *editor) clearHistory() {
+	e.history = history{}
+}
@@ -0,0 +1,379 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Standard library packages of a Go version, by package name
+type stdIndex struct {
+	goroot		string
+	packages	map[string][]string
+	exports		map[string]map[string]bool
+}
+
+var (
+	stdIndexMu	sync.Mutex
+	stdIndexes	= make(map[string]*stdIndex)
+)
+
+// The root of the Go version used to run code, e.g. gos/go1.21.5.linux-amd64
+func goRoot() (string, error) {
+	goBin := os.Getenv("RUNGO_GO_BIN")
+	if len(goBin) == 0 {
+		return "", errNoGoVersion
+	}
+
+	return filepath.Dir(filepath.Dir(goBin)), nil
+}
+
+// Lists the packages in the GOROOT once, later calls reuse the list
+func loadStdIndex(goroot string) (*stdIndex, error) {
+	stdIndexMu.Lock()
+	defer stdIndexMu.Unlock()
+
+	index, ok := stdIndexes[goroot]
+	if ok {
+		return index, nil
+	}
+
+	index = &stdIndex{goroot: goroot, packages: make(map[string][]string), exports: make(map[string]map[string]bool)}
+	src := filepath.Join(goroot, "src")
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		switch d.Name() {
+		case "internal", "vendor", "testdata", "cmd":
+			return filepath.SkipDir
+		}
+
+		importPath, err := filepath.Rel(src, p)
+		if err != nil || importPath == "." || !hasGoFiles(p) {
+			return err
+		}
+
+		importPath = filepath.ToSlash(importPath)
+		name := stdPackageName(importPath)
+		index.packages[name] = append(index.packages[name], importPath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stdIndexes[goroot] = index
+	return index, nil
+}
+
+func hasGoFiles(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".go") && !strings.HasSuffix(entry.Name(), "_test.go") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Major version suffixes are not part of the name, math/rand/v2 is rand
+func stdPackageName(importPath string) string {
+	name := path.Base(importPath)
+	if len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		return path.Base(path.Dir(importPath))
+	}
+
+	return name
+}
+
+// Exported top level names of a package, parsed the first time they are
+// needed to pick between packages sharing a name
+func (s *stdIndex) exported(importPath string) map[string]bool {
+	stdIndexMu.Lock()
+	defer stdIndexMu.Unlock()
+
+	exports, ok := s.exports[importPath]
+	if ok {
+		return exports
+	}
+
+	exports = make(map[string]bool)
+	dir := filepath.Join(s.goroot, "src", filepath.FromSlash(importPath))
+	entries, _ := os.ReadDir(dir)
+	fset := token.NewFileSet()
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") || strings.HasSuffix(entry.Name(), "_test.go") {
+			continue
+		}
+
+		file, err := parser.ParseFile(fset, filepath.Join(dir, entry.Name()), nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil && decl.Name.IsExported() {
+					exports[decl.Name.Name] = true
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						exports[spec.Name.Name] = spec.Name.IsExported()
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							exports[name.Name] = name.IsExported()
+						}
+					}
+				}
+			}
+		}
+	}
+
+	s.exports[importPath] = exports
+	return exports
+}
+
+// The package providing every given name, when several do the shortest
+// import path wins, e.g. math/rand over crypto/rand
+func (s *stdIndex) resolve(name string, selectors map[string]bool) (string, bool) {
+	candidates := append([]string{}, s.packages[name]...)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len(candidates[i]) < len(candidates[j])
+	})
+
+	for _, candidate := range candidates {
+		exports := s.exported(candidate)
+		found := true
+		for selector := range selectors {
+			if !exports[selector] {
+				found = false
+				break
+			}
+		}
+
+		if found {
+			return candidate, true
+		}
+	}
+
+	return "", false
+}
+
+// cgo needs import "C" on its own, right after its preamble, so it is left
+// where it is
+func isCgoImport(decl *ast.GenDecl) bool {
+	return len(decl.Specs) == 1 && decl.Specs[0].(*ast.ImportSpec).Path.Value == `"C"`
+}
+
+// Adds the standard library imports the code uses and removes the ones it
+// doesn't, then formats the result. Imports that are not part of the
+// standard library are only removed when they are explicitly named
+func organizeImports(src []byte, goroot string) ([]byte, error) {
+	index, err := loadStdIndex(goroot)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	// Selectors on identifiers that are not declared anywhere in the code
+	// must be package names
+	used := make(map[string]map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		selector, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+
+		ident, ok := selector.X.(*ast.Ident)
+		if ok && ident.Obj == nil {
+			if used[ident.Name] == nil {
+				used[ident.Name] = make(map[string]bool)
+			}
+			used[ident.Name][selector.Sel.Name] = true
+		}
+
+		return true
+	})
+
+	// Kept imports are grouped like goimports does, standard library first
+	std, others := make([]string, 0), make([]string, 0)
+	imported := make(map[string]bool)
+	changed := false
+	var first *ast.GenDecl
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT || isCgoImport(genDecl) {
+			continue
+		}
+
+		if first == nil {
+			first = genDecl
+		}
+
+		for _, spec := range genDecl.Specs {
+			importSpec := spec.(*ast.ImportSpec)
+			importPath, _ := strconv.Unquote(importSpec.Path.Value)
+
+			name, isStd := stdPackageName(importPath), !strings.Contains(strings.Split(importPath, "/")[0], ".")
+			known := isStd && len(index.packages[name]) > 0
+			if importSpec.Name != nil {
+				name, known = importSpec.Name.Name, true
+			}
+
+			imported[name] = true
+			if known && name != "_" && name != "." && used[name] == nil {
+				changed = true
+				continue
+			}
+
+			from, to := importSpec.Pos(), importSpec.End()
+			if importSpec.Doc != nil {
+				from = importSpec.Doc.Pos()
+			}
+			if importSpec.Comment != nil {
+				to = importSpec.Comment.End()
+			}
+
+			text := string(src[fset.Position(from).Offset:fset.Position(to).Offset])
+			if isStd {
+				std = append(std, text)
+			} else {
+				others = append(others, text)
+			}
+		}
+	}
+
+	for name, selectors := range used {
+		if imported[name] {
+			continue
+		}
+
+		importPath, ok := index.resolve(name, selectors)
+		if ok {
+			std = append(std, strconv.Quote(importPath))
+			changed = true
+		}
+	}
+
+	if !changed {
+		return format.Source(src)
+	}
+
+	var specs []string
+	switch {
+	case len(std) > 0 && len(others) > 0:
+		specs = append(append(std, ""), others...)
+	case len(std) > 0:
+		specs = std
+	default:
+		specs = others
+	}
+
+	var block string
+	switch len(specs) {
+	case 0:
+	case 1:
+		block = "import " + specs[0] + "\n"
+	default:
+		block = "import (\n"
+		for _, spec := range specs {
+			block += "\t" + strings.ReplaceAll(spec, "\n", "\n\t") + "\n"
+		}
+		block += ")\n"
+	}
+
+	// Every import declaration is replaced by the new block, which goes
+	// where the first one was or otherwise after the package clause
+	tokFile := fset.File(file.Pos())
+	lineStart := func(pos token.Pos) int {
+		return tokFile.Offset(tokFile.LineStart(tokFile.Line(pos)))
+	}
+	lineEnd := func(pos token.Pos) int {
+		line := tokFile.Line(pos)
+		if line < tokFile.LineCount() {
+			return tokFile.Offset(tokFile.LineStart(line + 1))
+		}
+		return len(src)
+	}
+
+	var out []byte
+	if first == nil {
+		at := lineEnd(file.Name.End())
+		out = append(append(append([]byte{}, src[:at]...), "\n"+block...), src[at:]...)
+		return format.Source(out)
+	}
+
+	out = append(out, src[:lineStart(first.Pos())]...)
+	out = append(out, block...)
+	prev := lineStart(first.Pos())
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT || isCgoImport(genDecl) {
+			continue
+		}
+
+		start := lineStart(genDecl.Pos())
+		if genDecl.Doc != nil {
+			start = lineStart(genDecl.Doc.Pos())
+		}
+		if start > prev {
+			out = append(out, src[prev:start]...)
+		}
+		prev = max(prev, lineEnd(genDecl.End()))
+	}
+	out = append(out, src[prev:]...)
+
+	return format.Source(out)
+}
+
+// Organizes the imports of the code, syntax errors are shown as markers
+// just like when formatting. Returns whether the imports were organized
+func (e *editor) organizeImports() bool {
+	goroot, err := goRoot()
+	if err != nil {
+		e.banner.showError("Organizing imports", err)
+		return false
+	}
+
+	organized, err := organizeImports([]byte(e.Text()), goroot)
+	if err != nil {
+		e.setMarkers("format", syntaxMarkers(err))
+		return false
+	}
+
+	e.setMarkers("format", nil)
+	e.replaceText(string(organized))
+	return true
+}
@@ -0,0 +1,233 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"strings"
+)
+
+// Runes that are closed automatically as they are typed
+var pairs = map[rune]rune{'(': ')', '[': ']', '{': '}', '"': '"', '\'': '\'', '`': '`'}
+
+func isCloser(r rune) bool {
+	return strings.ContainsRune(")]}\"'`", r)
+}
+
+func isQuote(r rune) bool {
+	return r == '"' || r == '\'' || r == '`'
+}
+
+// The tabs and spaces a line starts with
+func leadingIndent(line []rune) string {
+	i := 0
+	for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+		i++
+	}
+
+	return string(line[:i])
+}
+
+// Removes a single level of indentation from the end of the given one
+func outdent(indent string) string {
+	switch {
+	case strings.HasSuffix(indent, "\t"):
+		return indent[:len(indent)-1]
+	case strings.HasSuffix(indent, " "):
+		trimmed := strings.TrimRight(indent, " ")
+		spaces := len(indent) - len(trimmed)
+		return indent[:len(indent)-min(spaces, TAB_WIDTH)]
+	}
+
+	return indent
+}
+
+func (e *editor) runeAt(pos textPos) (rune, bool) {
+	line := e.buf.line(pos.row)
+	if pos.col < 0 || pos.col >= len(line) {
+		return 0, false
+	}
+
+	return line[pos.col], true
+}
+
+// Closes brackets and quotes, steps over closers that are already there
+// and dedents closing brackets typed at the start of a line
+func (e *editor) typeRune(r rune) {
+	next, hasNext := e.runeAt(e.cursor)
+	prev, hasPrev := e.runeAt(textPos{row: e.cursor.row, col: e.cursor.col - 1})
+
+	if !e.hasSelection() && hasNext && next == r && isCloser(r) {
+		e.moveHorizontally(e.nextPos(e.cursor), false)
+		return
+	}
+
+	closer, ok := pairs[r]
+	switch {
+	case ok && e.hasSelection():
+		// The selection is wrapped and kept selected inside the pair
+		start, end := orderPos(e.anchor, e.cursor)
+		e.replace(start, end, string(r)+e.selectedText()+string(closer))
+		e.anchor = textPos{row: start.row, col: start.col + 1}
+		e.cursor = end
+		if start.row == end.row {
+			e.cursor.col++
+		}
+		e.changed()
+		return
+	case ok && isQuote(r) && (hasPrev && isWordRune(prev) || hasNext && isWordRune(next)):
+	case ok && (!hasNext || next == ' ' || next == '\t' || isCloser(next)):
+		e.insert(string(r) + string(closer))
+		e.moveHorizontally(e.prevPos(e.cursor), false)
+		return
+	}
+
+	line := e.buf.line(e.cursor.row)
+	if strings.ContainsRune(")]}", r) && !e.hasSelection() && strings.TrimSpace(string(line[:e.cursor.col])) == "" {
+		start := textPos{row: e.cursor.row}
+		e.cursor = e.replace(start, e.cursor, outdent(string(line[:e.cursor.col]))+string(r))
+		e.anchor = e.cursor
+		e.changed()
+		return
+	}
+
+	e.insert(string(r))
+}
+
+// Keeps the indentation of the current line, adding a level after an
+// opening bracket and moving its closer, if right after the cursor, below
+func (e *editor) newline() {
+	start, end := orderPos(e.anchor, e.cursor)
+	line := e.buf.line(start.row)
+	indent := leadingIndent(line[:start.col])
+
+	prev := strings.TrimRight(string(line[:start.col]), " \t")
+	next, hasNext := e.runeAt(end)
+	if len(prev) == 0 || !strings.ContainsRune("{([", rune(prev[len(prev)-1])) {
+		e.insert("\n" + indent)
+		return
+	}
+
+	inner := indent + "\t"
+	if !hasNext || next != pairs[rune(prev[len(prev)-1])] {
+		e.insert("\n" + inner)
+		return
+	}
+
+	e.replace(start, end, "\n"+inner+"\n"+indent)
+	e.cursor = textPos{row: start.row + 1, col: len([]rune(inner))}
+	e.anchor = e.cursor
+	e.changed()
+}
+
+// Rows covered by the selection, a selection ending at the start of a line
+// doesn't include it
+func (e *editor) selectedRows() (int, int) {
+	start, end := orderPos(e.anchor, e.cursor)
+	if end.row > start.row && end.col == 0 {
+		return start.row, end.row - 1
+	}
+
+	return start.row, end.row
+}
+
+// Replaces the given rows as a single edit, the selection is kept over the
+// rows when there was one and otherwise the cursor stays on its line
+func (e *editor) replaceRows(first, last int, lines []string) {
+	selected := e.hasSelection()
+	cursorLine := e.buf.line(e.cursor.row)
+	offset := 0
+	if e.cursor.row >= first && e.cursor.row <= last {
+		offset = len([]rune(lines[e.cursor.row-first])) - len(cursorLine)
+	}
+
+	end := e.replace(textPos{row: first}, textPos{row: last, col: len(e.buf.line(last))}, strings.Join(lines, "\n"))
+	if selected {
+		e.anchor = textPos{row: first}
+		e.cursor = end
+	} else {
+		e.cursor = e.buf.clamp(textPos{row: e.cursor.row, col: max(e.cursor.col+offset, 0)})
+		e.anchor = e.cursor
+	}
+	e.changed()
+}
+
+// Adds or removes a level of indentation to every selected line
+func (e *editor) indentRows(out bool) {
+	first, last := e.selectedRows()
+	e.indentRange(first, last, out)
+}
+
+func (e *editor) indentRange(first, last int, out bool) {
+	lines := make([]string, 0, last-first+1)
+	for row := first; row <= last; row++ {
+		line := string(e.buf.line(row))
+		indent := leadingIndent(e.buf.line(row))
+		switch {
+		case out:
+			line = outdent(indent) + line[len(indent):]
+		case len(strings.TrimSpace(line)) > 0:
+			line = "\t" + line
+		}
+		lines = append(lines, line)
+	}
+
+	e.replaceRows(first, last, lines)
+}
+
+// Comments out the selected lines, or uncomments them when all of them are
+// already commented out. Comments are placed after the shortest indentation
+func (e *editor) toggleComment() {
+	first, last := e.selectedRows()
+
+	commented, found := true, false
+	indent := ""
+	for row := first; row <= last; row++ {
+		line := e.buf.line(row)
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		lineIndent := leadingIndent(line)
+		if !found || len(lineIndent) < len(indent) {
+			indent, found = lineIndent, true
+		}
+		if !strings.HasPrefix(string(line[len([]rune(lineIndent)):]), "//") {
+			commented = false
+		}
+	}
+
+	lines := make([]string, 0, last-first+1)
+	for row := first; row <= last; row++ {
+		line := string(e.buf.line(row))
+		switch {
+		case len(strings.TrimSpace(line)) == 0:
+		case commented:
+			lineIndent := leadingIndent(e.buf.line(row))
+			rest := strings.TrimPrefix(line[len(lineIndent):], "//")
+			line = lineIndent + strings.TrimPrefix(rest, " ")
+		default:
+			line = line[:len(indent)] + "// " + line[len(indent):]
+		}
+		lines = append(lines, line)
+	}
+
+	e.replaceRows(first, last, lines)
+}
+
+// Deletes both runes of an empty pair, such as "()", at once
+func (e *editor) backspace() {
+	if e.hasSelection() {
+		e.deleteSelection()
+		return
+	}
+
+	prev, hasPrev := e.runeAt(textPos{row: e.cursor.row, col: e.cursor.col - 1})
+	next, hasNext := e.runeAt(e.cursor)
+	e.anchor = e.prevPos(e.cursor)
+	if hasPrev && hasNext && pairs[prev] == next {
+		e.cursor = e.nextPos(e.cursor)
+	}
+	e.deleteSelection()
+}
@@ -0,0 +1,435 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+)
+
+var (
+	errInvalidKeys		= errors.New("invalid key combination")
+	errConflictingKeys	= errors.New("key combination already in use")
+)
+
+// Keys that can be used in a key combination, besides letters and digits
+var namedKeys = []fyne.KeyName{
+	fyne.KeyReturn, fyne.KeyEnter, fyne.KeyTab, fyne.KeySpace, fyne.KeyEscape, fyne.KeyBackspace,
+	fyne.KeyDelete, fyne.KeyInsert, fyne.KeyHome, fyne.KeyEnd, fyne.KeyPageUp, fyne.KeyPageDown,
+	fyne.KeyUp, fyne.KeyDown, fyne.KeyLeft, fyne.KeyRight,
+	fyne.KeyF1, fyne.KeyF2, fyne.KeyF3, fyne.KeyF4, fyne.KeyF5, fyne.KeyF6,
+	fyne.KeyF7, fyne.KeyF8, fyne.KeyF9, fyne.KeyF10, fyne.KeyF11, fyne.KeyF12,
+	fyne.KeyMinus, fyne.KeyEqual, fyne.KeyComma, fyne.KeyPeriod, fyne.KeySlash,
+	fyne.KeySemicolon, fyne.KeyApostrophe, fyne.KeyBackslash, fyne.KeyBackTick,
+	fyne.KeyLeftBracket, fyne.KeyRightBracket,
+}
+
+// Symbol keys are spelled out, as "," and "+" already separate keys
+var keyAliases = map[string]fyne.KeyName{
+	"minus": fyne.KeyMinus,
+	"equal": fyne.KeyEqual,
+	"comma": fyne.KeyComma,
+	"period": fyne.KeyPeriod,
+	"slash": fyne.KeySlash,
+	"semicolon": fyne.KeySemicolon,
+	"apostrophe": fyne.KeyApostrophe,
+	"backslash": fyne.KeyBackslash,
+	"backtick": fyne.KeyBackTick,
+	"leftbracket": fyne.KeyLeftBracket,
+	"rightbracket": fyne.KeyRightBracket,
+}
+
+type command struct {
+	id		string
+	info	string
+	keys	[]string
+	run		func()
+}
+
+// Resolves shortcuts to commands, regardless of whether they were typed
+// into a focused widget or the window itself
+type customDispatcher struct {
+	window		fyne.Window
+	commands	[]*command
+	defaults	map[string][]string
+	bindings	map[string]*command
+	registered	[]fyne.Shortcut
+}
+
+func newDispatcher(window fyne.Window) *customDispatcher {
+	return &customDispatcher{
+		window: window,
+		defaults: make(map[string][]string),
+		bindings: make(map[string]*command),
+	}
+}
+
+func (d *customDispatcher) register(commands ...*command) {
+	for _, cmd := range commands {
+		d.defaults[cmd.id] = cmd.keys
+		d.commands = append(d.commands, cmd)
+	}
+}
+
+func (d *customDispatcher) command(id string) *command {
+	for _, cmd := range d.commands {
+		if cmd.id == id {
+			return cmd
+		}
+	}
+
+	return nil
+}
+
+func (d *customDispatcher) TypedShortcut(shortcut fyne.Shortcut) {
+	cmd, ok := d.bindings[shortcut.ShortcutName()]
+	if ok {
+		cmd.run()
+	}
+}
+
+// Whether the shortcut runs one of the commands
+func (d *customDispatcher) bound(shortcut fyne.Shortcut) bool {
+	_, ok := d.bindings[shortcut.ShortcutName()]
+	return ok
+}
+
+// Registers the keys of every command in the canvas, replacing the ones
+// that were registered before. On conflicts the first command wins
+func (d *customDispatcher) bind() error {
+	for _, shortcut := range d.registered {
+		d.window.Canvas().RemoveShortcut(shortcut)
+	}
+	d.registered = nil
+	d.bindings = make(map[string]*command)
+
+	var errs []error
+	for _, cmd := range d.commands {
+		for _, keys := range cmd.keys {
+			shortcut, err := parseKeys(keys)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", cmd.info, err))
+				continue
+			}
+
+			bound, ok := d.bindings[shortcut.ShortcutName()]
+			if ok {
+				errs = append(errs, fmt.Errorf("%s: %w by %s: %s", cmd.info, errConflictingKeys, bound.info, keys))
+				continue
+			}
+
+			d.bindings[shortcut.ShortcutName()] = cmd
+			d.registered = append(d.registered, shortcut)
+			d.window.Canvas().AddShortcut(shortcut, d.TypedShortcut)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Returns the command, other than the given one, already bound to the keys
+func (d *customDispatcher) conflict(id string, keys string) (*command, error) {
+	shortcut, err := parseKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cmd := range d.commands {
+		if cmd.id == id {
+			continue
+		}
+
+		for _, other := range cmd.keys {
+			otherShortcut, err := parseKeys(other)
+			if err == nil && otherShortcut.ShortcutName() == shortcut.ShortcutName() {
+				return cmd, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// Changes the keys of a command and persists the keymap, nothing changes
+// if any of the keys is invalid or already in use
+func (d *customDispatcher) rebind(id string, keys []string) error {
+	cmd := d.command(id)
+	if cmd == nil {
+		return fmt.Errorf("unknown command %s", id)
+	}
+
+	names := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		shortcut, err := parseKeys(k)
+		if err != nil {
+			return err
+		} else if names[shortcut.ShortcutName()] {
+			return fmt.Errorf("%w: %s is repeated", errInvalidKeys, k)
+		}
+		names[shortcut.ShortcutName()] = true
+
+		other, err := d.conflict(id, k)
+		if err != nil {
+			return err
+		} else if other != nil {
+			return fmt.Errorf("%w by %s: %s", errConflictingKeys, other.info, k)
+		}
+	}
+
+	previous := cmd.keys
+	cmd.keys = keys
+	err := d.bind()
+	if err == nil {
+		err = d.saveKeymap()
+	}
+	if err != nil {
+		cmd.keys = previous
+		return errors.Join(err, d.bind())
+	}
+
+	return nil
+}
+
+func (d *customDispatcher) resetKeymap() error {
+	for _, cmd := range d.commands {
+		cmd.keys = d.defaults[cmd.id]
+	}
+
+	err := d.bind()
+	if err != nil {
+		return err
+	}
+
+	return removeIfExists(keymapPath())
+}
+
+func keymapPath() string {
+	return filepath.Join(os.Getenv("RUNGO_CONFIG_DIR"), KEYMAP_FILE)
+}
+
+// The keymap file maps command ids to their keys, commands missing from it
+// keep their default keys
+func (d *customDispatcher) loadKeymap() error {
+	data, err := os.ReadFile(keymapPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	keymap := make(map[string][]string)
+	err = json.Unmarshal(data, &keymap)
+	if err != nil {
+		return err
+	}
+
+	for id, keys := range keymap {
+		cmd := d.command(id)
+		if cmd == nil {
+			logger.Warn("unknown command in keymap: " + id)
+			continue
+		}
+
+		cmd.keys = keys
+	}
+
+	return nil
+}
+
+// Only commands whose keys differ from the defaults are written, so new
+// default keys in future releases are picked up
+func (d *customDispatcher) saveKeymap() error {
+	keymap := make(map[string][]string)
+	for _, cmd := range d.commands {
+		if !slices.Equal(cmd.keys, d.defaults[cmd.id]) {
+			keymap[cmd.id] = cmd.keys
+		}
+	}
+
+	data, err := json.MarshalIndent(keymap, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(keymapPath(), data, 0644)
+}
+
+// Parses key combinations such as "Alt+Shift+S" or "Ctrl+Tab", at least
+// one of Ctrl, Alt or Super is required so typing is not hijacked
+func parseKeys(keys string) (*desktop.CustomShortcut, error) {
+	parts := strings.Split(strings.ReplaceAll(keys, " ", ""), "+")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("%w: %s", errInvalidKeys, keys)
+	}
+
+	shortcut := &desktop.CustomShortcut{}
+	for _, modifier := range parts[:len(parts)-1] {
+		switch strings.ToLower(modifier) {
+		case "shift":
+			shortcut.Modifier |= fyne.KeyModifierShift
+		case "ctrl", "control":
+			shortcut.Modifier |= fyne.KeyModifierControl
+		case "alt", "option":
+			shortcut.Modifier |= fyne.KeyModifierAlt
+		case "super", "cmd", "command":
+			shortcut.Modifier |= fyne.KeyModifierSuper
+		default:
+			return nil, fmt.Errorf("%w: unknown modifier %s", errInvalidKeys, modifier)
+		}
+	}
+
+	if shortcut.Modifier&^fyne.KeyModifierShift == 0 {
+		return nil, fmt.Errorf("%w: %s needs Ctrl, Alt or Super", errInvalidKeys, keys)
+	}
+
+	key := parts[len(parts)-1]
+	switch {
+	case len(key) == 1 && strings.ContainsAny(strings.ToUpper(key), "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"):
+		shortcut.KeyName = fyne.KeyName(strings.ToUpper(key))
+	case len(keyAliases[strings.ToLower(key)]) > 0:
+		shortcut.KeyName = keyAliases[strings.ToLower(key)]
+	default:
+		for _, name := range namedKeys {
+			if strings.EqualFold(string(name), key) {
+				shortcut.KeyName = name
+			}
+		}
+	}
+
+	if len(shortcut.KeyName) == 0 {
+		return nil, fmt.Errorf("%w: unknown key %s", errInvalidKeys, key)
+	}
+
+	// These are turned into clipboard shortcuts before reaching RunGo
+	if shortcut.Modifier == fyne.KeyModifierShortcutDefault && strings.Contains("ACVX", string(shortcut.KeyName)) {
+		return nil, fmt.Errorf("%w: %s is reserved", errInvalidKeys, keys)
+	}
+
+	return shortcut, nil
+}
+
+// Splits a comma separated list of key combinations, as typed by the user
+func splitKeys(text string) []string {
+	keys := make([]string, 0)
+	for _, k := range strings.Split(text, ",") {
+		k = strings.TrimSpace(k)
+		if len(k) > 0 {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// Rows of the shortcuts table, in the order commands were registered
+func (d *customDispatcher) shortcuts() []customShortcut {
+	shortcuts := make([]customShortcut, 0, len(d.commands))
+	for _, cmd := range d.commands {
+		shortcuts = append(shortcuts, customShortcut{id: cmd.id, keys: strings.Join(cmd.keys, ", "), info: cmd.info})
+	}
+
+	return shortcuts
+}
+
+// Commands whose description or id fuzzy match the query, best matches
+// first. An empty query matches every command
+func (d *customDispatcher) search(query string) []*command {
+	type match struct {
+		cmd		*command
+		score	int
+	}
+
+	matches := make([]match, 0, len(d.commands))
+	for _, cmd := range d.commands {
+		score, ok := fuzzyScore(query, cmd.info)
+		idScore, idOk := fuzzyScore(query, cmd.id)
+		if idOk && (!ok || idScore > score) {
+			score, ok = idScore, idOk
+		}
+
+		if ok {
+			matches = append(matches, match{cmd: cmd, score: score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	commands := make([]*command, 0, len(matches))
+	for _, m := range matches {
+		commands = append(commands, m.cmd)
+	}
+
+	return commands
+}
+
+// Matches when every character of the query appears in the text in the
+// same order, ignoring case and spaces. Consecutive characters and the ones
+// starting a word score higher, so "nt" prefers "New tab" over "Rename tab"
+func fuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(strings.ReplaceAll(query, " ", "")))
+	runes := []rune(strings.ToLower(text))
+	if len(q) == 0 {
+		return 0, true
+	}
+
+	// best[i] is the highest score of the query matched so far, with its
+	// last character at position i of the text, or -1 if there is none
+	best := make([]int, len(runes))
+	for i := range best {
+		best[i] = -1
+	}
+
+	for k, r := range q {
+		next := make([]int, len(runes))
+		for i := range runes {
+			next[i] = -1
+			if runes[i] != r {
+				continue
+			}
+
+			score := 1
+			if i == 0 || !unicode.IsLetter(runes[i-1]) && !unicode.IsDigit(runes[i-1]) {
+				score += 3
+			}
+
+			if k == 0 {
+				next[i] = score
+				continue
+			}
+
+			for p := 0; p < i; p++ {
+				if best[p] < 0 {
+					continue
+				}
+
+				candidate := best[p] + score
+				if p == i-1 {
+					candidate += 2
+				}
+				next[i] = max(next[i], candidate)
+			}
+		}
+		best = next
+	}
+
+	score := -1
+	for _, b := range best {
+		score = max(score, b)
+	}
+
+	return score, score >= 0
+}
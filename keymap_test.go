@@ -0,0 +1,155 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/test"
+)
+
+func TestParseKeys(t *testing.T) {
+	reserved := "Ctrl+V"
+	if fyne.KeyModifierShortcutDefault == fyne.KeyModifierSuper {
+		reserved = "Super+V"
+	}
+
+	tests := []struct {
+		keys		string
+		modifier	fyne.KeyModifier
+		key			fyne.KeyName
+		err			error
+	}{
+		{keys: "Alt+S", modifier: fyne.KeyModifierAlt, key: fyne.KeyS},
+		{keys: "alt+shift+s", modifier: fyne.KeyModifierAlt | fyne.KeyModifierShift, key: fyne.KeyS},
+		{keys: "Ctrl + Shift + Tab", modifier: fyne.KeyModifierControl | fyne.KeyModifierShift, key: fyne.KeyTab},
+		{keys: "Control+Return", modifier: fyne.KeyModifierControl, key: fyne.KeyReturn},
+		{keys: "Cmd+1", modifier: fyne.KeyModifierSuper, key: fyne.Key1},
+		{keys: "Option+F5", modifier: fyne.KeyModifierAlt, key: fyne.KeyF5},
+		{keys: "Alt+comma", modifier: fyne.KeyModifierAlt, key: fyne.KeyComma},
+		{keys: "Alt+home", modifier: fyne.KeyModifierAlt, key: fyne.KeyHome},
+		{keys: "S", err: errInvalidKeys},
+		{keys: "Shift+S", err: errInvalidKeys},
+		{keys: "Hyper+S", err: errInvalidKeys},
+		{keys: "Alt+Nope", err: errInvalidKeys},
+		{keys: "Alt+", err: errInvalidKeys},
+		{keys: reserved, err: errInvalidKeys},
+	}
+
+	for _, test := range tests {
+		t.Run(test.keys, func(t *testing.T) {
+			shortcut, err := parseKeys(test.keys)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			} else if err != nil {
+				return
+			}
+
+			if shortcut.Modifier != test.modifier || shortcut.KeyName != test.key {
+				t.Errorf("got %v %s, want %v %s", shortcut.Modifier, shortcut.KeyName, test.modifier, test.key)
+			}
+		})
+	}
+}
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name		string
+		keys		[]string
+		// Where the keymap is saved, a directory that doesn't exist makes
+		// saving it fail
+		configDir	string
+		want		[]string
+		err			error
+	}{
+		{name: "new keys", keys: []string{"Alt+X", "Ctrl+Y"}, want: []string{"Alt+X", "Ctrl+Y"}},
+		{name: "no keys", keys: []string{}, want: []string{}},
+		{name: "repeated keys", keys: []string{"Alt+X", "Alt+X"}, want: []string{"Alt+A"}, err: errInvalidKeys},
+		{name: "repeated keys spelled differently", keys: []string{"Ctrl+Return", "control + return"}, want: []string{"Alt+A"}, err: errInvalidKeys},
+		{name: "keys of another command", keys: []string{"Alt+X", "alt+b"}, want: []string{"Alt+A"}, err: errConflictingKeys},
+		{name: "invalid keys", keys: []string{"Alt+Nope"}, want: []string{"Alt+A"}, err: errInvalidKeys},
+		{name: "keymap not saved", keys: []string{"Alt+X"}, configDir: "missing", want: []string{"Alt+A"}},
+	}
+
+	app := test.NewApp()
+	defer app.Quit()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("RUNGO_CONFIG_DIR", filepath.Join(t.TempDir(), test.configDir))
+			d := newDispatcher(app.NewWindow(""))
+			d.register(
+				&command{id: "a", keys: []string{"Alt+A"}},
+				&command{id: "b", keys: []string{"Alt+B"}},
+			)
+			if err := d.bind(); err != nil {
+				t.Fatal(err)
+			}
+
+			err := d.rebind("a", test.keys)
+			switch {
+			case test.err != nil && !errors.Is(err, test.err):
+				t.Fatalf("got error %v, want %v", err, test.err)
+			case len(test.configDir) > 0 && err == nil:
+				t.Fatal("saving the keymap didn't fail")
+			case test.err == nil && len(test.configDir) == 0 && err != nil:
+				t.Fatal(err)
+			}
+
+			if got := d.command("a").keys; !slices.Equal(got, test.want) {
+				t.Errorf("got keys %v, want %v", got, test.want)
+			}
+			for _, keys := range test.want {
+				shortcut, _ := parseKeys(keys)
+				if !d.bound(shortcut) {
+					t.Errorf("%s is not bound", keys)
+				}
+			}
+		})
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		name	string
+		query	string
+		// Texts in the order they should rank, all of them matching
+		ranked	[]string
+		// Texts that shouldn't match
+		missing	[]string
+	}{
+		{name: "empty query", query: "", ranked: []string{"New tab"}},
+		{name: "case and spaces", query: "NEW T", ranked: []string{"New tab"}},
+		{name: "word starts", query: "nt", ranked: []string{"New tab", "Rename tab"}},
+		{name: "consecutive characters", query: "ab", ranked: []string{"Grab", "Garb"}},
+		{name: "order matters", query: "ba", missing: []string{"Abc"}, ranked: []string{"Bar"}},
+		{name: "every character is needed", query: "xyz", missing: []string{"xy", "Run code"}},
+		{name: "characters are not reused", query: "aa", missing: []string{"a"}, ranked: []string{"a a"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previous := 0
+			for i, text := range test.ranked {
+				score, ok := fuzzyScore(test.query, text)
+				if !ok {
+					t.Fatalf("%q doesn't match %q", test.query, text)
+				} else if i > 0 && score >= previous {
+					t.Errorf("%q scores %d for %q, not less than %d for %q", test.query, score, text, previous, test.ranked[i-1])
+				}
+				previous = score
+			}
+
+			for _, text := range test.missing {
+				if _, ok := fuzzyScore(test.query, text); ok {
+					t.Errorf("%q matches %q", test.query, text)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"runtime"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+)
+
+// Emulates the keys of another editor, such as vim or emacs. Keys go to the
+// mode before the editor handles them, and it claims the ones it uses
+type keyMode interface {
+	typedRune(r rune) bool
+	typedKey(key *fyne.KeyEvent) bool
+	typedShortcut(shortcut fyne.Shortcut) bool
+	// Shown in the status bar, e.g. "-- INSERT --"
+	status() string
+	// Where a block cursor is drawn instead of the usual bar, if anywhere
+	blockCursor() (textPos, bool)
+}
+
+// The mode chosen in the settings, it's created again when that changes
+func (e *editor) keyMode() keyMode {
+	keybindings := getSettings().Keybindings
+	if keybindings != e.keybindings {
+		e.keybindings = keybindings
+		switch keybindings {
+		case KEYBINDINGS_VIM:
+			e.mode = newVimMode(e)
+		case KEYBINDINGS_EMACS:
+			e.mode = newEmacsMode(e)
+		default:
+			e.mode = nil
+		}
+	}
+
+	return e.mode
+}
+
+// Runs one of the app's commands, e.g. saving the snippet from vim's ":w"
+func (e *editor) runCommand(id string) {
+	if e.onCommand != nil {
+		e.onCommand(id)
+	}
+}
+
+// Shortcuts with Alt that are bound to a command keep running it whatever
+// the mode, as the app's own shortcuts mostly use Alt
+func (e *editor) boundAltShortcut(shortcut fyne.Shortcut) bool {
+	s, ok := shortcut.(*desktop.CustomShortcut)
+	return ok && s.Modifier&fyne.KeyModifierAlt != 0 && e.isBound != nil && e.isBound(s)
+}
+
+// Copy, cut, paste and select all typed with Ctrl are delivered as standard
+// shortcuts everywhere but macOS, they are spelled out as the keys they are
+// typed with so modes can bind them
+func ctrlShortcut(shortcut fyne.Shortcut) (*desktop.CustomShortcut, bool) {
+	ctrl := func(key fyne.KeyName) (*desktop.CustomShortcut, bool) {
+		return &desktop.CustomShortcut{KeyName: key, Modifier: fyne.KeyModifierControl}, runtime.GOOS != "darwin"
+	}
+
+	switch s := shortcut.(type) {
+	case *desktop.CustomShortcut:
+		return s, true
+	case *fyne.ShortcutSelectAll:
+		return ctrl(fyne.KeyA)
+	case *fyne.ShortcutCut:
+		return ctrl(fyne.KeyX)
+	case *fyne.ShortcutPaste:
+		return ctrl(fyne.KeyV)
+	case *fyne.ShortcutCopy:
+		return ctrl(fyne.KeyC)
+	}
+
+	return nil, false
+}
@@ -0,0 +1,642 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+	"go.uber.org/zap"
+)
+
+// Connects an editor to gopls, which is started lazily for the workspace
+// the code belongs to and restarted when that or the Go version changes
+type editorLSP struct {
+	mu			sync.Mutex
+	client		*lspClient
+	workspace	string
+	failed		string
+	uri			string
+	scratch		string
+	starting	bool
+	version		int
+	dirty		bool
+	changeTimer	*time.Timer
+}
+
+// Identifies what gopls was started for, a different one needs a new server
+func (e *editor) lspWorkspace() string {
+	snippet, _ := e.snippet.Get()
+	return strings.Join([]string{os.Getenv("RUNGO_GO_VER"), e.file, snippet}, "\x00")
+}
+
+// Starts gopls in the background unless it's already running for the
+// current workspace, a workspace that failed to start is not retried
+func (e *editor) ensureLSP() {
+	if !getSettings().LanguageServer || len(os.Getenv("RUNGO_GO_VER")) == 0 {
+		return
+	}
+
+	workspace := e.lspWorkspace()
+	e.lsp.mu.Lock()
+	defer e.lsp.mu.Unlock()
+
+	if e.lsp.starting || e.lsp.failed == workspace || (e.lsp.client != nil && e.lsp.workspace == workspace) {
+		return
+	}
+
+	old := e.lsp.client
+	e.lsp.client, e.lsp.workspace, e.lsp.starting = nil, workspace, true
+	go func() {
+		if old != nil {
+			old.close()
+		}
+
+		client, uri, err := e.startLSP()
+
+		e.lsp.mu.Lock()
+		e.lsp.starting = false
+		if err != nil {
+			e.lsp.failed = workspace
+			e.lsp.mu.Unlock()
+			runOnUI(func() { e.banner.showError("Starting gopls", err) })
+			return
+		}
+
+		e.lsp.client, e.lsp.uri, e.lsp.version, e.lsp.dirty = client, uri, 1, false
+		e.lsp.mu.Unlock()
+
+		// The snippet or Go version may have changed while it was starting
+		e.ensureLSP()
+	}()
+}
+
+func (e *editor) startLSP() (*lspClient, string, error) {
+	version := os.Getenv("RUNGO_GO_VER")
+	err := installGopls(version)
+	if err != nil {
+		return nil, "", err
+	}
+
+	snippet, _ := e.snippet.Get()
+	var file string
+	switch {
+	case len(e.file) > 0:
+		file = e.file
+	case len(snippet) > 0:
+		file = filepath.Join(snippetDir(snippet), "main.go")
+	default:
+		e.lsp.mu.Lock()
+		if len(e.lsp.scratch) == 0 {
+			e.lsp.scratch, err = newScratchWorkspace()
+		}
+		scratch := e.lsp.scratch
+		e.lsp.mu.Unlock()
+		if err != nil {
+			return nil, "", err
+		}
+
+		file = filepath.Join(scratch, "main.go")
+		err = errors.Join(writeScratchModule(scratch, version), os.WriteFile(file, []byte(e.Text()), 0644))
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	dir, uri := filepath.Dir(file), fileURI(file)
+	client, err := startLSPClient(goplsCommand(version, dir), func(method string, params json.RawMessage) {
+		e.lspNotification(uri, method, params)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), LSP_TIMEOUT)
+	defer cancel()
+
+	err = client.call(ctx, "initialize", map[string]any{
+		"processId": os.Getpid(),
+		"rootUri": fileURI(dir),
+		"workspaceFolders": []map[string]string{{"uri": fileURI(dir), "name": filepath.Base(dir)}},
+		"capabilities": map[string]any{
+			"textDocument": map[string]any{
+				"completion": map[string]any{"completionItem": map[string]any{"snippetSupport": false}},
+				"hover": map[string]any{"contentFormat": []string{"markdown", "plaintext"}},
+				"signatureHelp": map[string]any{},
+				"publishDiagnostics": map[string]any{},
+			},
+		},
+	}, nil)
+	if err == nil {
+		err = client.notify("initialized", map[string]any{})
+	}
+	if err == nil {
+		err = client.notify("textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{"uri": uri, "languageId": "go", "version": 1, "text": e.Text()},
+		})
+	}
+	if err != nil {
+		go client.close()
+		return nil, "", err
+	}
+
+	return client, uri, nil
+}
+
+// Stops gopls and removes the scratch workspace, if any
+func (e *editor) closeLSP() {
+	e.lsp.mu.Lock()
+	defer e.lsp.mu.Unlock()
+
+	if e.lsp.changeTimer != nil {
+		e.lsp.changeTimer.Stop()
+	}
+	if e.lsp.client != nil {
+		go e.lsp.client.close()
+		e.lsp.client = nil
+	}
+	if len(e.lsp.scratch) > 0 {
+		err := os.RemoveAll(e.lsp.scratch)
+		if err != nil {
+			logger.Warn("os.RemoveAll()", zap.Error(err))
+		}
+		e.lsp.scratch = ""
+	}
+	e.lsp.workspace = ""
+}
+
+// The code is sent to gopls once typing pauses, gopls is only started for
+// editors that are being used so restoring a session doesn't start one per tab
+func (e *editor) lspChanged() {
+	if e.focused {
+		e.ensureLSP()
+	}
+
+	e.lsp.mu.Lock()
+	defer e.lsp.mu.Unlock()
+
+	e.lsp.dirty = true
+	if e.lsp.changeTimer != nil {
+		e.lsp.changeTimer.Stop()
+	}
+	e.lsp.changeTimer = time.AfterFunc(LSP_CHANGE_DELAY, func() {
+		e.syncLSP()
+	})
+}
+
+// Sends the code to gopls if it changed since it was last sent, and returns
+// the client to make requests about it with
+func (e *editor) syncLSP() *lspClient {
+	e.lsp.mu.Lock()
+	defer e.lsp.mu.Unlock()
+
+	client := e.lsp.client
+	if client == nil || !e.lsp.dirty {
+		return client
+	}
+
+	e.lsp.version++
+	e.lsp.dirty = false
+	err := client.notify("textDocument/didChange", map[string]any{
+		"textDocument": map[string]any{"uri": e.lsp.uri, "version": e.lsp.version},
+		"contentChanges": []map[string]string{{"text": e.Text()}},
+	})
+	if err != nil {
+		logger.Warn("textDocument/didChange", zap.Error(err))
+	}
+
+	return client
+}
+
+// Makes a request about the given position once gopls has the latest code,
+// requests are made in the background and results ignored on failure
+func (e *editor) lspRequest(method string, pos textPos, extra map[string]any, result any, done func()) {
+	e.ensureLSP()
+	e.lsp.mu.Lock()
+	uri := e.lsp.uri
+	e.lsp.mu.Unlock()
+
+	params := map[string]any{
+		"textDocument": map[string]string{"uri": uri},
+		"position": toLSPPosition(e.buf.lines, pos),
+	}
+	for key, value := range extra {
+		params[key] = value
+	}
+
+	go func() {
+		client := e.syncLSP()
+		if client == nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), LSP_TIMEOUT)
+		defer cancel()
+
+		err := client.call(ctx, method, params, result)
+		if err != nil {
+			logger.Warn(method, zap.Error(err))
+			return
+		}
+
+		done()
+	}()
+}
+
+func (e *editor) lspNotification(uri, method string, params json.RawMessage) {
+	if method != "textDocument/publishDiagnostics" {
+		return
+	}
+
+	var diagnostics struct {
+		URI			string			`json:"uri"`
+		Diagnostics	[]lspDiagnostic	`json:"diagnostics"`
+	}
+	err := json.Unmarshal(params, &diagnostics)
+	if err != nil || diagnostics.URI != uri {
+		return
+	}
+
+	lines := e.buf.snapshot()
+	markers := make([]marker, 0, len(diagnostics.Diagnostics))
+	for _, d := range diagnostics.Diagnostics {
+		kind := markerInfo
+		switch d.Severity {
+		case 1:
+			kind = markerError
+		case 2:
+			kind = markerWarning
+		}
+		// Ranges spanning several lines are underlined up to the end of the
+		// first one
+		start, end := fromLSPPosition(lines, d.Range.Start), fromLSPPosition(lines, d.Range.End)
+		if end.row > start.row && start.row < len(lines) {
+			end.col = len(lines[start.row])
+		}
+		markers = append(markers, marker{row: d.Range.Start.Line, col: start.col, endCol: end.col, kind: kind, message: d.Message})
+	}
+
+	e.setMarkers("gopls", markers)
+}
+
+// Where the word being typed at the given position starts
+func (e *editor) wordStart(pos textPos) textPos {
+	line := e.buf.line(pos.row)
+	col := pos.col
+	for col > 0 && isWordRune(line[col-1]) {
+		col--
+	}
+
+	return textPos{row: pos.row, col: col}
+}
+
+// Canvas position right below the given text position
+func (e *editor) canvasPosAt(pos textPos) fyne.Position {
+	charWidth, lineHeight := e.metrics()
+	origin := e.textOrigin()
+	col := visualCol(e.buf.line(pos.row), pos.col)
+
+	abs := fyne.CurrentApp().Driver().AbsolutePositionForObject(e)
+	return fyne.NewPos(abs.X+origin.X+float32(col-e.left)*charWidth, abs.Y+origin.Y+float32(pos.row-e.top+1)*lineHeight)
+}
+
+// Asks gopls for completions at the cursor, the results are narrowed down
+// while typing without asking again
+func (e *editor) complete() {
+	cursor := e.cursor
+	var result json.RawMessage
+	e.lspRequest("textDocument/completion", cursor, nil, &result, func() {
+		var list struct {
+			Items []lspCompletionItem `json:"items"`
+		}
+		if len(result) > 0 && result[0] == '[' {
+			json.Unmarshal(result, &list.Items)
+		} else {
+			json.Unmarshal(result, &list)
+		}
+
+		start := e.wordStart(cursor)
+		if len(list.Items) > 0 && list.Items[0].TextEdit != nil {
+			start = fromLSPPosition(e.buf.lines, list.Items[0].TextEdit.Range.Start)
+		}
+
+		if e.cursor == cursor && len(list.Items) > 0 {
+			e.completion.show(list.Items, start)
+		}
+	})
+}
+
+func (e *editor) signatureHelp() {
+	var help *lspSignatureHelp
+	e.lspRequest("textDocument/signatureHelp", e.cursor, nil, &help, func() {
+		if help == nil || len(help.Signatures) == 0 {
+			e.hideInfo()
+			return
+		}
+
+		signature := help.Signatures[min(max(help.ActiveSignature, 0), len(help.Signatures)-1)]
+		e.showInfo(widget.NewRichText(signatureSegments(signature, help.ActiveParameter)...), e.canvasPosAt(e.cursor))
+	})
+}
+
+// The signature with the active parameter in bold, parameters are labeled
+// with their text as label offsets are not asked for
+func signatureSegments(signature lspSignature, active int) []widget.RichTextSegment {
+	plain := widget.RichTextStyleCodeInline
+	bold := widget.RichTextStyleCodeInline
+	bold.TextStyle.Bold = true
+
+	from := -1
+	var param string
+	if active >= 0 && active < len(signature.Parameters) && json.Unmarshal(signature.Parameters[active].Label, &param) == nil && len(param) > 0 {
+		from = strings.Index(signature.Label, param)
+	}
+
+	if from < 0 {
+		return []widget.RichTextSegment{&widget.TextSegment{Text: signature.Label, Style: plain}}
+	}
+
+	to := from + len(param)
+	return []widget.RichTextSegment{
+		&widget.TextSegment{Text: signature.Label[:from], Style: plain},
+		&widget.TextSegment{Text: signature.Label[from:to], Style: bold},
+		&widget.TextSegment{Text: signature.Label[to:], Style: plain},
+	}
+}
+
+// Shows the documentation of what is at the given position
+func (e *editor) hover(pos textPos, at fyne.Position) {
+	var result *struct {
+		Contents lspMarkupContent `json:"contents"`
+	}
+	e.lspRequest("textDocument/hover", pos, nil, &result, func() {
+		if result == nil || len(strings.TrimSpace(result.Contents.Value)) == 0 {
+			return
+		}
+
+		doc := widget.NewRichTextFromMarkdown(result.Contents.Value)
+		if result.Contents.Kind != "markdown" {
+			doc = widget.NewRichTextWithText(result.Contents.Value)
+		}
+		doc.Wrapping = fyne.TextWrapWord
+
+		scroll := container.NewVScroll(doc)
+		scroll.SetMinSize(fyne.NewSize(480, min(doc.MinSize().Height, 240)))
+		e.showInfo(scroll, at)
+		e.hoverInfo = true
+	})
+}
+
+// Moves to where what is at the given position is declared, declarations
+// in other files, such as the ones of the standard library, open in a tab
+func (e *editor) gotoDefinition(pos textPos) {
+	var result json.RawMessage
+	e.lspRequest("textDocument/definition", pos, nil, &result, func() {
+		var locations []lspLocation
+		if len(result) > 0 && result[0] == '[' {
+			json.Unmarshal(result, &locations)
+		} else {
+			var location lspLocation
+			if json.Unmarshal(result, &location) == nil && len(location.URI) > 0 {
+				locations = append(locations, location)
+			}
+		}
+
+		if len(locations) == 0 {
+			return
+		}
+
+		e.lsp.mu.Lock()
+		uri := e.lsp.uri
+		e.lsp.mu.Unlock()
+
+		location := locations[0]
+		if location.URI == uri {
+			e.setCursor(fromLSPPosition(e.buf.lines, location.Range.Start))
+			return
+		}
+
+		path := uriPath(location.URI)
+		if len(path) > 0 && e.onDefinition != nil {
+			e.onDefinition(path, location.Range.Start)
+		}
+	})
+}
+
+func (e *editor) showInfo(content fyne.CanvasObject, at fyne.Position) {
+	e.hideInfo()
+
+	c := fyne.CurrentApp().Driver().CanvasForObject(e)
+	if c == nil {
+		return
+	}
+
+	e.info, e.hoverInfo = widget.NewPopUp(content, c), false
+	e.info.ShowAtPosition(at)
+}
+
+func (e *editor) hideInfo() {
+	if e.info != nil {
+		e.info.Hide()
+		e.info = nil
+	}
+}
+
+func (e *editor) MouseIn(*desktop.MouseEvent) {}
+
+// Hovering over the code for a while shows its documentation
+func (e *editor) MouseMoved(ev *desktop.MouseEvent) {
+	if e.hoverTimer != nil {
+		e.hoverTimer.Stop()
+	}
+	if e.hoverInfo {
+		e.hideInfo()
+	}
+
+	if ev.Position.X < e.textOrigin().X {
+		return
+	}
+
+	pos, at := e.posAt(ev.Position), ev.AbsolutePosition
+	e.hoverTimer = time.AfterFunc(HOVER_DELAY, func() {
+		e.hover(pos, at)
+	})
+}
+
+func (e *editor) MouseOut() {
+	if e.hoverTimer != nil {
+		e.hoverTimer.Stop()
+	}
+}
+
+// Suggestions shown under the cursor, the editor keeps the focus and hands
+// the keys used to pick one over while it's visible
+type completionPopup struct {
+	editor		*editor
+	items		[]lspCompletionItem
+	matches		[]lspCompletionItem
+	start		textPos
+	selected	int
+	navigating	bool
+	list		*widget.List
+	popUp		*widget.PopUp
+}
+
+func newCompletionPopup(e *editor) *completionPopup {
+	c := &completionPopup{editor: e}
+	c.list = widget.NewList(
+		func() int {
+			return len(c.matches)
+		},
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.TextStyle = fyne.TextStyle{Monospace: true}
+			label.Truncation = fyne.TextTruncateEllipsis
+			return label
+		},
+		func(id widget.ListItemID, object fyne.CanvasObject) {
+			item := c.matches[id]
+			object.(*widget.Label).SetText(strings.TrimSpace(item.Label + "  " + item.Detail))
+		},
+	)
+
+	// Moving through the list with the arrow keys selects items as well,
+	// only clicks should complete
+	c.list.OnSelected = func(id widget.ListItemID) {
+		c.selected = id
+		if !c.navigating {
+			c.accept()
+		}
+	}
+
+	return c
+}
+
+func (c *completionPopup) visible() bool {
+	return c.popUp != nil && c.popUp.Visible()
+}
+
+func (c *completionPopup) show(items []lspCompletionItem, start textPos) {
+	c.items, c.start = items, start
+	if !c.filter() {
+		return
+	}
+
+	if c.popUp == nil {
+		canvas := fyne.CurrentApp().Driver().CanvasForObject(c.editor)
+		if canvas == nil {
+			return
+		}
+		c.popUp = widget.NewPopUp(c.list, canvas)
+	}
+
+	c.popUp.Resize(fyne.NewSize(420, 220))
+	c.popUp.ShowAtPosition(c.editor.canvasPosAt(start))
+}
+
+// Narrows the items down to the ones matching what was typed since the
+// completion started, hiding the popup when none does
+func (c *completionPopup) filter() bool {
+	e := c.editor
+	if e.cursor.row != c.start.row || e.cursor.col < c.start.col {
+		c.hide()
+		return false
+	}
+
+	query := string(e.buf.line(c.start.row)[c.start.col:e.cursor.col])
+	c.matches = c.matches[:0]
+	for _, item := range c.items {
+		_, ok := fuzzyScore(query, item.Label)
+		if ok {
+			c.matches = append(c.matches, item)
+		}
+	}
+
+	if len(c.matches) == 0 {
+		c.hide()
+		return false
+	}
+
+	c.selected = 0
+	c.list.UnselectAll()
+	c.list.Refresh()
+	c.move(0)
+	return true
+}
+
+func (c *completionPopup) move(offset int) {
+	c.navigating = true
+	c.selected = (c.selected + offset + len(c.matches)) % len(c.matches)
+	c.list.Select(c.selected)
+	c.list.ScrollTo(c.selected)
+	c.navigating = false
+}
+
+// Replaces the word being typed with the selected item
+func (c *completionPopup) accept() {
+	if c.selected >= len(c.matches) {
+		return
+	}
+
+	e := c.editor
+	item := c.matches[c.selected]
+	text := item.Label
+	switch {
+	case item.TextEdit != nil:
+		text = item.TextEdit.NewText
+	case len(item.InsertText) > 0:
+		text = item.InsertText
+	}
+
+	c.hide()
+	e.anchor = c.start
+	e.insert(text)
+	e.requestFocus()
+}
+
+func (c *completionPopup) hide() {
+	if c.popUp != nil {
+		c.popUp.Hide()
+	}
+}
+
+// Keys picking a completion, returns whether the key was handled
+func (c *completionPopup) typedKey(key *fyne.KeyEvent) bool {
+	if !c.visible() {
+		return false
+	}
+
+	switch key.Name {
+	case fyne.KeyUp:
+		c.move(-1)
+	case fyne.KeyDown:
+		c.move(1)
+	case fyne.KeyPageUp:
+		c.move(-min(c.selected, 8))
+	case fyne.KeyPageDown:
+		c.move(min(len(c.matches)-1-c.selected, 8))
+	case fyne.KeyReturn, fyne.KeyEnter, fyne.KeyTab:
+		c.accept()
+	case fyne.KeyEscape:
+		c.hide()
+	case fyne.KeyBackspace:
+		return false
+	default:
+		c.hide()
+		return false
+	}
+
+	return true
+}
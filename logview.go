@@ -0,0 +1,557 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// A key of a JSON object and its value, kept in the order they were logged.
+// Objects are decoded as []logField and arrays as []any
+type logField struct {
+	key		string
+	value	any
+}
+
+// A line of the console as the log view shows it, lines that aren't JSON
+// objects are kept as plain text
+type logRecord struct {
+	row		int
+	text	string
+	json	bool
+	time	string
+	level	string
+	rank	int
+	message	string
+	fields	[]logField
+}
+
+// The keys the time, level and message are logged with by slog, zap,
+// logrus, zerolog and others
+var (
+	logTimeKeys		= []string{"time", "ts", "timestamp", "@timestamp", "t"}
+	logLevelKeys	= []string{"level", "lvl", "severity", "@level"}
+	logMessageKeys	= []string{"msg", "message", "@message"}
+)
+
+// Levels from the least to the most severe, as ranked by the level filter
+var logLevels = []string{"Trace", "Debug", "Info", "Warn", "Error", "Fatal"}
+
+func parseLogRecord(row int, line []cell) *logRecord {
+	text := lineText(line)
+	r := &logRecord{row: row, text: text, rank: -1}
+
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "{") {
+		return r
+	}
+
+	dec := json.NewDecoder(strings.NewReader(trimmed))
+	dec.UseNumber()
+	value, err := decodeLogValue(dec)
+	fields, ok := value.([]logField)
+	if err != nil || !ok || dec.InputOffset() != int64(len(trimmed)) {
+		return r
+	}
+
+	r.json = true
+	for _, f := range fields {
+		switch {
+		case len(r.time) == 0 && containsKey(logTimeKeys, f.key):
+			r.time = logTime(f.value)
+		case len(r.level) == 0 && containsKey(logLevelKeys, f.key):
+			r.level, r.rank = logLevel(f.value)
+		case len(r.message) == 0 && containsKey(logMessageKeys, f.key):
+			r.message = logValueText(f.value, false)
+		default:
+			r.fields = append(r.fields, f)
+		}
+	}
+
+	return r
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Decodes the next value keeping the order of the keys of objects, which
+// encoding/json's maps lose
+func decodeLogValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		fields := make([]logField, 0)
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeLogValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, logField{key: key.(string), value: value})
+		}
+		_, err = dec.Token()
+		return fields, err
+	case json.Delim('['):
+		items := make([]any, 0)
+		for dec.More() {
+			value, err := decodeLogValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		_, err = dec.Token()
+		return items, err
+	}
+
+	return tok, nil
+}
+
+// Times are shown to the millisecond, whether they were logged as text or
+// as seconds or milliseconds since the epoch
+func logTime(value any) string {
+	switch v := value.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err == nil {
+			return t.Local().Format("15:04:05.000")
+		}
+		return v
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return v.String()
+		}
+		if f > 1e12 {
+			f /= 1000
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)).Format("15:04:05.000")
+	}
+
+	return logValueText(value, false)
+}
+
+// The name and rank of a level, numeric levels are the ones of bunyan and
+// pino. Unknown levels are shown as logged, ranked as info
+func logLevel(value any) (string, int) {
+	if n, ok := value.(json.Number); ok {
+		i, err := n.Int64()
+		if err == nil && i >= 10 && i <= 60 {
+			rank := int(i/10) - 1
+			return logLevels[rank], rank
+		}
+		return n.String(), 2
+	}
+
+	name := strings.ToLower(logValueText(value, false))
+	switch {
+	case strings.HasPrefix(name, "trace"):
+		return logLevels[0], 0
+	case strings.HasPrefix(name, "debug"):
+		return logLevels[1], 1
+	case strings.HasPrefix(name, "info"):
+		return logLevels[2], 2
+	case strings.HasPrefix(name, "warn"):
+		return logLevels[3], 3
+	case strings.HasPrefix(name, "err"):
+		return logLevels[4], 4
+	case strings.HasPrefix(name, "fatal"), strings.HasPrefix(name, "panic"), strings.HasPrefix(name, "dpanic"), strings.HasPrefix(name, "crit"):
+		return logLevels[5], 5
+	}
+
+	return logValueText(value, false), 2
+}
+
+// Values as they are shown in a cell, nested objects are either collapsed
+// or written out in full
+func logValueText(value any, collapse bool) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return "null"
+	case []logField:
+		if collapse {
+			return "{…}"
+		}
+		parts := make([]string, 0, len(v))
+		for _, f := range v {
+			parts = append(parts, f.key+": "+logValueText(f.value, false))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case []any:
+		if collapse && len(v) > 0 {
+			return "[…]"
+		}
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, logValueText(item, false))
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+
+	return ""
+}
+
+// The attributes of a record with the keys of nested objects joined by
+// dots, as the filter looks them up
+func flattenFields(prefix string, fields []logField, flat []logField) []logField {
+	for _, f := range fields {
+		if nested, ok := f.value.([]logField); ok && len(nested) > 0 {
+			flat = flattenFields(prefix+f.key+".", nested, flat)
+			continue
+		}
+		flat = append(flat, logField{key: prefix + f.key, value: f.value})
+	}
+
+	return flat
+}
+
+// The attributes as key=value pairs, nested objects are collapsed or
+// flattened
+func (r *logRecord) attributes(collapse bool) string {
+	fields := r.fields
+	if !collapse {
+		fields = flattenFields("", r.fields, nil)
+	}
+
+	parts := make([]string, 0, len(fields))
+	for _, f := range fields {
+		value := logValueText(f.value, collapse)
+		if _, ok := f.value.(string); ok && strings.ContainsAny(value, " \t\"=") {
+			value = strconv.Quote(value)
+		}
+		parts = append(parts, f.key+"="+value)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Whether the record passes the filter. Terms are separated by spaces and
+// must all match: key=value terms match attributes whose value contains
+// the value, any other term matches the message or an attribute's value.
+// Case is ignored
+func (r *logRecord) matches(terms []string) bool {
+	if !r.json {
+		for _, term := range terms {
+			if strings.Contains(term, "=") || !strings.Contains(strings.ToLower(r.text), term) {
+				return false
+			}
+		}
+		return true
+	}
+
+	flat := flattenFields("", r.fields, nil)
+	for _, term := range terms {
+		key, value, keyed := strings.Cut(term, "=")
+		found := !keyed && strings.Contains(strings.ToLower(r.message), term)
+		for _, f := range flat {
+			if found {
+				break
+			}
+			text := strings.ToLower(logValueText(f.value, false))
+			if keyed {
+				found = strings.EqualFold(f.key, key) && strings.Contains(text, value)
+			} else {
+				found = strings.Contains(text, term)
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Whether most of the first lines printed are JSON objects. The callers
+// hold the console's lock
+func (c *console) looksLikeLogs() bool {
+	lines, objects := 0, 0
+	for i := 0; i < c.term.count && lines < LOG_DETECT_LINES; i++ {
+		line := c.term.line(i)
+		if len(strings.TrimSpace(lineText(line))) == 0 {
+			continue
+		}
+
+		lines++
+		if parseLogRecord(0, line).json {
+			objects++
+		}
+	}
+
+	return objects > 0 && objects*2 >= lines
+}
+
+const (
+	logColumnTime = iota
+	logColumnLevel
+	logColumnMessage
+	logColumnAttributes
+)
+
+var (
+	logColumnNames	= []string{"Time", "Level", "Message", "Attributes"}
+	logColumnWidths	= []float32{110, 70, 360, 600}
+)
+
+// Shows JSON lines printed by the program as a table of their time, level,
+// message and attributes, which can be filtered by level or attribute.
+// Lines that aren't JSON are shown as they were printed
+type logView struct {
+	console		*console
+	// Records by row, the lines that didn't change since they were parsed
+	// aren't parsed again
+	records		map[int]*logRecord
+	dropped		int
+	shown		[]*logRecord
+	// Whether every record is filtered again on the next update, rather
+	// than the ones of the lines changed since the last one
+	refilter	bool
+	columns		[]int
+	level		*widget.Select
+	query		*findEntry
+	columnCheck	*widget.CheckGroup
+	collapse	*widget.Check
+	table		*widget.Table
+	details		*widget.Label
+	*fyne.Container
+}
+
+func newLogView(c *console, onShortcut func(shortcut fyne.Shortcut)) *logView {
+	v := &logView{
+		console: c,
+		records: make(map[int]*logRecord),
+		columns: []int{logColumnTime, logColumnLevel, logColumnMessage, logColumnAttributes},
+		query: newFindEntry("Filter, e.g. user=42 timeout"),
+		details: widget.NewLabel(""),
+	}
+
+	v.level = widget.NewSelect(append([]string{"All levels"}, logLevels...), func(string) {
+		v.refilter = true
+		v.update()
+	})
+	v.level.SetSelectedIndex(0)
+	v.query.OnChanged = func(string) {
+		v.refilter = true
+		v.update()
+	}
+	v.query.onShortcut = onShortcut
+	v.columnCheck = widget.NewCheckGroup(logColumnNames, func(selected []string) {
+		v.columns = v.columns[:0]
+		for i, name := range logColumnNames {
+			if containsKey(selected, name) {
+				v.columns = append(v.columns, i)
+			}
+		}
+		v.layoutColumns()
+	})
+	v.columnCheck.Horizontal = true
+	v.columnCheck.Selected = append([]string{}, logColumnNames...)
+	v.collapse = widget.NewCheck("Collapse nested", func(bool) {
+		v.table.Refresh()
+	})
+	v.collapse.Checked = true
+
+	v.table = widget.NewTableWithHeaders(v.size, v.createCell, v.updateCell)
+	v.table.ShowHeaderColumn = false
+	v.table.CreateHeader = func() fyne.CanvasObject {
+		return widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	}
+	v.table.UpdateHeader = func(id widget.TableCellID, template fyne.CanvasObject) {
+		if id.Col >= 0 && id.Col < len(v.columns) {
+			template.(*widget.Label).SetText(logColumnNames[v.columns[id.Col]])
+		}
+	}
+	v.table.OnSelected = func(id widget.TableCellID) {
+		v.showDetails(id.Row)
+	}
+	v.layoutColumns()
+
+	v.details.Wrapping = fyne.TextWrapWord
+	v.details.TextStyle.Monospace = true
+	v.details.Hide()
+
+	v.Container = container.NewBorder(
+		container.NewVBox(
+			container.NewBorder(nil, nil, v.level, nil, v.query),
+			container.NewHBox(v.columnCheck, v.collapse),
+		),
+		container.NewVScroll(v.details),
+		nil,
+		nil,
+		v.table,
+	)
+	v.Container.Hide()
+
+	return v
+}
+
+func (v *logView) size() (int, int) {
+	return len(v.shown), len(v.columns)
+}
+
+func (v *logView) createCell() fyne.CanvasObject {
+	label := widget.NewLabel("")
+	label.Truncation = fyne.TextTruncateEllipsis
+	return label
+}
+
+func (v *logView) updateCell(id widget.TableCellID, template fyne.CanvasObject) {
+	label := template.(*widget.Label)
+	if id.Row >= len(v.shown) || id.Col >= len(v.columns) {
+		return
+	}
+
+	r := v.shown[id.Row]
+	text, importance, monospace := "", widget.MediumImportance, false
+	switch v.columns[id.Col] {
+	case logColumnTime:
+		text = r.time
+	case logColumnLevel:
+		text, importance = r.level, logImportance(r.rank)
+	case logColumnMessage:
+		text, monospace = r.message, !r.json
+		if !r.json {
+			text = r.text
+		}
+	case logColumnAttributes:
+		text = r.attributes(v.collapse.Checked)
+	}
+
+	if label.Text != text || label.Importance != importance || label.TextStyle.Monospace != monospace {
+		label.Text = text
+		label.Importance = importance
+		label.TextStyle.Monospace = monospace
+		label.Refresh()
+	}
+}
+
+// Levels are colored by how severe they are
+func logImportance(rank int) widget.Importance {
+	switch {
+	case rank < 0:
+		return widget.MediumImportance
+	case rank <= 1:
+		return widget.LowImportance
+	case rank == 2:
+		return widget.SuccessImportance
+	case rank == 3:
+		return widget.WarningImportance
+	}
+
+	return widget.DangerImportance
+}
+
+func (v *logView) layoutColumns() {
+	for i, col := range v.columns {
+		v.table.SetColumnWidth(i, logColumnWidths[col])
+	}
+	v.table.Refresh()
+}
+
+// Shows the selected record with its nested objects indented
+func (v *logView) showDetails(row int) {
+	if row < 0 || row >= len(v.shown) {
+		return
+	}
+
+	r := v.shown[row]
+	text := r.text
+	var buf bytes.Buffer
+	if r.json && json.Indent(&buf, []byte(strings.TrimSpace(r.text)), "", "  ") == nil {
+		text = buf.String()
+	}
+
+	v.details.SetText(text)
+	v.details.Show()
+}
+
+// Parses the lines changed since the last update and filters their
+// records, the other records are filtered again only when the filter
+// changes
+func (v *logView) update() {
+	if v.table == nil {
+		return
+	}
+
+	minRank := v.level.SelectedIndex() - 1
+	terms := strings.Fields(strings.ToLower(v.query.Text))
+
+	c := v.console
+	c.mu.Lock()
+	from := c.logsFrom
+	c.logsFrom = c.term.dropped + c.term.count
+	if from == 0 {
+		// The console was cleared, rows start over from zero
+		clear(v.records)
+		v.dropped = 0
+	}
+	for ; v.dropped < c.term.dropped; v.dropped++ {
+		delete(v.records, v.dropped)
+	}
+
+	for i := max(from-c.term.dropped, 0); i < c.term.count; i++ {
+		row := c.term.dropped + i
+		v.records[row] = parseLogRecord(row, c.term.line(i))
+	}
+	if v.refilter {
+		from, v.refilter = c.term.dropped, false
+	}
+
+	gone := sort.Search(len(v.shown), func(i int) bool {
+		return v.shown[i].row >= c.term.dropped
+	})
+	kept := sort.Search(len(v.shown), func(i int) bool {
+		return v.shown[i].row >= from
+	})
+	v.shown = append(v.shown[:0], v.shown[gone:max(gone, kept)]...)
+	for row := max(from, c.term.dropped); row < c.term.dropped+c.term.count; row++ {
+		r := v.records[row]
+		if minRank >= 0 && r.rank < minRank || len(terms) > 0 && !r.matches(terms) {
+			continue
+		}
+		if !r.json && len(strings.TrimSpace(r.text)) == 0 {
+			continue
+		}
+		v.shown = append(v.shown, r)
+	}
+	follow := c.follow
+	c.mu.Unlock()
+
+	v.table.Refresh()
+	if follow {
+		v.table.ScrollToBottom()
+	}
+}
@@ -0,0 +1,78 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"fyne.io/fyne/v2/test"
+)
+
+// Updating after every write only parses the lines that changed, what is
+// shown ends up as if every line was parsed once at the end
+func TestLogViewUpdate(t *testing.T) {
+	test.NewApp()
+	queueUI(t)
+
+	tests := []struct {
+		name		string
+		maxLines	int
+		level		int
+		query		string
+		writes		[]string
+	}{
+		{name: "appended records", writes: []string{`{"level":"info","msg":"a"}` + "\n", `{"level":"error","msg":"b"}` + "\n", "plain\n"}},
+		{name: "record printed over writes", writes: []string{`{"level":"info",`, `"msg":"a"}` + "\n", `{"msg":"b"}` + "\n"}},
+		{name: "level filter", level: 4, writes: []string{`{"level":"info","msg":"a"}` + "\n", `{"level":"error","msg":"b"}` + "\n", `{"level":"fatal","msg":"c"}` + "\n"}},
+		{name: "query", query: "user=4", writes: []string{`{"msg":"a","user":42}` + "\n", `{"msg":"b","user":7}` + "\n", `{"msg":"c","user":4}` + "\n"}},
+		{name: "lines dropped", maxLines: 3, query: "x", writes: []string{"x1\nx2\n", "y\nx3\n", "x4\nx5\nx6\n"}},
+		{name: "console cleared", writes: []string{`{"msg":"a"}` + "\n", "\x1b[2J", `{"msg":"b"}` + "\n"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newView := func() *logView {
+				c := playgroundConsole()
+				if test.maxLines > 0 {
+					c.term.setLimits(test.maxLines, 1<<20)
+					c.term.reset()
+				}
+				v := newLogView(c, nil)
+				v.level.SetSelectedIndex(test.level)
+				v.query.SetText(test.query)
+				return v
+			}
+			rows := func(v *logView) []int {
+				rows := make([]int, 0)
+				for _, r := range v.shown {
+					rows = append(rows, r.row)
+				}
+				return rows
+			}
+
+			v := newView()
+			for i, w := range test.writes {
+				v.console.Write([]byte(w))
+				v.console.flush()
+				v.update()
+
+				want := newView()
+				want.console.Write([]byte(strings.Join(test.writes[:i+1], "")))
+				want.console.flush()
+				want.update()
+				if !reflect.DeepEqual(rows(v), rows(want)) {
+					t.Errorf("after write %d got rows %v, want %v", i, rows(v), rows(want))
+				}
+				for j := range v.shown {
+					if j < len(want.shown) && v.shown[j].text != want.shown[j].text {
+						t.Errorf("after write %d got %q, want %q", i, v.shown[j].text, want.shown[j].text)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+var errLSPClosed = errors.New("language server is not running")
+
+type lspError struct {
+	Code	int		`json:"code"`
+	Message	string	`json:"message"`
+}
+
+func (l *lspError) Error() string {
+	return fmt.Sprintf("language server: %s (%d)", l.Message, l.Code)
+}
+
+// A JSON-RPC 2.0 request, response or notification
+type lspMessage struct {
+	JSONRPC	string			`json:"jsonrpc"`
+	ID		json.RawMessage	`json:"id,omitempty"`
+	Method	string			`json:"method,omitempty"`
+	Params	json.RawMessage	`json:"params,omitempty"`
+	Result	json.RawMessage	`json:"result,omitempty"`
+	Error	*lspError		`json:"error,omitempty"`
+}
+
+type lspPosition struct {
+	Line		int	`json:"line"`
+	Character	int	`json:"character"`
+}
+
+type lspRange struct {
+	Start	lspPosition	`json:"start"`
+	End		lspPosition	`json:"end"`
+}
+
+type lspLocation struct {
+	URI		string		`json:"uri"`
+	Range	lspRange	`json:"range"`
+}
+
+type lspDiagnostic struct {
+	Range		lspRange	`json:"range"`
+	Severity	int			`json:"severity"`
+	Source		string		`json:"source"`
+	Message		string		`json:"message"`
+}
+
+type lspTextEdit struct {
+	Range	lspRange	`json:"range"`
+	NewText	string		`json:"newText"`
+}
+
+type lspCompletionItem struct {
+	Label		string			`json:"label"`
+	Detail		string			`json:"detail"`
+	InsertText	string			`json:"insertText"`
+	TextEdit	*lspTextEdit	`json:"textEdit"`
+}
+
+type lspMarkupContent struct {
+	Kind	string	`json:"kind"`
+	Value	string	`json:"value"`
+}
+
+// Parameter labels are either a substring of the signature label or its
+// start and end offsets
+type lspParameter struct {
+	Label json.RawMessage `json:"label"`
+}
+
+type lspSignature struct {
+	Label		string			`json:"label"`
+	Parameters	[]lspParameter	`json:"parameters"`
+}
+
+type lspSignatureHelp struct {
+	Signatures		[]lspSignature	`json:"signatures"`
+	ActiveSignature	int				`json:"activeSignature"`
+	ActiveParameter	int				`json:"activeParameter"`
+}
+
+// Speaks the language server protocol over the standard input and output
+// of a language server process
+type lspClient struct {
+	cmd				*exec.Cmd
+	stdin			io.WriteCloser
+	writeMu			sync.Mutex
+	mu				sync.Mutex
+	nextID			int
+	pending			map[int]chan *lspMessage
+	closed			bool
+	onNotification	func(method string, params json.RawMessage)
+}
+
+func startLSPClient(cmd *exec.Cmd, onNotification func(method string, params json.RawMessage)) (*lspClient, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &lspClient{cmd: cmd, stdin: stdin, pending: make(map[int]chan *lspMessage), onNotification: onNotification}
+	go client.read(stdout)
+	return client, nil
+}
+
+// Dispatches what the server sends until it exits, requests made by the
+// server are answered with an empty result as none of them is supported
+func (l *lspClient) read(stdout io.Reader) {
+	r := textproto.NewReader(bufio.NewReader(stdout))
+	for {
+		header, err := r.ReadMIMEHeader()
+		if err != nil {
+			break
+		}
+
+		length, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil {
+			break
+		}
+
+		body := make([]byte, length)
+		_, err = io.ReadFull(r.R, body)
+		if err != nil {
+			break
+		}
+
+		msg := &lspMessage{}
+		err = json.Unmarshal(body, msg)
+		if err != nil {
+			logger.Warn("lspClient.read()", zap.Error(err))
+			continue
+		}
+
+		switch {
+		case len(msg.ID) > 0 && len(msg.Method) > 0:
+			l.write(&lspMessage{JSONRPC: "2.0", ID: msg.ID, Result: json.RawMessage("null")})
+		case len(msg.ID) > 0:
+			id, _ := strconv.Atoi(string(msg.ID))
+			l.mu.Lock()
+			ch, ok := l.pending[id]
+			delete(l.pending, id)
+			l.mu.Unlock()
+			if ok {
+				ch <- msg
+			}
+		case l.onNotification != nil:
+			l.onNotification(msg.Method, msg.Params)
+		}
+	}
+
+	l.mu.Lock()
+	l.closed = true
+	for id, ch := range l.pending {
+		close(ch)
+		delete(l.pending, id)
+	}
+	l.mu.Unlock()
+}
+
+func (l *lspClient) write(msg *lspMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	_, err = fmt.Fprintf(l.stdin, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+func (l *lspClient) notify(method string, params any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	return l.write(&lspMessage{JSONRPC: "2.0", Method: method, Params: data})
+}
+
+// Sends a request and waits for its response, the result is decoded into
+// the given value unless it is nil
+func (l *lspClient) call(ctx context.Context, method string, params, result any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return errLSPClosed
+	}
+	l.nextID++
+	id := l.nextID
+	ch := make(chan *lspMessage, 1)
+	l.pending[id] = ch
+	l.mu.Unlock()
+
+	err = l.write(&lspMessage{JSONRPC: "2.0", ID: json.RawMessage(strconv.Itoa(id)), Method: method, Params: data})
+	if err != nil {
+		l.mu.Lock()
+		delete(l.pending, id)
+		l.mu.Unlock()
+		return err
+	}
+
+	select {
+	case msg, ok := <-ch:
+		switch {
+		case !ok:
+			return errLSPClosed
+		case msg.Error != nil:
+			return msg.Error
+		case result == nil || len(msg.Result) == 0:
+			return nil
+		}
+
+		return json.Unmarshal(msg.Result, result)
+	case <-ctx.Done():
+		l.mu.Lock()
+		delete(l.pending, id)
+		l.mu.Unlock()
+		l.notify("$/cancelRequest", map[string]any{"id": id})
+		return ctx.Err()
+	}
+}
+
+// Asks the server to exit, and kills it if it doesn't do so in time
+func (l *lspClient) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), LSP_TIMEOUT)
+	defer cancel()
+
+	err := l.call(ctx, "shutdown", nil, nil)
+	if err == nil {
+		l.notify("exit", nil)
+	}
+	l.stdin.Close()
+
+	done := make(chan struct{})
+	go func() {
+		l.cmd.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		l.cmd.Process.Kill()
+	}
+}
+
+func fileURI(path string) string {
+	path = filepath.ToSlash(path)
+	if runtime.GOOS == "windows" {
+		path = "/" + path
+	}
+
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+
+	path := u.Path
+	if runtime.GOOS == "windows" {
+		path = strings.TrimPrefix(path, "/")
+	}
+
+	return filepath.FromSlash(path)
+}
+
+// Positions are sent as UTF-16 code units, the default encoding of the
+// protocol, while the editor counts runes
+func toLSPPosition(lines [][]rune, pos textPos) lspPosition {
+	character := 0
+	if pos.row < len(lines) {
+		for _, r := range lines[pos.row][:min(pos.col, len(lines[pos.row]))] {
+			character += utf16Len(r)
+		}
+	}
+
+	return lspPosition{Line: pos.row, Character: character}
+}
+
+func fromLSPPosition(lines [][]rune, pos lspPosition) textPos {
+	if pos.Line >= len(lines) {
+		return textPos{row: pos.Line, col: pos.Character}
+	}
+
+	col, units := 0, 0
+	for col < len(lines[pos.Line]) && units < pos.Character {
+		units += utf16Len(lines[pos.Line][col])
+		col++
+	}
+
+	return textPos{row: pos.Line, col: col}
+}
+
+// Runes outside the basic multilingual plane take a surrogate pair
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+
+	return 1
+}
@@ -6,20 +6,21 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/data/binding"
-	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
@@ -29,12 +30,63 @@ import (
 const (
 	APP_DIR			= "run-go"
 	GOS_DIR			= "gos"
+	GOPLS_DIR		= "gopls"
+	SCRATCH_DIR		= "scratch"
 	SNIPPETS_DIR	= "snippets"
-
-	ALT_T		= "CustomDesktop:Alt+T"
-	ALT_S		= "CustomDesktop:Alt+S"
-	ALT_O		= "CustomDesktop:Alt+O"
-	ALT_RETURN	= "CustomDesktop:Alt+Return"
+	RUN_CONFIG_FILE	= "run.json"
+	PORTABLE_FILE	= "portable"
+	PORTABLE_DIR	= "run-go-data"
+	MIGRATED_FILE	= ".legacy-migrated"
+	SESSION_FILE	= "session.json"
+	AUTOSAVE_FILE	= "session.autosave.json"
+	SESSION_LOCK	= "session.lock"
+
+	SETTINGS_FILE	= "settings.json"
+	KEYMAP_FILE		= "keymap.json"
+
+	AUTOSAVE_INTERVAL	= 30 * time.Second
+	AUTOSAVE_OFF		= "off"
+	AUTOSAVE_IDLE		= "idle"
+	AUTOSAVE_FOCUS		= "focus"
+	UNSAVED_MARK		= "•"
+	CLOSED_TABS_LIMIT	= 20
+	TAB_WIDTH			= 4
+
+	GOPLS_MODULE		= "golang.org/x/tools/gopls"
+	LSP_TIMEOUT			= 10 * time.Second
+	LSP_CHANGE_DELAY	= 250 * time.Millisecond
+	HOVER_DELAY			= 600 * time.Millisecond
+
+	SEARCH_MATCHES_LIMIT	= 10000
+	HISTORY_LIMIT			= 1000
+	HISTORY_GROUP_DELAY		= time.Second
+
+	STRUCTURE_DELAY		= 300 * time.Millisecond
+	OUTLINE_WIDTH		= 220
+	FOLD_OPEN_MARK		= "▾"
+	FOLD_CLOSED_MARK	= "▸"
+	FOLDED_MARK			= "⋯"
+
+	KEYBINDINGS_DEFAULT	= "default"
+	KEYBINDINGS_VIM		= "vim"
+	KEYBINDINGS_EMACS	= "emacs"
+	KILL_RING_LIMIT		= 60
+
+	TYPE_CHECK_DELAY	= 500 * time.Millisecond
+	VET_TIMEOUT			= time.Minute
+	PROBLEMS_HEIGHT		= 140
+	PROBLEMS_MARK		= "⚠"
+
+	ESCAPE_LIMIT			= 64
+	CONSOLE_REFRESH_DELAY	= 100 * time.Millisecond
+	CONSOLE_OUTPUT_FILE		= "output.txt"
+	EMBED_HEIGHT			= 320
+	LOG_DETECT_LINES		= 20
+
+	RUN_HISTORY_LIMIT	= 50
+	RUN_OUTPUT_LIMIT	= 1 << 20
+	RUN_BUILD_FAILED	= -2
+	DIFF_LIMIT			= 4000000
 
 	GO_URL = "https://go.dev"
 )
@@ -43,14 +95,35 @@ var (
 	errRequestFailed	= errors.New("failed to perform http request")
 	errUnexpectedStatus = errors.New("received an unexpected http status code")
 
-	altT		= &desktop.CustomShortcut{KeyName: fyne.KeyT, Modifier: fyne.KeyModifierAlt}
-	altS		= &desktop.CustomShortcut{KeyName: fyne.KeyS, Modifier: fyne.KeyModifierAlt}
-	altO		= &desktop.CustomShortcut{KeyName: fyne.KeyO, Modifier: fyne.KeyModifierAlt}
-	altReturn	= &desktop.CustomShortcut{KeyName: fyne.KeyReturn, Modifier: fyne.KeyModifierAlt}
+	logger = zap.NewNop()
 
-	logger *zap.Logger
+	// Hands fn to the goroutine that handles the window's input events,
+	// which is where widgets are changed. Set up by main, until then fn
+	// runs right away
+	uiQueue		= func(fn func()) { fn() }
+	uiQueueMu	sync.Mutex
 )
 
+// Work done in the background changes widgets through here, so it doesn't
+// race with what the user is typing. Safe to call from any goroutine
+func runOnUI(fn func()) {
+	uiQueueMu.Lock()
+	queue := uiQueue
+	uiQueueMu.Unlock()
+
+	queue(fn)
+}
+
+// Replaces where runOnUI hands its work, returning where it went before
+func setUIQueue(queue func(fn func())) func(fn func()) {
+	uiQueueMu.Lock()
+	defer uiQueueMu.Unlock()
+
+	previous := uiQueue
+	uiQueue = queue
+	return previous
+}
+
 var aboutMD = `
 RunGo is a free cross-platform Go playground that allows users to experiment,
 prototype and get instant feedback. It provides support for running Go versions
@@ -72,34 +145,47 @@ the [Contributing](https://github.com/itsksrof/run-go/tree/master#contributing)
 Copyright (c) 2023 Kevin Suñer
 `
 
-func init() {
-	homeDir, err := os.UserHomeDir()
+// Resolves the directories RunGo keeps its files in, creates them and the
+// log, and exposes them through the RUNGO_*_DIR variables. Errors are
+// returned so they are shown once the window exists, until the log is built
+// logging is discarded
+func setupDirs(dataDir string, portable bool) (appDirs, error) {
+	dirs, err := resolveAppDirs(dataDir, portable)
 	if err != nil {
-		log.Fatalln(err)
+		return dirs, err
 	}
 
 	appDirs := []string{
-		filepath.Join(homeDir, APP_DIR, GOS_DIR),
-		filepath.Join(homeDir, APP_DIR, SNIPPETS_DIR),
+		dirs.config,
+		filepath.Join(dirs.data, SNIPPETS_DIR),
+		filepath.Join(dirs.cache, GOS_DIR),
 	}
-	
+
 	for _, appDir := range appDirs {
-		_, err = os.ReadDir(appDir)
-		if os.IsNotExist(err) {
-			err = os.MkdirAll(appDir, 0755)
-			if err != nil {
-				log.Fatalln("os.MkdirAll()", zap.Error(err))
-			}
+		err = os.MkdirAll(appDir, 0755)
+		if err != nil {
+			return dirs, err
 		}
 	}
 
 	zapLogger := zap.NewProductionConfig()
-	zapLogger.OutputPaths = []string{filepath.Join(homeDir, APP_DIR, "run-go.log")}
-	logger, err = zapLogger.Build()
+	zapLogger.OutputPaths = []string{filepath.Join(dirs.cache, "run-go.log")}
+	built, err := zapLogger.Build()
 	if err != nil {
-		log.Fatalln(err)
+		return dirs, err
 	}
+	logger = built
+
+	configDirErr := os.Setenv("RUNGO_CONFIG_DIR", dirs.config)
+	dataDirErr := os.Setenv("RUNGO_DATA_DIR", dirs.data)
+	cacheDirErr := os.Setenv("RUNGO_CACHE_DIR", dirs.cache)
+	return dirs, errors.Join(configDirErr, dataDirErr, cacheDirErr)
+}
 
+// Downloads the latest Go version unless it's already available, and makes
+// it the one used to run code. When go.dev can't be reached the most recent
+// installed version is used instead
+func setupGoVersion() error {
 	getLatestGoVersion := func() (string, error) {
 		res, err := http.Get(fmt.Sprintf("%s/%s", GO_URL, "VERSION?m=text"))
 		if err != nil {
@@ -121,73 +207,31 @@ func init() {
 
 	version, err := getLatestGoVersion()
 	if err != nil {
-		logger.Fatal("getLatestGoVersion()", zap.Error(err))
-	}
-
-	longVersion := fmt.Sprintf("%s.%s-%s", version, runtime.GOOS, runtime.GOARCH)
-	_, err = os.Stat(filepath.Join(homeDir, APP_DIR, GOS_DIR, longVersion))
-	if os.IsNotExist(err) {
-		switch runtime.GOOS {
-		case "windows":
-			err = getGoSource(fmt.Sprintf("%s.%s", longVersion, "zip"), filepath.Join(homeDir, APP_DIR))
-			if err != nil {
-				logger.Fatal("getGoSource()", zap.Error(err))
-			}
-	
-			err = uncompressZipFile(
-				filepath.Join(homeDir, APP_DIR, fmt.Sprintf("%s.%s", longVersion, "zip")), 
-				filepath.Join(homeDir, APP_DIR, GOS_DIR),
-			)
-			if err != nil {
-				logger.Fatal("uncompressZipFile()", zap.Error(err))
-			}
-		default:
-			err = getGoSource(fmt.Sprintf("%s.%s", longVersion, "tar.gz"), filepath.Join(homeDir, APP_DIR))
-			if err != nil {
-				logger.Fatal("getGoSource()", zap.Error(err))
-			}
-
-			err = uncompressTarFile(
-				filepath.Join(homeDir, APP_DIR, fmt.Sprintf("%s.%s", longVersion, "tar.gz")),
-				filepath.Join(homeDir, APP_DIR, GOS_DIR),
-			)
-			if err != nil {
-				logger.Fatal("uncompressTarFile()", zap.Error(err))
-			}
-		}
-
-		err = os.Rename(filepath.Join(homeDir, APP_DIR, GOS_DIR, "go"), filepath.Join(homeDir, APP_DIR, GOS_DIR, longVersion))
-		if err != nil {
-			logger.Fatal("os.Rename()", zap.Error(err))
-		}
-	}
-
-	setEnvironment := func() error {
-		appDirErr := os.Setenv("RUNGO_APP_DIR", filepath.Join(homeDir, APP_DIR))
-		goVerErr := os.Setenv("RUNGO_GO_VER", version)
-		goBinErr := os.Setenv("RUNGO_GO_BIN", filepath.Join(homeDir, APP_DIR, GOS_DIR, longVersion, "bin", "go"))
-		if runtime.GOOS == "windows" {
-			goBinErr = os.Setenv("RUNGO_GO_BIN", filepath.Join(homeDir, APP_DIR, GOS_DIR, longVersion, "bin", "go.exe"))
-			return errors.Join(appDirErr, goVerErr, goBinErr)
+		installed, installedErr := latestInstalledGoVersion()
+		if installedErr != nil {
+			return errors.Join(err, installedErr)
 		}
 
-		return errors.Join(appDirErr, goVerErr, goBinErr)
+		logger.Warn("getLatestGoVersion()", zap.Error(err), zap.String("fallback", installed))
+		return useGoVersion(installed)
 	}
 
-	err = setEnvironment()
+	err = installGoVersion(version)
 	if err != nil {
-		logger.Fatal("setEnvironment()", zap.Error(err))
+		return err
 	}
+
+	return useGoVersion(version)
 }
 
-func appLayout(tabs *container.AppTabs, shortcutsBtn, aboutBtn, versionBtn *widget.Button) *fyne.Container {
+func appLayout(tabs *container.DocTabs, shortcutsBtn, aboutBtn, settingsBtn, versionBtn *widget.Button) *fyne.Container {
 	return container.NewBorder(
 		nil,
 		container.NewPadded(
 			container.NewGridWithColumns(8,
 				shortcutsBtn,
 				aboutBtn,
-				layout.NewSpacer(),
+				settingsBtn,
 				layout.NewSpacer(),
 				layout.NewSpacer(),
 				layout.NewSpacer(),
@@ -202,32 +246,193 @@ func appLayout(tabs *container.AppTabs, shortcutsBtn, aboutBtn, versionBtn *widg
 }
 
 func main() {
+	dataDir := flag.String("data-dir", "", "store snippets, Go versions and settings in this directory")
+	portable := flag.Bool("portable", false, "store everything next to the executable")
+	flag.Parse()
+
 	myApp := app.New()
 	myWindow := myApp.NewWindow("RunGo")
-	
-	appTabs := newAppTabs(myWindow)
+	if queue, ok := myWindow.(interface{ QueueEvent(fn func()) }); ok {
+		setUIQueue(func(fn func()) {
+			// The queue is closed along with the window, there is nothing
+			// left to update by then
+			defer func() { recover() }()
+			queue.QueueEvent(fn)
+		})
+	}
 
-	var shortcutsModal, aboutModal, versionModal *widget.PopUp
-	shortcutsBtn := widget.NewButtonWithIcon("Shortcuts", theme.ContentRedoIcon(), func() {
-		shortcutsModal.Resize(fyne.NewSize(440, 540))
-		shortcutsModal.Show()
-	})
-	aboutBtn := widget.NewButtonWithIcon("About RunGo", theme.InfoIcon(), func() {
-		aboutModal.Resize(fyne.NewSize(440, 540))
-		aboutModal.Show()
-	})
-	versionBtn := widget.NewButtonWithIcon(os.Getenv("RUNGO_GO_VER"), theme.ConfirmIcon(), func() {
-		versionModal.Resize(fyne.NewSize(440, 540))
-		versionModal.Show()
-	})
+	// Without its directories RunGo would write its files wherever it was
+	// started from, so it only explains why it can't start
+	dirs, err := setupDirs(*dataDir, *portable)
+	if err != nil {
+		errDialog := newErrorDialog(myWindow, "Setting up directories", err)
+		errDialog.SetOnClosed(myApp.Quit)
+		errDialog.Show()
+		myWindow.Resize(fyne.NewSize(640, 360))
+		myWindow.ShowAndRun()
+		return
+	}
 
-	shortcutsModal = newShortcutsModal(myWindow.Canvas(), customShortcuts)
-	aboutModal = newAboutModal(myWindow.Canvas(), aboutMD)
-	versionModal = newVersionModal(myWindow, versionBtn, binding.NewString())
+	err = loadSettings()
+	if err != nil {
+		showError(myWindow, "Loading settings", err)
+	}
 	
-	myWindow.Canvas().AddShortcut(altT, appTabs.TypedShortcut)
-	myWindow.SetContent(appLayout(appTabs.AppTabs, shortcutsBtn, aboutBtn, versionBtn))
+	dispatcher := newDispatcher(myWindow)
+	appTabs := newAppTabs(myWindow, dispatcher)
+
+	versionBtn := widget.NewButtonWithIcon(os.Getenv("RUNGO_GO_VER"), theme.ConfirmIcon(), nil)
+	shortcutsModal := newShortcutsModal(myWindow, dispatcher)
+	paletteModal := newPaletteModal(myWindow, dispatcher)
+	aboutModal := newAboutModal(myWindow.Canvas(), aboutMD)
+	settingsModal := newSettingsModal(myWindow)
+	versionModal := newVersionModal(myWindow, versionBtn, binding.NewString())
+
+	// The bottom bar buttons run the same commands as the palette
+	dispatcher.register(appTabs.commands()...)
+	dispatcher.register(
+		&command{id: "palette", info: "Open command palette", keys: []string{"Ctrl+Shift+P"}, run: paletteModal.show},
+		&command{id: "shortcuts", info: "Open shortcuts modal", keys: []string{"Ctrl+Shift+K"}, run: shortcutsModal.show},
+		&command{id: "settings", info: "Open settings modal", keys: []string{"Ctrl+Comma"}, run: settingsModal.show},
+		&command{id: "version", info: "Switch Go version", run: func() {
+			versionModal.Resize(fyne.NewSize(440, 540))
+			versionModal.Show()
+		}},
+		&command{id: "about", info: "About RunGo", run: func() {
+			aboutModal.Resize(fyne.NewSize(440, 540))
+			aboutModal.Show()
+		}},
+	)
+
+	err = dispatcher.loadKeymap()
+	if err != nil {
+		showError(myWindow, "Loading keymap", err)
+	}
+
+	err = dispatcher.bind()
+	if err != nil {
+		showError(myWindow, "Loading keymap", err)
+	}
+
+	shortcutsBtn := widget.NewButtonWithIcon("Shortcuts", theme.ContentRedoIcon(), dispatcher.command("shortcuts").run)
+	aboutBtn := widget.NewButtonWithIcon("About RunGo", theme.InfoIcon(), dispatcher.command("about").run)
+	settingsBtn := widget.NewButtonWithIcon("Settings", theme.SettingsIcon(), dispatcher.command("settings").run)
+	versionBtn.OnTapped = dispatcher.command("version").run
+
+	myWindow.SetContent(appLayout(appTabs.DocTabs, shortcutsBtn, aboutBtn, settingsBtn, versionBtn))
+	myWindow.SetCloseIntercept(func() {
+		unsaved := appTabs.unsavedTabs()
+		if len(unsaved) == 0 {
+			myWindow.Close()
+			return
+		}
+
+		names := make([]string, 0, len(unsaved))
+		for _, tab := range unsaved {
+			names = append(names, tab.title)
+		}
+
+		newUnsavedDialog(
+			fmt.Sprintf("The following tabs have unsaved changes: %s.\nDo you want to save them before quitting?", strings.Join(names, ", ")),
+			func() {
+				for _, tab := range unsaved {
+					// Quitting waits until the tab is given a snippet name
+					if !tab.hasSnippet() {
+						appTabs.Select(tab.TabItem)
+						tab.saveModal.show()
+						return
+					}
+
+					err := tab.save()
+					if err != nil {
+						showError(myWindow, fmt.Sprintf("Saving %s", tab.title), err)
+						return
+					}
+				}
+
+				myWindow.Close()
+			},
+			myWindow.Close,
+			myWindow,
+		).Show()
+	})
 	myWindow.Resize(fyne.NewSize(1280, 720))
+
+	lastSession, crashed, err := loadSession()
+	if err != nil {
+		showError(myWindow, "Restoring session", err)
+	}
+
+	err = appTabs.restore(lastSession)
+	if err != nil {
+		showError(myWindow, "Restoring session", err)
+	}
+
+	if crashed && len(lastSession.Tabs) > 0 {
+		dialog.NewInformation("Session restored", "RunGo did not shut down properly, the last autosaved session has been restored", myWindow).Show()
+	}
+
+	stopSession, err := appTabs.startSession()
+	if err != nil {
+		showError(myWindow, "Starting session", err)
+	} else {
+		myApp.Lifecycle().SetOnStopped(func() {
+			for _, tab := range appTabs.playgroundTabs() {
+				tab.editor.closeLSP()
+			}
+
+			err := stopSession()
+			if err != nil {
+				logger.Error("stopSession()", zap.Error(err))
+			}
+		})
+	}
+
+	setup := func() {
+		err := setupGoVersion()
+		if err != nil {
+			showError(myWindow, "Setting up Go", err)
+		}
+
+		// Prefer the version the user was working with before restarting
+		if len(lastSession.GoVersion) > 0 && isGoVersionInstalled(lastSession.GoVersion) {
+			err = useGoVersion(lastSession.GoVersion)
+			if err != nil {
+				showError(myWindow, "Restoring session", err)
+			}
+		}
+
+		versionBtn.SetText(os.Getenv("RUNGO_GO_VER"))
+	}
+
+	// Go versions are looked up in the new location, so the migration has to
+	// be settled before deciding whether the latest one must be downloaded
+	legacyDir, ok := legacyAppDir(dirs)
+	if ok {
+		dialog.NewConfirm(
+			"Migrate data",
+			fmt.Sprintf("Snippets and Go versions from a previous release were found in %s.\nMove the snippets to %s and the Go versions to %s?", legacyDir, filepath.Join(dirs.data, SNIPPETS_DIR), filepath.Join(dirs.cache, GOS_DIR)),
+			func(migrate bool) {
+				if migrate {
+					err := migrateLegacyDir(legacyDir, dirs)
+					if err != nil {
+						showError(myWindow, "Migrating data", err)
+					}
+				} else {
+					err := markLegacyDirMigrated(dirs)
+					if err != nil {
+						showError(myWindow, "Migrating data", err)
+					}
+				}
+
+				setup()
+			},
+			myWindow,
+		).Show()
+	} else {
+		setup()
+	}
+
 	myWindow.ShowAndRun()
 }
 
@@ -11,12 +11,14 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/data/binding"
 	"fyne.io/fyne/v2/dialog"
-	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
@@ -24,23 +26,28 @@ import (
 )
 
 type customShortcut struct {
+	id string
 	keys string
 	info string
 }
 
-var customShortcuts = []customShortcut{
-	{keys: "Alt+T", info: "Open a new tab"},
-	{keys: "Alt+S", info: "Open save snippet modal"},
-	{keys: "Alt+O", info: "Open load snippet modal"},
-	{keys: "Alt+Return", info: "Run code"},
+type customShortcutsModal struct {
+	dispatcher	*customDispatcher
+	shortcuts	[]customShortcut
+	table		*widget.Table
+	*widget.PopUp
 }
 
-func newShortcutsModal(canvas fyne.Canvas, shortcuts []customShortcut) *widget.PopUp {
+// Lists the keys bound to every command, selecting a row allows changing
+// them as a comma separated list, e.g. "Alt+Return, Ctrl+Return"
+func newShortcutsModal(window fyne.Window, dispatcher *customDispatcher) *customShortcutsModal {
+	customShortcutsModal := &customShortcutsModal{dispatcher: dispatcher, shortcuts: dispatcher.shortcuts()}
+
 	var shortcutsModal *widget.PopUp
 	shortcutsTable := widget.NewTable(
 		func() (int, int) {
 			// N rows by 2 cols
-			return len(shortcuts), 2
+			return len(customShortcutsModal.shortcuts), 2
 		},
 		func() fyne.CanvasObject {
 			return widget.NewLabel("template")
@@ -48,16 +55,50 @@ func newShortcutsModal(canvas fyne.Canvas, shortcuts []customShortcut) *widget.P
 		func(tid widget.TableCellID, obj fyne.CanvasObject) {
 			switch tid.Col {
 			case 0:
-				obj.(*widget.Label).SetText(shortcuts[tid.Row].keys)
+				obj.(*widget.Label).SetText(customShortcutsModal.shortcuts[tid.Row].keys)
 			case 1:
-				obj.(*widget.Label).SetText(shortcuts[tid.Row].info)
+				obj.(*widget.Label).SetText(customShortcutsModal.shortcuts[tid.Row].info)
 			}
 		},
 	)
 
 	// TODO: Need to check if there is a better way to set this up
 	shortcutsTable.SetColumnWidth(0, 200)
-	shortcutsTable.SetColumnWidth(1, 200)
+	shortcutsTable.SetColumnWidth(1, 300)
+
+	selected := -1
+	command := widget.NewLabel("Select a shortcut to change it")
+	keys := &widget.Entry{PlaceHolder: "e.g. Alt+Return, Ctrl+Return"}
+	status := widget.NewLabel("")
+	status.Wrapping = fyne.TextWrapWord
+	keys.Disable()
+
+	rebind := func() {
+		if selected < 0 {
+			return
+		}
+
+		err := dispatcher.rebind(customShortcutsModal.shortcuts[selected].id, splitKeys(keys.Text))
+		if err != nil {
+			logger.Warn("dispatcher.rebind()", zap.Error(err))
+			status.SetText(err.Error())
+			return
+		}
+
+		status.SetText("")
+		customShortcutsModal.refresh()
+	}
+	keys.OnSubmitted = func(string) {
+		rebind()
+	}
+
+	shortcutsTable.OnSelected = func(tid widget.TableCellID) {
+		selected = tid.Row
+		command.SetText(customShortcutsModal.shortcuts[tid.Row].info)
+		keys.SetText(customShortcutsModal.shortcuts[tid.Row].keys)
+		keys.Enable()
+		status.SetText("")
+	}
 
 	shortcutsModal = widget.NewModalPopUp(container.NewBorder(
 		container.NewPadded(container.NewGridWithColumns(12,
@@ -76,13 +117,180 @@ func newShortcutsModal(canvas fyne.Canvas, shortcuts []customShortcut) *widget.P
 				shortcutsModal.Hide()
 			}),
 		)),
-		nil,
+		container.NewPadded(container.NewVBox(
+			command,
+			container.NewBorder(nil, nil, nil, container.NewHBox(
+				widget.NewButtonWithIcon("Save", theme.ConfirmIcon(), rebind),
+				widget.NewButtonWithIcon("Reset all", theme.ViewRefreshIcon(), func() {
+					err := dispatcher.resetKeymap()
+					if err != nil {
+						status.SetText(err.Error())
+					}
+					customShortcutsModal.refresh()
+				}),
+			), keys),
+			status,
+		)),
 		nil,
 		nil,
 		container.NewPadded(shortcutsTable),
-	), canvas)
+	), window.Canvas())
+
+	customShortcutsModal.table = shortcutsTable
+	customShortcutsModal.PopUp = shortcutsModal
+	return customShortcutsModal
+}
+
+func (c *customShortcutsModal) refresh() {
+	c.shortcuts = c.dispatcher.shortcuts()
+	c.table.Refresh()
+}
+
+func (c *customShortcutsModal) show() {
+	c.refresh()
+	c.PopUp.Resize(fyne.NewSize(560, 540))
+	c.PopUp.Show()
+}
+
+type customPaletteModal struct {
+	dispatcher	*customDispatcher
+	window		fyne.Window
+	matches		[]*command
+	selected	int
+	input		*paletteEntry
+	list		*widget.List
+	*widget.PopUp
+}
+
+// An entry that lets the arrow keys move through the matching commands
+type paletteEntry struct {
+	onKey func(key *fyne.KeyEvent) bool
+	widget.Entry
+}
+
+func newPaletteEntry() *paletteEntry {
+	entry := &paletteEntry{}
+	entry.PlaceHolder = "Type a command"
+	entry.ExtendBaseWidget(entry)
+	return entry
+}
+
+func (p *paletteEntry) TypedKey(key *fyne.KeyEvent) {
+	if p.onKey != nil && p.onKey(key) {
+		return
+	}
+
+	p.Entry.TypedKey(key)
+}
+
+// Lists every registered command along with its keys, typing narrows the
+// list down and Return runs the highlighted one
+func newPaletteModal(window fyne.Window, dispatcher *customDispatcher) *customPaletteModal {
+	customPaletteModal := &customPaletteModal{dispatcher: dispatcher, window: window}
+
+	list := widget.NewList(
+		func() int {
+			return len(customPaletteModal.matches)
+		},
+		func() fyne.CanvasObject {
+			return container.NewBorder(nil, nil, nil, widget.NewLabel("keys"), widget.NewLabel("command"))
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			cmd := customPaletteModal.matches[id]
+			row := obj.(*fyne.Container)
+			row.Objects[0].(*widget.Label).SetText(cmd.info)
+			row.Objects[1].(*widget.Label).SetText(strings.Join(cmd.keys, ", "))
+		},
+	)
+
+	// Moving through the list with the arrow keys selects items as well,
+	// only clicks should run the command
+	navigating := false
+	list.OnSelected = func(id widget.ListItemID) {
+		customPaletteModal.selected = id
+		if !navigating {
+			customPaletteModal.run()
+		}
+	}
 
-	return shortcutsModal
+	input := newPaletteEntry()
+	input.OnChanged = func(query string) {
+		customPaletteModal.matches = dispatcher.search(query)
+		customPaletteModal.selected = 0
+		list.UnselectAll()
+		list.Refresh()
+		list.ScrollToTop()
+	}
+	input.OnSubmitted = func(string) {
+		customPaletteModal.run()
+	}
+	input.onKey = func(key *fyne.KeyEvent) bool {
+		offset := 0
+		switch key.Name {
+		case fyne.KeyDown:
+			offset = 1
+		case fyne.KeyUp:
+			offset = -1
+		case fyne.KeyEscape:
+			customPaletteModal.Hide()
+			return true
+		default:
+			return false
+		}
+
+		if len(customPaletteModal.matches) > 0 {
+			navigating = true
+			selected := (customPaletteModal.selected + offset + len(customPaletteModal.matches)) % len(customPaletteModal.matches)
+			list.Select(selected)
+			list.ScrollTo(selected)
+			navigating = false
+		}
+
+		return true
+	}
+
+	var paletteModal *widget.PopUp
+	paletteModal = widget.NewModalPopUp(container.NewBorder(
+		container.NewPadded(container.NewBorder(nil, nil, nil,
+			widget.NewButtonWithIcon("", theme.CancelIcon(), func() {
+				paletteModal.Hide()
+			}),
+			input,
+		)),
+		nil,
+		nil,
+		nil,
+		container.NewPadded(list),
+	), window.Canvas())
+
+	customPaletteModal.input = input
+	customPaletteModal.list = list
+	customPaletteModal.PopUp = paletteModal
+	return customPaletteModal
+}
+
+// The palette is hidden before running the command, so the command can
+// show modals of its own
+func (c *customPaletteModal) run() {
+	if c.selected < 0 || c.selected >= len(c.matches) {
+		return
+	}
+
+	cmd := c.matches[c.selected]
+	c.Hide()
+	cmd.run()
+}
+
+func (c *customPaletteModal) show() {
+	c.input.SetText("")
+	c.matches = c.dispatcher.search("")
+	c.selected = 0
+	c.list.UnselectAll()
+	c.list.Refresh()
+
+	c.PopUp.Resize(fyne.NewSize(560, 440))
+	c.PopUp.Show()
+	c.window.Canvas().Focus(c.input)
 }
 
 func newAboutModal(canvas fyne.Canvas, content string) *widget.PopUp {
@@ -119,16 +327,11 @@ func newAboutModal(canvas fyne.Canvas, content string) *widget.PopUp {
 func newVersionModal(window fyne.Window, versionBtn *widget.Button, versionStr binding.String) *widget.PopUp {
 	versions, err := getGoVersions()
 	if err != nil {
-		if errors.Unwrap(err) == errRequestFailed || errors.Unwrap(err) == errUnexpectedStatus {
-			dialog.NewInformation("An error occurred", err.Error(), window).Show()
-			logger.Error("getGoVersions()", zap.Error(err))
-
-			// Set versions to an empty array, as this could be due to the
-			// service being currently unavailable
-			versions = []string{}
-		} else {
-			logger.Fatal("getGoVersions()", zap.Error(err))
-		}
+		showError(window, "Fetching Go versions", err)
+
+		// Set versions to an empty array, as this could be due to the
+		// service being currently unavailable
+		versions = []string{}
 	}
 
 	var versionModal *widget.PopUp
@@ -164,76 +367,39 @@ func newVersionModal(window fyne.Window, versionBtn *widget.Button, versionStr b
 				button.SetText(versions[lid])
 				button.Alignment = widget.ButtonAlignLeading
 				button.OnTapped = func() {
-					longVersion := fmt.Sprintf("%s.%s-%s", button.Text, runtime.GOOS, runtime.GOARCH)
-					_, err = os.ReadDir(filepath.Join(os.Getenv("RUNGO_APP_DIR"), GOS_DIR, longVersion))
-					if os.IsNotExist(err) {
-						progress := dialog.NewCustomWithoutButtons(fmt.Sprintf("Downloading %s", button.Text),
-							container.NewPadded(widget.NewProgressBarInfinite()),
-							window,
-						)
-						progress.Show()
-						defer progress.Hide()
-
-						switch runtime.GOOS {
-						case "windows":
-							err = getGoSource(fmt.Sprintf("%s.%s", longVersion, "zip"), filepath.Join(os.Getenv("RUNGO_APP_DIR")))
-							if err != nil {
-								logger.Fatal("getGoSource()", zap.Error(err))
-							}
+					version := versions[lid]
+					progress := dialog.NewCustomWithoutButtons(fmt.Sprintf("Downloading %s", version),
+						container.NewPadded(widget.NewProgressBarInfinite()),
+						window,
+					)
+					progress.Show()
 
-							err = uncompressZipFile(
-								filepath.Join(os.Getenv("RUNGO_APP_DIR"), fmt.Sprintf("%s.%s", longVersion, "zip")),
-								filepath.Join(os.Getenv("RUNGO_APP_DIR"), GOS_DIR),
-							)
-							if err != nil {
-								logger.Fatal("uncompressZipFile()", zap.Error(err))
-							}
-						default:
-							err = getGoSource(fmt.Sprintf("%s.%s", longVersion, "tar.gz"), filepath.Join(os.Getenv("RUNGO_APP_DIR")))
-							if err != nil {
-								logger.Fatal("getGoSource()", zap.Error(err))
-							}
+					// Downloading can take a while, doing it in the background
+					// keeps the progress dialog responsive
+					go func() {
+						defer progress.Hide()
 
-							err = uncompressTarFile(
-								filepath.Join(os.Getenv("RUNGO_APP_DIR"), fmt.Sprintf("%s.%s", longVersion, "tar.gz")),
-								filepath.Join(os.Getenv("RUNGO_APP_DIR"), GOS_DIR),
-							)
-							if err != nil {
-								logger.Fatal("uncompressTarFile()", zap.Error(err))
-							}
+						err := installGoVersion(version)
+						if err != nil {
+							showError(window, fmt.Sprintf("Downloading %s", version), err)
+							return
 						}
 
-						err = os.Rename(filepath.Join(os.Getenv("RUNGO_APP_DIR"), GOS_DIR, "go"), filepath.Join(os.Getenv("RUNGO_APP_DIR"), GOS_DIR, longVersion))
+						err = useGoVersion(version)
 						if err != nil {
-							logger.Fatal("os.Rename()", zap.Error(err))
+							showError(window, fmt.Sprintf("Switching to %s", version), err)
+							return
 						}
-					}
-
-
-					err = os.Setenv("RUNGO_GO_BIN", filepath.Join(os.Getenv("RUNGO_APP_DIR"), GOS_DIR, longVersion, "bin", "go"))
-					if err != nil {
-						logger.Fatal("os.Setenv()", zap.Error(err))
-					}
 
-					if runtime.GOOS == "windows" {
-						err = os.Setenv("RUNGO_GO_BIN", filepath.Join(os.Getenv("RUNGO_APP_DIR"), GOS_DIR, longVersion, "bin", "go.exe"))
+						err = versionStr.Set(version)
 						if err != nil {
-							logger.Fatal("os.Setenv()", zap.Error(err))
+							showError(window, fmt.Sprintf("Switching to %s", version), err)
+							return
 						}
-					}
-
-					err = versionStr.Set(versions[lid])
-					if err != nil {
-						logger.Fatal("versionStr.Set()", zap.Error(err))
-					}
 
-					version, err := versionStr.Get()
-					if err != nil {
-						logger.Fatal("versionStr.Get()", zap.Error(err))
-					}
-
-					versionBtn.SetText(version)
-					versionModal.Hide()
+						versionBtn.SetText(version)
+						versionModal.Hide()
+					}()
 				}
 			},
 		)),
@@ -243,11 +409,13 @@ func newVersionModal(window fyne.Window, versionBtn *widget.Button, versionStr b
 }
 
 type customSaveModal struct {
+	tab *playgroundTab
+	window fyne.Window
 	*widget.PopUp
 }
 
-func newSaveModal(entry *widget.Entry, appTabs *container.AppTabs, snippet binding.String, window fyne.Window) *customSaveModal {
-	customSaveModal := &customSaveModal{}
+func newSaveModal(tab *playgroundTab, window fyne.Window) *customSaveModal {
+	customSaveModal := &customSaveModal{tab: tab, window: window}
 	
 	input := &widget.Entry{PlaceHolder: "Snippet name"}
 	var saveModal *widget.PopUp
@@ -274,25 +442,56 @@ func newSaveModal(entry *widget.Entry, appTabs *container.AppTabs, snippet bindi
 		container.NewPadded(container.NewVBox(
 			input,
 			widget.NewButtonWithIcon("Save", theme.ConfirmIcon(), func() {
-				err := newSnippet(input.Text, []byte(entry.Text))
-				if err != nil {
-					if errors.Is(err, os.ErrExist) {
-						dialog.NewInformation("An error occurred", err.Error(), window).Show()
-						logger.Error("newSnippet()", zap.Error(err))
+				if getSettings().FormatOnSave {
+					tab.editor.format()
+				}
+
+				name := input.Text
+				code := tab.editor.Text()
+				saved := func() {
+					err := tab.snippet.Set(name)
+					if err != nil {
+						showError(window, "Saving snippet", err)
 						return
-					} else {
-						logger.Fatal("newSnippet()", zap.Error(err))
 					}
+
+					err = writeRunConfig(name, tab.editor.config)
+					if err != nil {
+						showError(window, "Saving run configuration", err)
+					}
+
+					tab.markSaved(code)
+					tab.setTitle(name)
+					saveModal.Hide()
 				}
 
-				err = snippet.Set(input.Text)
-				if err != nil {
-					logger.Fatal("snippet.Set()", zap.Error(err))
+				err := newSnippet(name, []byte(code))
+				if errors.Is(err, os.ErrExist) {
+					dialog.NewConfirm(
+						"Overwrite snippet",
+						fmt.Sprintf("A snippet named %s already exists, do you want to replace its code?", name),
+						func(overwrite bool) {
+							if !overwrite {
+								return
+							}
+
+							err := saveSnippet(name, []byte(code))
+							if err != nil {
+								showError(window, "Saving snippet", err)
+								return
+							}
+
+							saved()
+						},
+						window,
+					).Show()
+					return
+				} else if err != nil {
+					showError(window, "Saving snippet", err)
+					return
 				}
 
-				appTabs.Selected().Text = input.Text
-				appTabs.Refresh()
-				saveModal.Hide()
+				saved()
 			}),
 		)),
 	), window.Canvas())
@@ -301,27 +500,33 @@ func newSaveModal(entry *widget.Entry, appTabs *container.AppTabs, snippet bindi
 	return customSaveModal
 }
 
-func (c *customSaveModal) TypedShortcut(shortcut fyne.Shortcut) {
-	customShortcut, ok := shortcut.(*desktop.CustomShortcut)
-	if !ok {
-		c.TypedShortcut(shortcut)
+// Snippets that already exist are saved in place, the rest need a name
+func (c *customSaveModal) save() {
+	snippet, _ := c.tab.snippet.Get()
+	if len(snippet) > 0 {
+		err := c.tab.save()
+		if err != nil {
+			showError(c.window, "Saving snippet", err)
+		}
 		return
 	}
 
-	switch customShortcut.ShortcutName() {
-	case ALT_S:
-		c.PopUp.Resize(fyne.NewSize(440, 200))
-		c.PopUp.Show()
-	}
+	c.show()
+}
+
+func (c *customSaveModal) show() {
+	c.PopUp.Resize(fyne.NewSize(440, 200))
+	c.PopUp.Show()
 }
 
 type customOpenModal struct {
 	snippetList binding.StringList
+	window fyne.Window
 	*widget.PopUp
 }
 
-func newOpenModal(entry *widget.Entry, appTabs *container.AppTabs, snippet binding.String, snippetList binding.StringList, window fyne.Window) *customOpenModal {
-	customOpenModal := &customOpenModal{snippetList: snippetList}
+func newOpenModal(tab *playgroundTab, snippetList binding.StringList, window fyne.Window) *customOpenModal {
+	customOpenModal := &customOpenModal{snippetList: snippetList, window: window}
 	
 	var openModal *widget.PopUp
 	openModal = widget.NewModalPopUp(container.NewBorder(
@@ -354,42 +559,42 @@ func newOpenModal(entry *widget.Entry, appTabs *container.AppTabs, snippet bindi
 			func(lid widget.ListItemID, obj fyne.CanvasObject) {
 				snippetName, err := snippetList.GetValue(lid)
 				if err != nil {
-					logger.Fatal("snippetList.GetValue()", zap.Error(err))
+					showError(window, "Listing snippets", err)
+					return
 				}
 
 				button := obj.(*widget.Button)
 				button.SetText(snippetName)
 				button.Alignment = widget.ButtonAlignLeading
 				button.OnTapped = func() {
-					if len(entry.Text) != 0 {
+					if len(tab.editor.Text()) != 0 {
 						dialog.NewInformation("Info", "Tab already in use", window).Show()
 						logger.Warn("user attempted to open snippet in used tab")
 						return
 					}
 
-					dir := filepath.Join(os.Getenv("RUNGO_APP_DIR"), SNIPPETS_DIR, snippetName)
-					_, err = os.ReadDir(dir)
-					if os.IsNotExist(err) {
-						dialog.NewInformation("An error occurred", err.Error(), window).Show()
-						logger.Error("os.ReadDir()", zap.Error(err))
+					data, err := readSnippet(snippetName)
+					if err != nil {
+						showError(window, fmt.Sprintf("Opening %s", snippetName), err)
 						return
-					} else if err != nil {
-						logger.Fatal("os.ReadDir()", zap.Error(err))
 					}
 
-					data, err := os.ReadFile(filepath.Join(dir, "main.go"))
+					config, err := readRunConfig(snippetName)
 					if err != nil {
-						logger.Fatal("os.ReadFile()", zap.Error(err))
+						showError(window, fmt.Sprintf("Opening %s", snippetName), err)
+						return
 					}
 
-					err = snippet.Set(snippetName)
+					err = tab.snippet.Set(snippetName)
 					if err != nil {
-						logger.Fatal("snippet.Set()", zap.Error(err))
+						showError(window, fmt.Sprintf("Opening %s", snippetName), err)
+						return
 					}
+					tab.editor.config = config
 
-					entry.SetText(string(data))
-					appTabs.Selected().Text = snippetName
-					appTabs.Refresh()
+					tab.editor.SetText(string(data))
+					tab.markSaved(string(data))
+					tab.setTitle(snippetName)
 					openModal.Hide()
 				}
 			},
@@ -400,43 +605,736 @@ func newOpenModal(entry *widget.Entry, appTabs *container.AppTabs, snippet bindi
 	return customOpenModal
 }
 
-func (c *customOpenModal) TypedShortcut(shortcut fyne.Shortcut) {
-	customShortcut, ok := shortcut.(*desktop.CustomShortcut)
-	if !ok {
-		c.TypedShortcut(shortcut)
+func (c *customOpenModal) show() {
+	dir := filepath.Join(os.Getenv("RUNGO_DATA_DIR"), SNIPPETS_DIR)
+	snippets := make([]string, 0)
+	err := fs.WalkDir(os.DirFS(dir), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := os.Stat(filepath.Join(dir, path))
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			snippets = append(snippets, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		showError(c.window, "Listing snippets", err)
+		return
+	}
+
+	err = c.snippetList.Set(snippets[1:])
+	if err != nil {
+		showError(c.window, "Listing snippets", err)
 		return
 	}
 
-	switch customShortcut.ShortcutName() {
-	case ALT_O:
-		dir := filepath.Join(os.Getenv("RUNGO_APP_DIR"), SNIPPETS_DIR)
-		snippets := make([]string, 0)
-		err := fs.WalkDir(os.DirFS(dir), ".", func(path string, d fs.DirEntry, err error) error {
+	c.PopUp.Resize(fyne.NewSize(440, 540))
+	c.PopUp.Show()
+}
+
+var autosaveOptions = []struct {
+	mode string
+	info string
+}{
+	{mode: AUTOSAVE_OFF, info: "Off"},
+	{mode: AUTOSAVE_IDLE, info: "After a delay without typing"},
+	{mode: AUTOSAVE_FOCUS, info: "When the editor loses focus"},
+}
+
+var keybindingsOptions = []struct {
+	mode string
+	info string
+}{
+	{mode: KEYBINDINGS_DEFAULT, info: "Default"},
+	{mode: KEYBINDINGS_VIM, info: "Vim"},
+	{mode: KEYBINDINGS_EMACS, info: "Emacs"},
+}
+
+type customSettingsModal struct {
+	autosave		*widget.Select
+	autosaveDelay	*widget.Entry
+	formatOnRun		*widget.Check
+	formatOnSave	*widget.Check
+	importsOnRun	*widget.Check
+	languageServer	*widget.Check
+	keybindings		*widget.Select
+	consoleColors	*widget.Check
+	consoleEmbeds	*widget.Check
+	consoleLines	*widget.Entry
+	consoleSize		*widget.Entry
+	*widget.PopUp
+}
+
+func newSettingsModal(window fyne.Window) *customSettingsModal {
+	customSettingsModal := &customSettingsModal{}
+
+	options := make([]string, 0, len(autosaveOptions))
+	for _, option := range autosaveOptions {
+		options = append(options, option.info)
+	}
+
+	autosave := widget.NewSelect(options, nil)
+	autosaveDelay := widget.NewEntry()
+	autosaveDelay.Validator = func(text string) error {
+		_, err := strconv.ParseUint(text, 10, 16)
+		return err
+	}
+	formatOnRun := widget.NewCheck("Before running", nil)
+	formatOnSave := widget.NewCheck("Before saving", nil)
+	importsOnRun := widget.NewCheck("Before running", nil)
+	languageServer := widget.NewCheck("Use gopls", nil)
+
+	keybindingsNames := make([]string, 0, len(keybindingsOptions))
+	for _, option := range keybindingsOptions {
+		keybindingsNames = append(keybindingsNames, option.info)
+	}
+	keybindings := widget.NewSelect(keybindingsNames, nil)
+	consoleColors := widget.NewCheck("Show colors", nil)
+	consoleEmbeds := widget.NewCheck("Render HTML, SVG and Markdown", nil)
+	consoleLimit := func(text string) error {
+		n, err := strconv.ParseUint(text, 10, 31)
+		if err == nil && n == 0 {
+			return errors.New("must be greater than zero")
+		}
+		return err
+	}
+	consoleLines := widget.NewEntry()
+	consoleLines.Validator = consoleLimit
+	consoleSize := widget.NewEntry()
+	consoleSize.Validator = consoleLimit
+
+	var settingsModal *widget.PopUp
+	form := &widget.Form{
+		Items: []*widget.FormItem{
+			widget.NewFormItem("Autosave snippets", autosave),
+			{Text: "Autosave delay", Widget: autosaveDelay, HintText: "Seconds without typing"},
+			{Text: "Format code", Widget: container.NewVBox(formatOnRun, formatOnSave), HintText: "Code with syntax errors is left as is"},
+			{Text: "Organize imports", Widget: importsOnRun, HintText: "Adds and removes standard library imports, also formats the code"},
+			{Text: "Code intelligence", Widget: languageServer, HintText: "Completion, documentation and diagnostics, gopls is installed for each Go version"},
+			{Text: "Editor keys", Widget: keybindings, HintText: "Alt shortcuts of the app keep working in every mode"},
+			{Text: "Console", Widget: consoleColors, HintText: "Otherwise escape codes are stripped, programs are told through TERM and NO_COLOR"},
+			{Text: "Rich output", Widget: consoleEmbeds, HintText: "Lines printed as HTML:, SVG: or MARKDOWN: followed by base64, IMAGE: lines are always rendered"},
+			{Text: "Console lines", Widget: consoleLines, HintText: "The oldest lines are dropped past this many"},
+			{Text: "Console size", Widget: consoleSize, HintText: "Megabytes of output kept, applies from the next run"},
+		},
+		SubmitText: "Save",
+		OnSubmit: func() {
+			s := getSettings()
+			s.Autosave = autosaveOptions[autosave.SelectedIndex()].mode
+			s.AutosaveDelay, _ = strconv.Atoi(autosaveDelay.Text)
+			s.FormatOnRun = formatOnRun.Checked
+			s.FormatOnSave = formatOnSave.Checked
+			s.ImportsOnRun = importsOnRun.Checked
+			s.LanguageServer = languageServer.Checked
+			s.Keybindings = keybindingsOptions[keybindings.SelectedIndex()].mode
+			s.ConsoleColors = consoleColors.Checked
+			s.ConsoleEmbeds = consoleEmbeds.Checked
+			s.ConsoleLines, _ = strconv.Atoi(consoleLines.Text)
+			s.ConsoleSize, _ = strconv.Atoi(consoleSize.Text)
+
+			err := setSettings(s)
 			if err != nil {
-				return err
+				showError(window, "Saving settings", err)
+				return
 			}
 
-			info, err := os.Stat(filepath.Join(dir, path))
-			if err != nil {
-				return err
+			settingsModal.Hide()
+		},
+	}
+
+	settingsModal = widget.NewModalPopUp(container.NewBorder(
+		container.NewPadded(container.NewGridWithColumns(12,
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			widget.NewButtonWithIcon("", theme.CancelIcon(), func() {
+				settingsModal.Hide()
+			}),
+		)),
+		nil,
+		nil,
+		nil,
+		container.NewPadded(container.NewVScroll(form)),
+	), window.Canvas())
+
+	customSettingsModal.autosave = autosave
+	customSettingsModal.autosaveDelay = autosaveDelay
+	customSettingsModal.formatOnRun = formatOnRun
+	customSettingsModal.formatOnSave = formatOnSave
+	customSettingsModal.importsOnRun = importsOnRun
+	customSettingsModal.languageServer = languageServer
+	customSettingsModal.keybindings = keybindings
+	customSettingsModal.consoleColors = consoleColors
+	customSettingsModal.consoleEmbeds = consoleEmbeds
+	customSettingsModal.consoleLines = consoleLines
+	customSettingsModal.consoleSize = consoleSize
+	customSettingsModal.PopUp = settingsModal
+	return customSettingsModal
+}
+
+// Fills the form with the current settings before showing it, so changes
+// that were not saved are discarded
+func (c *customSettingsModal) show() {
+	s := getSettings()
+	for i, option := range autosaveOptions {
+		if option.mode == s.Autosave {
+			c.autosave.SetSelectedIndex(i)
+		}
+	}
+	c.autosaveDelay.SetText(strconv.Itoa(s.AutosaveDelay))
+	c.formatOnRun.SetChecked(s.FormatOnRun)
+	c.formatOnSave.SetChecked(s.FormatOnSave)
+	c.importsOnRun.SetChecked(s.ImportsOnRun)
+	c.languageServer.SetChecked(s.LanguageServer)
+	c.keybindings.SetSelectedIndex(0)
+	for i, option := range keybindingsOptions {
+		if option.mode == s.Keybindings {
+			c.keybindings.SetSelectedIndex(i)
+		}
+	}
+	c.consoleColors.SetChecked(s.ConsoleColors)
+	c.consoleEmbeds.SetChecked(s.ConsoleEmbeds)
+	c.consoleLines.SetText(strconv.Itoa(s.ConsoleLines))
+	c.consoleSize.SetText(strconv.Itoa(s.ConsoleSize))
+
+	c.PopUp.Resize(fyne.NewSize(440, 540))
+	c.PopUp.Show()
+}
+
+// Asks what to do with unsaved snippets, cancelling leaves everything as is
+func newUnsavedDialog(message string, onSave, onDiscard func(), window fyne.Window) *dialog.CustomDialog {
+	content := widget.NewLabel(message)
+	content.Wrapping = fyne.TextWrapWord
+
+	unsavedDialog := dialog.NewCustomWithoutButtons("Unsaved changes", content, window)
+	unsavedDialog.SetButtons([]fyne.CanvasObject{
+		widget.NewButtonWithIcon("Cancel", theme.CancelIcon(), unsavedDialog.Hide),
+		widget.NewButtonWithIcon("Discard", theme.DeleteIcon(), func() {
+			unsavedDialog.Hide()
+			onDiscard()
+		}),
+		&widget.Button{Text: "Save", Icon: theme.DocumentSaveIcon(), Importance: widget.HighImportance, OnTapped: func() {
+			unsavedDialog.Hide()
+			onSave()
+		}},
+	})
+	unsavedDialog.Resize(fyne.NewSize(440, 0))
+
+	return unsavedDialog
+}
+
+type customRenameModal struct {
+	tab		*playgroundTab
+	input	*widget.Entry
+	*widget.PopUp
+}
+
+func newRenameModal(window fyne.Window) *customRenameModal {
+	customRenameModal := &customRenameModal{}
+
+	input := &widget.Entry{PlaceHolder: "Tab name"}
+	var renameModal *widget.PopUp
+	rename := func() {
+		if len(input.Text) == 0 {
+			return
+		}
+
+		customRenameModal.tab.setTitle(input.Text)
+		renameModal.Hide()
+	}
+	input.OnSubmitted = func(string) {
+		rename()
+	}
+
+	renameModal = widget.NewModalPopUp(container.NewBorder(
+		container.NewPadded(container.NewGridWithColumns(12,
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			widget.NewButtonWithIcon("", theme.CancelIcon(), func() {
+				renameModal.Hide()
+			}),
+		)),
+		nil,
+		nil,
+		nil,
+		container.NewPadded(container.NewVBox(
+			input,
+			widget.NewButtonWithIcon("Rename", theme.ConfirmIcon(), rename),
+		)),
+	), window.Canvas())
+
+	customRenameModal.input = input
+	customRenameModal.PopUp = renameModal
+	return customRenameModal
+}
+
+func (c *customRenameModal) show(tab *playgroundTab) {
+	c.tab = tab
+	c.input.SetText(tab.title)
+
+	c.PopUp.Resize(fyne.NewSize(440, 200))
+	c.PopUp.Show()
+	c.PopUp.Canvas.Focus(c.input)
+}
+
+type customGoToLineModal struct {
+	tab		*playgroundTab
+	input	*widget.Entry
+	status	*widget.Label
+	*widget.PopUp
+}
+
+// Accepts either a line or a line and column, e.g. "12" or "12:5"
+func newGoToLineModal(window fyne.Window) *customGoToLineModal {
+	customGoToLineModal := &customGoToLineModal{}
+
+	input := &widget.Entry{PlaceHolder: "Line or line:column"}
+	status := widget.NewLabel("")
+	var goToLineModal *widget.PopUp
+	goToLine := func() {
+		pos, err := parseLineColumn(input.Text)
+		if err != nil {
+			status.SetText(err.Error())
+			return
+		}
+
+		editor := customGoToLineModal.tab.editor
+		editor.setCursor(textPos{row: pos.row, col: colAtVisual(editor.buf.line(editor.buf.clamp(pos).row), pos.col)})
+		goToLineModal.Hide()
+		editor.requestFocus()
+	}
+	input.OnSubmitted = func(string) {
+		goToLine()
+	}
+
+	goToLineModal = widget.NewModalPopUp(container.NewBorder(
+		container.NewPadded(container.NewGridWithColumns(12,
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			widget.NewButtonWithIcon("", theme.CancelIcon(), func() {
+				goToLineModal.Hide()
+			}),
+		)),
+		nil,
+		nil,
+		nil,
+		container.NewPadded(container.NewVBox(
+			input,
+			status,
+			widget.NewButtonWithIcon("Go", theme.ConfirmIcon(), goToLine),
+		)),
+	), window.Canvas())
+
+	customGoToLineModal.input = input
+	customGoToLineModal.status = status
+	customGoToLineModal.PopUp = goToLineModal
+	return customGoToLineModal
+}
+
+func (c *customGoToLineModal) show(tab *playgroundTab) {
+	c.tab = tab
+	c.input.SetText("")
+	c.status.SetText(fmt.Sprintf("Lines 1 to %d", tab.editor.buf.lineCount()))
+
+	c.PopUp.Resize(fyne.NewSize(440, 200))
+	c.PopUp.Show()
+	c.PopUp.Canvas.Focus(c.input)
+}
+
+// Edits how the code of a tab is built and run, snippets keep it next to
+// their code
+type customRunConfigModal struct {
+	tab				*playgroundTab
+	window			fyne.Window
+	args			*widget.Entry
+	env				*widget.Entry
+	tags			*widget.Entry
+	buildFlags		*widget.Entry
+	cgoEnabled		*widget.Select
+	goos			*widget.Entry
+	goarch			*widget.Entry
+	goexperiment	*widget.Entry
+	*widget.PopUp
+}
+
+var cgoOptions = []struct {
+	value	string
+	info	string
+}{
+	{value: "", info: "Default"},
+	{value: "1", info: "Enabled"},
+	{value: "0", info: "Disabled"},
+}
+
+func newRunConfigModal(window fyne.Window) *customRunConfigModal {
+	customRunConfigModal := &customRunConfigModal{window: window}
+
+	splitValidator := func(text string) error {
+		_, err := splitArgs(text)
+		return err
+	}
+	args := widget.NewEntry()
+	args.Validator = splitValidator
+	env := widget.NewMultiLineEntry()
+	env.SetMinRowsVisible(3)
+	env.Validator = func(text string) error {
+		_, err := parseEnv(text)
+		return err
+	}
+	tags := widget.NewEntry()
+	buildFlags := widget.NewEntry()
+	buildFlags.Validator = splitValidator
+
+	cgoNames := make([]string, 0, len(cgoOptions))
+	for _, option := range cgoOptions {
+		cgoNames = append(cgoNames, option.info)
+	}
+	cgoEnabled := widget.NewSelect(cgoNames, nil)
+	goos := &widget.Entry{PlaceHolder: runtime.GOOS}
+	goarch := &widget.Entry{PlaceHolder: runtime.GOARCH}
+	goexperiment := widget.NewEntry()
+
+	var runConfigModal *widget.PopUp
+	form := &widget.Form{
+		Items: []*widget.FormItem{
+			{Text: "Arguments", Widget: args, HintText: "Passed to the program, quoted as in a shell"},
+			{Text: "Environment", Widget: env, HintText: "One KEY=value per line"},
+			{Text: "Build tags", Widget: tags, HintText: "Separated by commas"},
+			{Text: "Build flags", Widget: buildFlags, HintText: "Such as -race or -gcflags=-m"},
+			widget.NewFormItem("CGO_ENABLED", cgoEnabled),
+			{Text: "GOOS", Widget: goos, HintText: "Programs built for another system may not run"},
+			widget.NewFormItem("GOARCH", goarch),
+			{Text: "GOEXPERIMENT", Widget: goexperiment, HintText: "Such as rangefunc or loopvar"},
+		},
+		SubmitText: "Apply",
+		OnSubmit: func() {
+			config := runConfig{
+				Tags: parseTags(tags.Text),
+				CGOEnabled: cgoOptions[cgoEnabled.SelectedIndex()].value,
+				GOOS: strings.TrimSpace(goos.Text),
+				GOARCH: strings.TrimSpace(goarch.Text),
+				GOEXPERIMENT: strings.TrimSpace(goexperiment.Text),
 			}
+			config.Args, _ = splitArgs(args.Text)
+			config.Env, _ = parseEnv(env.Text)
+			config.BuildFlags, _ = splitArgs(buildFlags.Text)
 
-			if info.IsDir() {
-				snippets = append(snippets, path)
+			err := customRunConfigModal.tab.setRunConfig(config)
+			if err != nil {
+				showError(window, "Saving run configuration", err)
+				return
 			}
 
-			return nil
-		})
-		if err != nil {
-			logger.Fatal("fs.WalkDir()", zap.Error(err))
+			runConfigModal.Hide()
+		},
+	}
+
+	runConfigModal = widget.NewModalPopUp(container.NewBorder(
+		container.NewPadded(container.NewGridWithColumns(12,
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			widget.NewButtonWithIcon("", theme.CancelIcon(), func() {
+				runConfigModal.Hide()
+			}),
+		)),
+		nil,
+		nil,
+		nil,
+		container.NewPadded(container.NewVScroll(form)),
+	), window.Canvas())
+
+	customRunConfigModal.args = args
+	customRunConfigModal.env = env
+	customRunConfigModal.tags = tags
+	customRunConfigModal.buildFlags = buildFlags
+	customRunConfigModal.cgoEnabled = cgoEnabled
+	customRunConfigModal.goos = goos
+	customRunConfigModal.goarch = goarch
+	customRunConfigModal.goexperiment = goexperiment
+	customRunConfigModal.PopUp = runConfigModal
+	return customRunConfigModal
+}
+
+// Fills the form with the tab's configuration, changes that were not
+// applied are discarded
+func (c *customRunConfigModal) show(tab *playgroundTab) {
+	c.tab = tab
+	config := tab.editor.config
+	c.args.SetText(joinArgs(config.Args))
+	c.env.SetText(strings.Join(config.Env, "\n"))
+	c.tags.SetText(strings.Join(config.Tags, ","))
+	c.buildFlags.SetText(joinArgs(config.BuildFlags))
+	c.cgoEnabled.SetSelectedIndex(0)
+	for i, option := range cgoOptions {
+		if option.value == config.CGOEnabled {
+			c.cgoEnabled.SetSelectedIndex(i)
 		}
+	}
+	c.goos.SetText(config.GOOS)
+	c.goarch.SetText(config.GOARCH)
+	c.goexperiment.SetText(config.GOEXPERIMENT)
 
-		err = c.snippetList.Set(snippets[1:])
-		if err != nil {
-			logger.Fatal("c.snippetList.Set()", zap.Error(err))
+	c.PopUp.Resize(fyne.NewSize(520, 600))
+	c.PopUp.Show()
+	c.PopUp.Canvas.Focus(c.args)
+}
+
+type customRunsModal struct {
+	tab			*playgroundTab
+	runs		[]runRecord
+	selected	int
+	list		*widget.List
+	details		*widget.Label
+	restore		*widget.Button
+	output		*console
+	before		*widget.Select
+	after		*widget.Select
+	left		*console
+	right		*console
+	*widget.PopUp
+}
+
+// Lists the runs of a tab, the latest first. The output of the selected
+// run is shown along with a diff against the run before it, any two runs
+// can be compared by picking them above the diff
+func newRunsModal(window fyne.Window) *customRunsModal {
+	customRunsModal := &customRunsModal{
+		selected: -1,
+		details: widget.NewLabel("Select a run to see its output"),
+		output: playgroundConsole(),
+		left: playgroundConsole(),
+		right: playgroundConsole(),
+	}
+	c := customRunsModal
+
+	c.list = widget.NewList(
+		func() int {
+			return len(c.runs)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("template")
+		},
+		func(lid widget.ListItemID, obj fyne.CanvasObject) {
+			obj.(*widget.Label).SetText(c.runs[lid].summary())
+		},
+	)
+	c.list.OnSelected = c.selectRun
+
+	var runsModal *widget.PopUp
+	c.restore = widget.NewButtonWithIcon("Restore source", theme.ContentUndoIcon(), func() {
+		if c.selected < 0 || c.selected >= len(c.runs) {
+			return
 		}
 
-		c.PopUp.Resize(fyne.NewSize(440, 540))
-		c.PopUp.Show()
+		c.tab.editor.SetText(c.runs[c.selected].code)
+		runsModal.Hide()
+		c.tab.editor.requestFocus()
+	})
+	c.restore.Disable()
+
+	c.before = widget.NewSelect(nil, func(string) {
+		c.compare()
+	})
+	c.before.PlaceHolder = "Run to compare"
+	c.after = widget.NewSelect(nil, func(string) {
+		c.compare()
+	})
+	c.after.PlaceHolder = "Run to compare with"
+
+	// Both sides of the diff scroll together
+	syncScroll := func(from, to *console) {
+		from.Scroll.OnScrolled = func(offset fyne.Position) {
+			from.scrolled(offset)
+			if to.Scroll.Offset != offset {
+				to.Scroll.Offset = offset
+				to.Scroll.Refresh()
+				to.scrolled(to.Scroll.Offset)
+			}
+		}
 	}
+	syncScroll(c.left, c.right)
+	syncScroll(c.right, c.left)
+
+	runsModal = widget.NewModalPopUp(container.NewBorder(
+		container.NewPadded(container.NewGridWithColumns(12,
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			layout.NewSpacer(),
+			widget.NewButtonWithIcon("", theme.CancelIcon(), func() {
+				runsModal.Hide()
+			}),
+		)),
+		nil,
+		nil,
+		nil,
+		container.NewPadded(container.NewHSplit(
+			c.list,
+			container.NewAppTabs(
+				container.NewTabItem("Output", container.NewBorder(
+					container.NewBorder(nil, nil, nil, c.restore, c.details),
+					nil,
+					nil,
+					nil,
+					c.output,
+				)),
+				container.NewTabItem("Diff", container.NewBorder(
+					container.NewGridWithColumns(2, c.before, c.after),
+					nil,
+					nil,
+					nil,
+					container.NewGridWithColumns(2, c.left, c.right),
+				)),
+			),
+		)),
+	), window.Canvas())
+
+	c.PopUp = runsModal
+	return customRunsModal
+}
+
+func (c *customRunsModal) show(tab *playgroundTab) {
+	c.tab = tab
+	c.refresh()
+
+	c.PopUp.Resize(fyne.NewSize(1000, 640))
+	c.PopUp.Show()
+}
+
+// Lists the runs again, e.g. when one finishes while the modal is shown,
+// selecting the latest one
+func (c *customRunsModal) refresh() {
+	c.runs = c.tab.runs.list()
+	options := make([]string, 0, len(c.runs))
+	for _, r := range c.runs {
+		options = append(options, r.summary())
+	}
+	c.before.Options, c.after.Options = options, options
+	c.before.ClearSelected()
+	c.after.ClearSelected()
+
+	c.selected = -1
+	c.list.UnselectAll()
+	c.list.Refresh()
+	if len(c.runs) > 0 {
+		c.list.Select(0)
+	} else {
+		c.details.SetText("Runs of this tab show up here")
+		c.restore.Disable()
+		c.output.clear()
+	}
+}
+
+// Shows the output of a run, and how it differs from the run before it
+func (c *customRunsModal) selectRun(id widget.ListItemID) {
+	if id >= len(c.runs) {
+		return
+	}
+
+	c.selected = id
+	r := c.runs[id]
+	c.details.SetText(fmt.Sprintf("%s with %s, source %s, took %s, %s", r.started.Format("Jan 2 15:04:05"), r.goVersion, r.hash, r.duration.Round(time.Millisecond), r.status()))
+	c.restore.Enable()
+
+	// Standard error is told apart by its color
+	output := r.stdout
+	if len(r.stderr) > 0 {
+		if len(output) > 0 && !strings.HasSuffix(output, "\n") {
+			output += "\n"
+		}
+		output += "\x1b[31m" + r.stderr
+	}
+	c.output.setText(output)
+
+	if id+1 < len(c.runs) {
+		c.before.SetSelectedIndex(id + 1)
+	} else {
+		c.before.ClearSelected()
+	}
+	c.after.SetSelectedIndex(id)
+}
+
+func (c *customRunsModal) compare() {
+	i, j := c.before.SelectedIndex(), c.after.SelectedIndex()
+	if i < 0 || j < 0 {
+		c.left.clear()
+		c.right.clear()
+		return
+	}
+
+	lines := func(r runRecord) []string {
+		return strings.Split(strings.TrimSuffix(r.output(), "\n"), "\n")
+	}
+	rows := diffLines(lines(c.runs[i]), lines(c.runs[j]))
+	c.left.setText(diffText(rows, false))
+	c.right.setText(diffText(rows, true))
+}
+
+// Lines and columns are typed starting at 1, the position returned starts
+// at 0 and its column is the displayed one
+func parseLineColumn(text string) (textPos, error) {
+	lineText, colText, hasCol := strings.Cut(strings.TrimSpace(text), ":")
+	line, err := strconv.Atoi(lineText)
+	if err != nil || line < 1 {
+		return textPos{}, fmt.Errorf("invalid line %q", lineText)
+	}
+
+	col := 1
+	if hasCol {
+		col, err = strconv.Atoi(colText)
+		if err != nil || col < 1 {
+			return textPos{}, fmt.Errorf("invalid column %q", colText)
+		}
+	}
+
+	return textPos{row: line - 1, col: col - 1}, nil
 }
@@ -0,0 +1,175 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"image/color"
+	"time"
+	"unicode/utf8"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// A package-level declaration, e.g. a function or a type
+type outlineItem struct {
+	kind	string
+	name	string
+	pos		textPos
+}
+
+// Declarations of the file in the order they appear, methods are named
+// after their receiver such as "(*T) String"
+func outlineItems(fset *token.FileSet, file *ast.File, src []byte) []outlineItem {
+	items := make([]outlineItem, 0)
+	add := func(kind, name string, ident *ast.Ident) {
+		if ident.Name == "_" {
+			return
+		}
+
+		items = append(items, outlineItem{kind: kind, name: name, pos: sourcePos(fset, src, ident.Pos())})
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				add("method", "("+types.ExprString(d.Recv.List[0].Type)+") "+d.Name.Name, d.Name)
+			} else {
+				add("func", d.Name.Name, d.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					add("type", s.Name.Name, s.Name)
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						add(d.Tok.String(), name.Name, name)
+					}
+				}
+			}
+		}
+	}
+
+	return items
+}
+
+// Positions reported by the parser count bytes, the editor counts runes
+func sourcePos(fset *token.FileSet, src []byte, pos token.Pos) textPos {
+	position := fset.Position(pos)
+	offset := min(position.Offset, len(src))
+	lineStart := offset - (position.Column - 1)
+	if lineStart < 0 {
+		return textPos{row: position.Line - 1}
+	}
+
+	return textPos{row: position.Line - 1, col: utf8.RuneCount(src[lineStart:offset])}
+}
+
+// The code is parsed once typing pauses, to list its declarations and find
+// what can be folded
+func (e *editor) structureChanged() {
+	if e.structureTimer != nil {
+		e.structureTimer.Stop()
+	}
+	e.structureTimer = time.AfterFunc(STRUCTURE_DELAY, e.updateStructure)
+}
+
+// Code with syntax errors still gets an outline of the declarations the
+// parser could make sense of, while the folds found before are kept as
+// the ones it finds may be off. Parsed on the timer's goroutine, what is
+// found is installed on the UI one if the code is still the same
+func (e *editor) updateStructure() {
+	code := e.Text()
+	src := []byte(code)
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "main.go", src, parser.ParseComments|parser.SkipObjectResolution)
+	if file == nil {
+		return
+	}
+
+	var folds []foldRange
+	if err == nil {
+		folds = foldRanges(fset, file)
+	}
+	items := outlineItems(fset, file, src)
+	runOnUI(func() {
+		if e.Text() != code {
+			return
+		}
+
+		if err == nil {
+			e.setFolds(folds)
+		}
+		if e.onOutline != nil {
+			e.onOutline(items)
+		}
+	})
+}
+
+// Lists the declarations of a tab's code, clicking one moves the cursor to it
+type outline struct {
+	editor	*editor
+	items	[]outlineItem
+	list	*widget.List
+	*fyne.Container
+}
+
+func newOutline(e *editor) *outline {
+	o := &outline{editor: e}
+	o.list = widget.NewList(
+		func() int {
+			return len(o.items)
+		},
+		func() fyne.CanvasObject {
+			kind := widget.NewLabel("method")
+			kind.Importance = widget.LowImportance
+			name := widget.NewLabel("name")
+			name.Truncation = fyne.TextTruncateEllipsis
+			return container.NewBorder(nil, nil, kind, nil, name)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			item := o.items[id]
+			row := obj.(*fyne.Container)
+			row.Objects[0].(*widget.Label).SetText(item.name)
+			row.Objects[1].(*widget.Label).SetText(item.kind)
+		},
+	)
+	o.list.OnSelected = func(id widget.ListItemID) {
+		o.list.UnselectAll()
+		if id < len(o.items) {
+			e.setCursor(o.items[id].pos)
+			e.requestFocus()
+		}
+	}
+
+	// Lists have no width of their own
+	width := canvas.NewRectangle(color.Transparent)
+	width.SetMinSize(fyne.NewSize(OUTLINE_WIDTH, 0))
+	o.Container = container.NewStack(width, o.list)
+	o.Container.Hide()
+
+	return o
+}
+
+func (o *outline) setItems(items []outlineItem) {
+	o.items = items
+	o.list.Refresh()
+}
+
+func (o *outline) toggle() {
+	if o.Container.Visible() {
+		o.Container.Hide()
+	} else {
+		o.Container.Show()
+	}
+}
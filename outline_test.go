@@ -0,0 +1,70 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The code is parsed in the background while it is typed, run with -race
+func TestUpdateStructure(t *testing.T) {
+	tests := []struct {
+		name		string
+		code		string
+		typed		string
+		wantItems	[]string
+		wantFolds	[]foldRange
+	}{
+		{
+			name: "declarations",
+			code: "package main\n\ntype T int\n\nfunc main() {\n\tprintln()\n}\n",
+			wantItems: []string{"T", "main"},
+			wantFolds: []foldRange{{start: 4, end: 5}},
+		},
+		{
+			name: "declaration typed while parsing",
+			code: "package main\n\nfunc main() {\n\tprintln()\n}\n",
+			typed: "\nvar x = 1\n",
+			wantItems: []string{"main", "x"},
+			wantFolds: []foldRange{{start: 2, end: 3}},
+		},
+		{
+			name: "syntax error typed while parsing",
+			code: "package main\n\nfunc main() {\n\tprintln()\n}\n",
+			typed: "\nfunc (\n",
+			wantItems: []string{"main"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queue := queueUI(t)
+			e := playgroundEditor(playgroundConsole(), nil, newErrorBanner())
+			var got []string
+			e.onOutline = func(items []outlineItem) {
+				got = []string{}
+				for _, item := range items {
+					got = append(got, item.name)
+				}
+			}
+			e.SetText(test.code)
+
+			go e.updateStructure()
+			e.cursor = e.buf.end()
+			e.anchor = e.cursor
+			e.insert(test.typed)
+
+			waitUI(t, queue, func() bool { return got != nil })
+
+			if !reflect.DeepEqual(got, test.wantItems) {
+				t.Errorf("got items %q, want %q", got, test.wantItems)
+			}
+			if len(e.folds) != len(test.wantFolds) || len(e.folds) > 0 && !reflect.DeepEqual(e.folds, test.wantFolds) {
+				t.Errorf("got folds %+v, want %+v", e.folds, test.wantFolds)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Errors and warnings of every source in the order they appear, the ones
+// reported by more than one source such as gopls and the type checker are
+// listed once
+func (e *editor) problems() []marker {
+	type key struct {
+		row		int
+		message	string
+	}
+
+	e.markersMu.Lock()
+	defer e.markersMu.Unlock()
+
+	seen := make(map[key]bool)
+	problems := make([]marker, 0)
+	for _, markers := range e.markers {
+		for _, m := range markers {
+			k := key{row: m.row, message: m.message}
+			if m.kind >= markerWarning && !seen[k] {
+				seen[k] = true
+				problems = append(problems, m)
+			}
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i], problems[j]
+		if a.row != b.row {
+			return a.row < b.row
+		}
+		if a.col != b.col {
+			return a.col < b.col
+		}
+		return a.kind > b.kind
+	})
+
+	return problems
+}
+
+// Lists the problems of a tab's code, clicking one moves the cursor to it
+type problemsPanel struct {
+	editor		*editor
+	problems	[]marker
+	list		*widget.List
+	*fyne.Container
+}
+
+func newProblemsPanel(e *editor) *problemsPanel {
+	p := &problemsPanel{editor: e}
+	p.list = widget.NewList(
+		func() int {
+			return len(p.problems)
+		},
+		func() fyne.CanvasObject {
+			message := widget.NewLabel("message")
+			message.Truncation = fyne.TextTruncateEllipsis
+			return container.NewBorder(nil, nil, widget.NewIcon(theme.ErrorIcon()), nil, message)
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			problem := p.problems[id]
+			row := obj.(*fyne.Container)
+			row.Objects[0].(*widget.Label).SetText(fmt.Sprintf("Ln %d: %s", problem.row+1, problem.message))
+			icon := theme.WarningIcon()
+			if problem.kind == markerError {
+				icon = theme.ErrorIcon()
+			}
+			row.Objects[1].(*widget.Icon).SetResource(icon)
+		},
+	)
+	p.list.OnSelected = func(id widget.ListItemID) {
+		p.list.UnselectAll()
+		if id < len(p.problems) {
+			e.setCursor(textPos{row: p.problems[id].row, col: p.problems[id].col})
+			e.requestFocus()
+		}
+	}
+
+	// Lists have no height of their own
+	height := canvas.NewRectangle(color.Transparent)
+	height.SetMinSize(fyne.NewSize(0, PROBLEMS_HEIGHT))
+	p.Container = container.NewStack(height, p.list)
+	p.Container.Hide()
+
+	return p
+}
+
+func (p *problemsPanel) refresh() {
+	p.problems = p.editor.problems()
+	p.list.Refresh()
+}
+
+func (p *problemsPanel) toggle() {
+	if p.Container.Visible() {
+		p.Container.Hide()
+	} else {
+		p.Container.Show()
+	}
+}
@@ -0,0 +1,372 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/theme"
+)
+
+// Only the visible part of the code is drawn, text and rectangles are
+// pooled and reused between refreshes so scrolling doesn't allocate
+type editorRenderer struct {
+	editor		*editor
+	background	*canvas.Rectangle
+	cursor		*canvas.Rectangle
+	texts		[]*canvas.Text
+	rects		[]*canvas.Rectangle
+	objects		[]fyne.CanvasObject
+	usedTexts	int
+	usedRects	int
+	rows		[]int
+}
+
+func (r *editorRenderer) Destroy() {}
+
+func (r *editorRenderer) Layout(size fyne.Size) {
+	r.background.Resize(size)
+	r.update()
+}
+
+func (r *editorRenderer) MinSize() fyne.Size {
+	charWidth, lineHeight := r.editor.metrics()
+	return fyne.NewSize(charWidth*20, lineHeight*3).Add(fyne.NewSize(theme.Padding()*2, theme.Padding()*2))
+}
+
+func (r *editorRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *editorRenderer) Refresh() {
+	r.background.FillColor = theme.InputBackgroundColor()
+	r.background.Refresh()
+	r.update()
+}
+
+func (r *editorRenderer) text(content string, col color.Color, pos fyne.Position) {
+	if r.usedTexts == len(r.texts) {
+		t := canvas.NewText("", col)
+		t.TextStyle = fyne.TextStyle{Monospace: true}
+		r.texts = append(r.texts, t)
+	}
+
+	t := r.texts[r.usedTexts]
+	r.usedTexts++
+
+	if t.Text != content || t.Color != col || t.TextSize != theme.TextSize() || t.Hidden {
+		t.Text = content
+		t.Color = col
+		t.TextSize = theme.TextSize()
+		t.Show()
+		t.Refresh()
+	}
+	t.Move(pos)
+	t.Resize(t.MinSize())
+}
+
+func (r *editorRenderer) rect(col color.Color, pos fyne.Position, size fyne.Size, radius float32) {
+	if r.usedRects == len(r.rects) {
+		r.rects = append(r.rects, canvas.NewRectangle(col))
+	}
+
+	rect := r.rects[r.usedRects]
+	r.usedRects++
+
+	if rect.FillColor != col || rect.CornerRadius != radius || rect.Hidden {
+		rect.FillColor = col
+		rect.CornerRadius = radius
+		rect.Show()
+		rect.Refresh()
+	}
+	rect.Move(pos)
+	rect.Resize(size)
+}
+
+func (r *editorRenderer) update() {
+	e := r.editor
+	charWidth, lineHeight := e.metrics()
+	origin := e.textOrigin()
+	cols := e.visibleCols()
+	r.rows = e.displayedRows()
+	first, last := e.top, r.rows[len(r.rows)-1]
+	r.usedTexts, r.usedRects = 0, 0
+
+	e.highlighter.update(e.buf.lines, last)
+
+	cursorY, cursorShown := r.rowY(e.cursor.row)
+	if !e.hasSelection() && cursorShown {
+		r.rect(theme.HoverColor(), fyne.NewPos(0, cursorY), fyne.NewSize(e.Size().Width, lineHeight), 0)
+	}
+	r.gutter()
+
+	// Matches of the search, only the ones that are visible
+	for _, m := range e.matches {
+		if m.end.row >= first && m.start.row <= last {
+			r.textRange(m.start, m.end, theme.FocusColor(), cols)
+		}
+	}
+
+	if e.hasSelection() {
+		start, end := orderPos(e.anchor, e.cursor)
+		r.textRange(start, end, theme.SelectionColor(), cols)
+	}
+
+	r.underlines(cols)
+
+	for i, row := range r.rows {
+		r.line(row, origin.Y+float32(i)*lineHeight, cols)
+	}
+
+	for _, t := range r.texts[r.usedTexts:] {
+		t.Hide()
+	}
+	for _, rect := range r.rects[r.usedRects:] {
+		rect.Hide()
+	}
+
+	col := visualCol(e.buf.line(e.cursor.row), e.cursor.col)
+	r.cursor.FillColor = theme.PrimaryColor()
+	r.cursor.Hidden = !e.focused || !cursorShown || col < e.left || col > e.left+cols
+	r.cursor.Move(fyne.NewPos(origin.X+float32(col-e.left)*charWidth, cursorY))
+	r.cursor.Resize(fyne.NewSize(theme.InputBorderSize()*2, lineHeight))
+
+	// Modes such as vim's normal mode cover the character under the cursor,
+	// a tab is covered whole
+	if mode := e.keyMode(); mode != nil {
+		if pos, ok := mode.blockCursor(); ok {
+			line := e.buf.line(pos.row)
+			col = visualCol(line, pos.col)
+			width := 1
+			if pos.col < len(line) {
+				width = visualCol(line, pos.col+1) - col
+			}
+
+			y, shown := r.rowY(pos.row)
+			primary := color.NRGBAModel.Convert(theme.PrimaryColor()).(color.NRGBA)
+			primary.A = 0x80
+			r.cursor.FillColor = primary
+			r.cursor.Hidden = !e.focused || !shown || col < e.left || col > e.left+cols
+			r.cursor.Move(fyne.NewPos(origin.X+float32(col-e.left)*charWidth, y))
+			r.cursor.Resize(fyne.NewSize(float32(width)*charWidth, lineHeight))
+		}
+	}
+	r.cursor.Refresh()
+
+	r.objects = r.objects[:0]
+	r.objects = append(r.objects, r.background)
+	for _, rect := range r.rects {
+		r.objects = append(r.objects, rect)
+	}
+	for _, t := range r.texts {
+		r.objects = append(r.objects, t)
+	}
+	r.objects = append(r.objects, r.cursor)
+}
+
+// Where the given line is drawn, if it's visible
+func (r *editorRenderer) rowY(row int) (float32, bool) {
+	_, lineHeight := r.editor.metrics()
+	i := sort.SearchInts(r.rows, row)
+	if i == len(r.rows) || r.rows[i] != row {
+		return 0, false
+	}
+
+	return r.editor.textOrigin().Y + float32(i)*lineHeight, true
+}
+
+// Highlights the text between two positions, including the line breaks
+// between the lines it spans
+func (r *editorRenderer) textRange(start, end textPos, col color.Color, cols int) {
+	e := r.editor
+	charWidth, lineHeight := e.metrics()
+	origin := e.textOrigin()
+
+	for i, row := range r.rows {
+		if row < start.row || row > end.row {
+			continue
+		}
+
+		line := e.buf.line(row)
+		from, to := 0, visualCol(line, len(line))+1
+		if row == start.row {
+			from = visualCol(line, start.col)
+		}
+		if row == end.row {
+			to = visualCol(line, end.col)
+		}
+
+		from, to = max(from, e.left), min(to, e.left+cols)
+		if to > from {
+			r.rect(col, fyne.NewPos(origin.X+float32(from-e.left)*charWidth, origin.Y+float32(i)*lineHeight), fyne.NewSize(float32(to-from)*charWidth, lineHeight), 0)
+		}
+	}
+}
+
+// Underlines the text markers point at, the most severe marker is drawn
+// last so it's the one seen when they overlap
+func (r *editorRenderer) underlines(cols int) {
+	e := r.editor
+	charWidth, lineHeight := e.metrics()
+	origin := e.textOrigin()
+	thickness := theme.InputBorderSize()
+
+	for i, row := range r.rows {
+		markers := e.markersAt(row)
+		line := e.buf.line(row)
+		for j := len(markers) - 1; j >= 0; j-- {
+			m := markers[j]
+			if m.endCol <= m.col {
+				continue
+			}
+
+			from, to := max(visualCol(line, m.col), e.left), min(visualCol(line, m.endCol), e.left+cols)
+			if to > from {
+				y := origin.Y + float32(i+1)*lineHeight - thickness
+				r.rect(m.kind.color(), fyne.NewPos(origin.X+float32(from-e.left)*charWidth, y), fyne.NewSize(float32(to-from)*charWidth, thickness), 0)
+			}
+		}
+	}
+}
+
+// Line numbers, with the most severe marker of each line to their left
+// and a toggle to their right for the lines that can be folded
+func (r *editorRenderer) gutter() {
+	e := r.editor
+	charWidth, lineHeight := e.metrics()
+	origin := e.textOrigin()
+	digits := e.gutterDigits()
+
+	for i, row := range r.rows {
+		y := origin.Y + float32(i)*lineHeight
+		number := strconv.Itoa(row + 1)
+		col := theme.DisabledColor()
+		if row == e.cursor.row {
+			col = theme.ForegroundColor()
+		}
+		r.text(number, col, fyne.NewPos(theme.Padding()+float32(digits+1-len(number))*charWidth, y))
+
+		markers := e.markersAt(row)
+		if len(markers) > 0 {
+			diameter := min(charWidth, lineHeight/2)
+			r.rect(markers[0].kind.color(), fyne.NewPos(theme.Padding()+(charWidth-diameter)/2, y+(lineHeight-diameter)/2), fyne.NewSize(diameter, diameter), diameter/2)
+		}
+
+		f, ok := e.foldAt(row)
+		if ok {
+			toggle := FOLD_OPEN_MARK
+			if f.folded {
+				toggle = FOLD_CLOSED_MARK
+			}
+			r.text(toggle, theme.DisabledColor(), fyne.NewPos(e.foldToggleX(), y))
+		}
+	}
+}
+
+// Draws a line as runs of text sharing the same color, cut to the columns
+// that fit in the editor
+func (r *editorRenderer) line(row int, y float32, cols int) {
+	e := r.editor
+	charWidth, _ := e.metrics()
+	origin := e.textOrigin()
+	line := e.buf.line(row)
+
+	segment := func(from, to int, col color.Color) {
+		if to <= from {
+			return
+		}
+
+		start := visualCol(line, from)
+		text := expandTabs(line[from:to], start)
+		if start < e.left {
+			skip := min(e.left-start, len(text))
+			text, start = text[skip:], e.left
+		}
+		if end := start + len(text); end > e.left+cols {
+			text = text[:max(0, len(text)-(end-e.left-cols))]
+		}
+
+		if len(strings.TrimSpace(string(text))) > 0 {
+			r.text(string(text), col, fyne.NewPos(origin.X+float32(start-e.left)*charWidth, y))
+		}
+	}
+
+	col := 0
+	for _, s := range e.highlighter.line(row) {
+		if s.start >= len(line) {
+			break
+		}
+
+		segment(col, s.start, theme.ForegroundColor())
+		segment(s.start, min(s.end, len(line)), syntaxColor(s.class))
+		col = min(s.end, len(line))
+	}
+	segment(col, len(line), theme.ForegroundColor())
+
+	// Folded lines are hinted at after the line they are folded into
+	f, ok := e.foldAt(row)
+	if ok && f.folded {
+		start := visualCol(line, len(line)) + 1 - e.left
+		if start >= 0 && start < cols {
+			r.text(FOLDED_MARK, theme.DisabledColor(), fyne.NewPos(origin.X+float32(start)*charWidth, y))
+		}
+	}
+}
+
+// Columns as displayed, tabs take up to TAB_WIDTH columns
+func visualCol(line []rune, col int) int {
+	v := 0
+	for _, r := range line[:min(col, len(line))] {
+		if r == '\t' {
+			v = (v/TAB_WIDTH + 1) * TAB_WIDTH
+		} else {
+			v++
+		}
+	}
+
+	return v
+}
+
+// The column closest to the given displayed column
+func colAtVisual(line []rune, v int) int {
+	current := 0
+	for i, r := range line {
+		width := 1
+		if r == '\t' {
+			width = TAB_WIDTH - current%TAB_WIDTH
+		}
+
+		if v < current+(width+1)/2 {
+			return i
+		}
+		current += width
+	}
+
+	return len(line)
+}
+
+// Replaces tabs with the spaces they take when displayed from the given
+// column onwards
+func expandTabs(runes []rune, start int) []rune {
+	expanded := make([]rune, 0, len(runes))
+	for _, r := range runes {
+		if r == '\t' {
+			width := TAB_WIDTH - (start+len(expanded))%TAB_WIDTH
+			for i := 0; i < width; i++ {
+				expanded = append(expanded, ' ')
+			}
+			continue
+		}
+
+		expanded = append(expanded, r)
+	}
+
+	return expanded
+}
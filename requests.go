@@ -18,7 +18,7 @@ import (
 	"golang.org/x/mod/semver"
 )
 
-// Downloads the specified Go source .tar or .zip file in RUNGO_APP_DIR directory
+// Downloads the specified Go source .tar or .zip file in RUNGO_CACHE_DIR directory
 func getGoSource(file, dst string) error {
 	res, err := http.Get(fmt.Sprintf("%s/dl/%s", GO_URL, file))
 	if err != nil {
@@ -0,0 +1,222 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// How a tab's code is built and run. Empty fields leave the go command's
+// defaults, and the environment of RunGo, as they are
+type runConfig struct {
+	Args			[]string	`json:"args,omitempty"`
+	Env				[]string	`json:"env,omitempty"`
+	Tags			[]string	`json:"tags,omitempty"`
+	BuildFlags		[]string	`json:"build_flags,omitempty"`
+	CGOEnabled		string		`json:"cgo_enabled,omitempty"`
+	GOOS			string		`json:"goos,omitempty"`
+	GOARCH			string		`json:"goarch,omitempty"`
+	GOEXPERIMENT	string		`json:"goexperiment,omitempty"`
+}
+
+func (r runConfig) isZero() bool {
+	return len(r.Args) == 0 && len(r.environ()) == 0 && len(r.buildFlags()) == 0
+}
+
+// The flags go run and go test are given before the package
+func (r runConfig) buildFlags() []string {
+	flags := make([]string, 0, len(r.BuildFlags)+1)
+	if len(r.Tags) > 0 {
+		flags = append(flags, "-tags="+strings.Join(r.Tags, ","))
+	}
+
+	return append(flags, r.BuildFlags...)
+}
+
+// The variables added to the environment of the go command, which passes
+// them on to the program
+func (r runConfig) environ() []string {
+	env := append([]string{}, r.Env...)
+	for _, v := range []struct{ key, value string }{
+		{key: "CGO_ENABLED", value: r.CGOEnabled},
+		{key: "GOOS", value: r.GOOS},
+		{key: "GOARCH", value: r.GOARCH},
+		{key: "GOEXPERIMENT", value: r.GOEXPERIMENT},
+	} {
+		if len(v.value) > 0 {
+			env = append(env, v.key+"="+v.value)
+		}
+	}
+
+	return env
+}
+
+// The arguments of go build for the given file, the program's are given to
+// the binary when it's run
+func (r runConfig) buildArgs(binary, file string) []string {
+	args := append([]string{"build", "-o", binary}, r.buildFlags()...)
+	return append(args, file)
+}
+
+// The arguments of go test, the program's are passed on to the test binary
+func (r runConfig) testArgs() []string {
+	args := append([]string{"test", "-v"}, r.buildFlags()...)
+	args = append(args, "./...")
+	if len(r.Args) > 0 {
+		args = append(append(args, "-args"), r.Args...)
+	}
+
+	return args
+}
+
+// The command as it would be typed in a shell, shown above the output of
+// the runs it applies to
+func (r runConfig) commandLine(args []string) string {
+	return joinArgs(append(r.environ(), args...))
+}
+
+// Arguments are quoted only when a shell would split or expand them, in a
+// way splitArgs reads back as they were
+func quoteArg(arg string) string {
+	if len(arg) > 0 && !strings.ContainsAny(arg, " \t\n\"'\\$`*?[]{}()<>|&;#~") {
+		return arg
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range arg {
+		if strings.ContainsRune("\"\\$`", r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+func joinArgs(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, quoteArg(arg))
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// Splits arguments as a shell would, without expanding anything. Single
+// quotes keep everything as is, double quotes and backslashes escape
+func splitArgs(text string) ([]string, error) {
+	args := make([]string, 0)
+	var arg strings.Builder
+	inArg, quote, escaped := false, rune(0), false
+	for _, r := range text {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	} else if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
+
+// Variables are given one per line as KEY=value, blank lines are ignored
+func parseEnv(text string) ([]string, error) {
+	env := make([]string, 0)
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		key, _, ok := strings.Cut(line, "=")
+		if !ok || len(key) == 0 || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d is not KEY=value", i+1)
+		}
+		env = append(env, line)
+	}
+
+	return env, nil
+}
+
+// Build tags are separated by commas or spaces, as go build used to take
+func parseTags(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+func runConfigPath(snippet string) string {
+	return filepath.Join(snippetDir(snippet), RUN_CONFIG_FILE)
+}
+
+// Snippets without a configuration are run with the defaults
+func readRunConfig(snippet string) (runConfig, error) {
+	var r runConfig
+	data, err := os.ReadFile(runConfigPath(snippet))
+	if os.IsNotExist(err) {
+		return r, nil
+	} else if err != nil {
+		return r, err
+	}
+
+	err = json.Unmarshal(data, &r)
+	return r, err
+}
+
+// The configuration is kept next to the snippet's code, the defaults are
+// kept by not having one
+func writeRunConfig(snippet string, r runConfig) error {
+	if r.isZero() {
+		return removeIfExists(runConfigPath(snippet))
+	}
+
+	data, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(runConfigPath(snippet), data, 0644)
+}
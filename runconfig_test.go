@@ -0,0 +1,207 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		text	string
+		want	[]string
+		wantErr	bool
+	}{
+		{text: "", want: []string{}},
+		{text: "  \t\n ", want: []string{}},
+		{text: "a b  c", want: []string{"a", "b", "c"}},
+		{text: "-v\t-n=1\nfile", want: []string{"-v", "-n=1", "file"}},
+		{text: `"a b" c`, want: []string{"a b", "c"}},
+		{text: `'a "b"' c`, want: []string{`a "b"`, "c"}},
+		{text: `"it's"`, want: []string{"it's"}},
+		{text: `'a\b'`, want: []string{`a\b`}},
+		{text: `"a \"b\""`, want: []string{`a "b"`}},
+		{text: `a\ b`, want: []string{"a b"}},
+		{text: `pre"quoted"post`, want: []string{"prequotedpost"}},
+		{text: `"" ''`, want: []string{"", ""}},
+		{text: `$HOME *`, want: []string{"$HOME", "*"}},
+		{text: `"a`, wantErr: true},
+		{text: `'a`, wantErr: true},
+		{text: `a\`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			got, err := splitArgs(test.text)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %t", err, test.wantErr)
+			}
+			if !test.wantErr && !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQuoteArg(t *testing.T) {
+	tests := []struct {
+		arg		string
+		want	string
+	}{
+		{arg: "plain", want: "plain"},
+		{arg: "-tags=x,y", want: "-tags=x,y"},
+		{arg: "/tmp/main.go", want: "/tmp/main.go"},
+		{arg: "", want: `""`},
+		{arg: "a b", want: `"a b"`},
+		{arg: `say "hi"`, want: `"say \"hi\""`},
+		{arg: "it's", want: `"it's"`},
+		{arg: "$HOME", want: `"\$HOME"`},
+		{arg: "`cmd`", want: "\"\\`cmd\\`\""},
+		{arg: `C:\Go`, want: `"C:\\Go"`},
+		{arg: "a\tb", want: "\"a\tb\""},
+		{arg: "a\nb", want: "\"a\nb\""},
+		{arg: "*.go", want: `"*.go"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.arg, func(t *testing.T) {
+			got := quoteArg(test.arg)
+			if got != test.want {
+				t.Fatalf("got %s, want %s", got, test.want)
+			}
+
+			// What is shown can be pasted back as arguments
+			args, err := splitArgs(got)
+			if err != nil || len(args) != 1 || args[0] != test.arg {
+				t.Errorf("%s splits into %q, %v", got, args, err)
+			}
+		})
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	tests := []struct {
+		name	string
+		text	string
+		want	[]string
+		wantErr	bool
+	}{
+		{name: "empty", text: "", want: []string{}},
+		{name: "variables", text: "A=1\nB=two words", want: []string{"A=1", "B=two words"}},
+		{name: "blank lines and spaces", text: "\n  A=1  \n\n\tB=\n", want: []string{"A=1", "B="}},
+		{name: "value with equal signs", text: "A=b=c", want: []string{"A=b=c"}},
+		{name: "crlf line endings", text: "A=1\r\nB=2\r\n", want: []string{"A=1", "B=2"}},
+		{name: "missing equal sign", text: "A=1\nB", wantErr: true},
+		{name: "missing key", text: "=1", wantErr: true},
+		{name: "key with spaces", text: "A B=1", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseEnv(test.text)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %t", err, test.wantErr)
+			}
+			if !test.wantErr && !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		text	string
+		want	[]string
+	}{
+		{text: "", want: []string{}},
+		{text: "x", want: []string{"x"}},
+		{text: "x,y", want: []string{"x", "y"}},
+		{text: " x, y  z ,", want: []string{"x", "y", "z"}},
+	}
+
+	for _, test := range tests {
+		if got := parseTags(test.text); !slices.Equal(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestRunConfigArgs(t *testing.T) {
+	config := runConfig{
+		Args: []string{"-v", "a b"},
+		Env: []string{"FOO=bar baz"},
+		Tags: []string{"x", "y"},
+		BuildFlags: []string{"-race"},
+		CGOEnabled: "0",
+		GOOS: "linux",
+	}
+
+	tests := []struct {
+		name	string
+		config	runConfig
+		args	[]string
+		want	string
+	}{
+		{name: "default build", args: append([]string{"go"}, runConfig{}.buildArgs("/tmp/main", "main.go")...), want: "go build -o /tmp/main main.go"},
+		{name: "default test", args: append([]string{"go"}, runConfig{}.testArgs()...), want: "go test -v ./..."},
+		{name: "build", config: config, args: append([]string{"go"}, config.buildArgs("/tmp/run 1/main", "main.go")...), want: `"FOO=bar baz" CGO_ENABLED=0 GOOS=linux go build -o "/tmp/run 1/main" -tags=x,y -race main.go`},
+		{name: "test", config: config, args: append([]string{"go"}, config.testArgs()...), want: `"FOO=bar baz" CGO_ENABLED=0 GOOS=linux go test -v -tags=x,y -race ./... -args -v "a b"`},
+		{name: "program", config: config, args: append([]string{"/tmp/main"}, config.Args...), want: `"FOO=bar baz" CGO_ENABLED=0 GOOS=linux /tmp/main -v "a b"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.config.commandLine(test.args); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRunConfigPersistence(t *testing.T) {
+	t.Setenv("RUNGO_DATA_DIR", t.TempDir())
+	err := os.MkdirAll(snippetDir("snippet"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name	string
+		config	runConfig
+		// Whether a file is kept for it
+		saved	bool
+	}{
+		{name: "defaults", config: runConfig{}},
+		{name: "arguments", config: runConfig{Args: []string{"a b"}}, saved: true},
+		{name: "every field", config: runConfig{Args: []string{"a"}, Env: []string{"A=1"}, Tags: []string{"x"}, BuildFlags: []string{"-race"}, CGOEnabled: "1", GOOS: "linux", GOARCH: "amd64", GOEXPERIMENT: "loopvar"}, saved: true},
+		{name: "back to the defaults", config: runConfig{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := writeRunConfig("snippet", test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = os.Stat(runConfigPath("snippet"))
+			if saved := err == nil; saved != test.saved {
+				t.Errorf("got file kept %t, want %t", saved, test.saved)
+			}
+
+			got, err := readRunConfig("snippet")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(got.environ(), " ") != strings.Join(test.config.environ(), " ") || !slices.Equal(got.Args, test.config.Args) || !slices.Equal(got.buildFlags(), test.config.buildFlags()) {
+				t.Errorf("got %+v, want %+v", got, test.config)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// What a run of a tab's code printed and how it ended, along with the code
+// so it can be restored
+type runRecord struct {
+	id			int
+	started		time.Time
+	goVersion	string
+	code		string
+	hash		string
+	exitCode	int
+	duration	time.Duration
+	stdout		string
+	stderr		string
+}
+
+func (r runRecord) summary() string {
+	return fmt.Sprintf("#%d  %s  %s  %s  %s  %s", r.id, r.started.Format("15:04:05"), r.goVersion, r.status(), r.duration.Round(time.Millisecond), r.hash)
+}
+
+// How the run ended, runs that didn't exit on their own were stopped
+func (r runRecord) status() string {
+	switch {
+	case r.exitCode == RUN_BUILD_FAILED:
+		return "build failed"
+	case r.exitCode < 0:
+		return "stopped"
+	}
+
+	return fmt.Sprintf("exit %d", r.exitCode)
+}
+
+// Standard output followed by standard error, as they are compared
+func (r runRecord) output() string {
+	if len(r.stdout) > 0 && len(r.stderr) > 0 && !strings.HasSuffix(r.stdout, "\n") {
+		return r.stdout + "\n" + r.stderr
+	}
+
+	return r.stdout + r.stderr
+}
+
+// Identifies the code of a run, runs of the same code share it
+func sourceHash(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// The runs of a tab, the oldest are dropped past RUN_HISTORY_LIMIT. Runs
+// finish in the background, so the history is locked
+type runHistory struct {
+	mu		sync.Mutex
+	runs	[]runRecord
+	next	int
+}
+
+func (h *runHistory) add(r runRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.next++
+	r.id = h.next
+	h.runs = append(h.runs, r)
+	if len(h.runs) > RUN_HISTORY_LIMIT {
+		h.runs = h.runs[len(h.runs)-RUN_HISTORY_LIMIT:]
+	}
+}
+
+// The runs kept, the latest first
+func (h *runHistory) list() []runRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	runs := make([]runRecord, 0, len(h.runs))
+	for i := len(h.runs) - 1; i >= 0; i-- {
+		runs = append(runs, h.runs[i])
+	}
+
+	return runs
+}
+
+// Keeps up to RUN_OUTPUT_LIMIT bytes of what is written to it, the rest is
+// dropped but reported as written so the program keeps running
+type cappedBuffer struct {
+	buf	bytes.Buffer
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := max(0, min(len(p), RUN_OUTPUT_LIMIT-b.buf.Len()))
+	b.buf.Write(p[:n])
+	return len(p), nil
+}
+
+// The text as the console shows it, without escape sequences
+func (b *cappedBuffer) String() string {
+	return stripANSI(b.buf.String())
+}
+
+// Programs that exit with an error are not an error to the app, only the
+// ones that couldn't be started are
+func exitCode(err error) (int, error) {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0, nil
+	case errors.As(err, &exitErr):
+		return exitErr.ExitCode(), nil
+	}
+
+	return -1, err
+}
+
+type diffKind int
+
+const (
+	diffSame diffKind = iota
+	diffRemoved
+	diffAdded
+	// Where the other side has lines this one doesn't
+	diffBlank
+)
+
+// A row of a side by side diff
+type diffRow struct {
+	left		string
+	right		string
+	leftKind	diffKind
+	rightKind	diffKind
+}
+
+// Compares two texts line by line, the lines changed between matching
+// ones are paired up so they are shown side by side
+func diffLines(a, b []string) []diffRow {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	rows := make([]diffRow, 0, max(len(a), len(b)))
+	for _, line := range a[:prefix] {
+		rows = append(rows, diffRow{left: line, right: line})
+	}
+	rows = append(rows, diffChanged(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		rows = append(rows, diffRow{left: line, right: line})
+	}
+
+	return rows
+}
+
+// Matches the lines that changed with their longest common subsequence,
+// when there are too many to compare them all are shown as changed
+func diffChanged(a, b []string) []diffRow {
+	rows := make([]diffRow, 0)
+	removed, added := make([]string, 0), make([]string, 0)
+	pair := func() {
+		for i := 0; i < max(len(removed), len(added)); i++ {
+			row := diffRow{leftKind: diffBlank, rightKind: diffBlank}
+			if i < len(removed) {
+				row.left, row.leftKind = removed[i], diffRemoved
+			}
+			if i < len(added) {
+				row.right, row.rightKind = added[i], diffAdded
+			}
+			rows = append(rows, row)
+		}
+		removed, added = removed[:0], added[:0]
+	}
+
+	n, m := len(a), len(b)
+	if n*m > DIFF_LIMIT {
+		removed, added = append(removed, a...), append(added, b...)
+		pair()
+		return rows
+	}
+
+	// The length of the common subsequence of a[i:] and b[j:]
+	common := make([]int32, (n+1)*(m+1))
+	at := func(i, j int) *int32 {
+		return &common[i*(m+1)+j]
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				*at(i, j) = *at(i+1, j+1) + 1
+			} else {
+				*at(i, j) = max(*at(i+1, j), *at(i, j+1))
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[i] == b[j]:
+			pair()
+			rows = append(rows, diffRow{left: a[i], right: b[j]})
+			i, j = i+1, j+1
+		case j == m || (i < n && *at(i+1, j) >= *at(i, j+1)):
+			removed = append(removed, a[i])
+			i++
+		default:
+			added = append(added, b[j])
+			j++
+		}
+	}
+	pair()
+
+	return rows
+}
+
+// One side of a diff as the console shows it, changed lines are marked as
+// diff does and colored when the console shows colors
+func diffText(rows []diffRow, right bool) string {
+	var b strings.Builder
+	for i, row := range rows {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+
+		line, kind := row.left, row.leftKind
+		if right {
+			line, kind = row.right, row.rightKind
+		}
+
+		switch kind {
+		case diffSame:
+			b.WriteString("  " + line)
+		case diffRemoved:
+			b.WriteString("\x1b[31m- " + line + "\x1b[0m")
+		case diffAdded:
+			b.WriteString("\x1b[32m+ " + line + "\x1b[0m")
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,202 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"fyne.io/fyne/v2/data/binding"
+)
+
+// Rows as "left|right", each side marked as unified diffs do and blanks
+// marked with a dot
+func diffRowStrings(rows []diffRow) []string {
+	marks := map[diffKind]string{diffSame: " ", diffRemoved: "-", diffAdded: "+", diffBlank: "."}
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		lines = append(lines, marks[row.leftKind]+row.left+"|"+marks[row.rightKind]+row.right)
+	}
+
+	return lines
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name	string
+		a		[]string
+		b		[]string
+		want	[]string
+	}{
+		{name: "both empty", a: []string{}, b: []string{}, want: []string{}},
+		{name: "same lines", a: []string{"x", "y"}, b: []string{"x", "y"}, want: []string{" x| x", " y| y"}},
+		{name: "changed line", a: []string{"x", "y", "z"}, b: []string{"x", "Y", "z"}, want: []string{" x| x", "-y|+Y", " z| z"}},
+		{name: "added line", a: []string{"x"}, b: []string{"x", "y"}, want: []string{" x| x", ".|+y"}},
+		{name: "removed line", a: []string{"x", "y"}, b: []string{"x"}, want: []string{" x| x", "-y|."}},
+		{name: "everything added", a: []string{}, b: []string{"x", "y"}, want: []string{".|+x", ".|+y"}},
+		{name: "changes paired up", a: []string{"a", "b", "c"}, b: []string{"d"}, want: []string{"-a|+d", "-b|.", "-c|."}},
+		{name: "common line between changes", a: []string{"a", "k", "b"}, b: []string{"c", "k", "d"}, want: []string{"-a|+c", " k| k", "-b|+d"}},
+		{name: "moved line", a: []string{"a", "b"}, b: []string{"b", "a"}, want: []string{"-a|.", " b| b", ".|+a"}},
+		{name: "repeated lines", a: []string{"x", "x", "x"}, b: []string{"x", "x"}, want: []string{" x| x", " x| x", "-x|."}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := diffRowStrings(diffLines(test.a, test.b)); !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// Past DIFF_LIMIT lines are not matched, so a common line in the middle of
+// the changes is shown as changed too
+func TestDiffLinesLimit(t *testing.T) {
+	a, b := make([]string, 0), make([]string, 0)
+	for i := 0; i < 2001; i++ {
+		a, b = append(a, fmt.Sprint("a", i)), append(b, fmt.Sprint("b", i))
+	}
+	a[1000], b[1000] = "k", "k"
+
+	rows := diffLines(a, b)
+	if len(rows) != len(a) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(a))
+	}
+	for _, row := range rows {
+		if row.leftKind != diffRemoved || row.rightKind != diffAdded {
+			t.Fatalf("got %q, want every line changed", diffRowStrings([]diffRow{row}))
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	exit3 := exec.Command("sh", "-c", "exit 3")
+	if runtime.GOOS == "windows" {
+		exit3 = exec.Command("cmd", "/c", "exit 3")
+	}
+	missing := exec.Command("run-go-missing-command").Run()
+
+	tests := []struct {
+		name	string
+		err		error
+		want	int
+		wantErr	bool
+	}{
+		{name: "success", err: nil, want: 0},
+		{name: "exit code", err: exit3.Run(), want: 3},
+		{name: "not started", err: missing, want: -1, wantErr: true},
+		{name: "other error", err: errors.New("failed"), want: -1, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := exitCode(test.err)
+			if got != test.want || (err != nil) != test.wantErr {
+				t.Errorf("got %d, %v, want %d with error %t", got, err, test.want, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunStatus(t *testing.T) {
+	tests := []struct {
+		exitCode	int
+		want		string
+	}{
+		{exitCode: 0, want: "exit 0"},
+		{exitCode: 2, want: "exit 2"},
+		{exitCode: -1, want: "stopped"},
+		{exitCode: RUN_BUILD_FAILED, want: "build failed"},
+	}
+
+	for _, test := range tests {
+		if got := (runRecord{exitCode: test.exitCode}).status(); got != test.want {
+			t.Errorf("exit code %d: got %q, want %q", test.exitCode, got, test.want)
+		}
+	}
+}
+
+func TestRunHistory(t *testing.T) {
+	var h runHistory
+	for i := 0; i < RUN_HISTORY_LIMIT+5; i++ {
+		h.add(runRecord{code: fmt.Sprint(i)})
+	}
+
+	runs := h.list()
+	if len(runs) != RUN_HISTORY_LIMIT {
+		t.Fatalf("got %d runs, want %d", len(runs), RUN_HISTORY_LIMIT)
+	}
+	if runs[0].id != RUN_HISTORY_LIMIT+5 || runs[len(runs)-1].id != 6 {
+		t.Errorf("got runs %d to %d, want %d to 6", runs[0].id, runs[len(runs)-1].id, RUN_HISTORY_LIMIT+5)
+	}
+}
+
+func TestCappedBuffer(t *testing.T) {
+	var b cappedBuffer
+	b.Write([]byte("\x1b[31mred\x1b[0m\n"))
+	n, err := b.Write([]byte(strings.Repeat("x", RUN_OUTPUT_LIMIT)))
+	if n != RUN_OUTPUT_LIMIT || err != nil {
+		t.Fatalf("got %d, %v, want every byte reported as written", n, err)
+	}
+
+	if b.buf.Len() != RUN_OUTPUT_LIMIT {
+		t.Errorf("kept %d bytes, want %d", b.buf.Len(), RUN_OUTPUT_LIMIT)
+	}
+	if !strings.HasPrefix(b.String(), "red\nxxx") {
+		t.Errorf("got %q, want the output without escape sequences", b.String()[:10])
+	}
+}
+
+// A run that is still printing when a newer one starts leaves no trace in
+// the console or the history
+func TestSupersededRun(t *testing.T) {
+	queue := queueUI(t)
+	e := playgroundEditor(playgroundConsole(), binding.NewString(), newErrorBanner())
+	records := make([]runRecord, 0)
+	e.onRun = func(r runRecord) {
+		records = append(records, r)
+	}
+
+	// Counts what is handed to the UI, so the first run's results are
+	// waited for even though they are dropped
+	var handedOver atomic.Int32
+	setUIQueue(func(fn func()) {
+		handedOver.Add(1)
+		queue <- fn
+	})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	e.execute("Running code", func(ctx context.Context, snippet string, data []byte, config runConfig, onCommand func(args []string), stdout, stderr io.Writer) (int, error) {
+		close(started)
+		<-release
+		fmt.Fprintln(stdout, "first")
+		return 1, nil
+	})
+	<-started
+	e.execute("Running code", func(ctx context.Context, snippet string, data []byte, config runConfig, onCommand func(args []string), stdout, stderr io.Writer) (int, error) {
+		fmt.Fprintln(stdout, "second")
+		return 0, nil
+	})
+	waitUI(t, queue, func() bool { return len(records) > 0 })
+
+	second := handedOver.Load()
+	close(release)
+	waitUI(t, queue, func() bool { return handedOver.Load() > second && len(queue) == 0 })
+
+	if len(records) != 1 || records[0].stdout != "second\n" {
+		t.Errorf("got runs %+v, want the second one only", records)
+	}
+	if got := e.console.String(); strings.Contains(got, "first") {
+		t.Errorf("got console %q, want no output of the first run", got)
+	}
+}
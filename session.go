@@ -0,0 +1,303 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type sessionTab struct {
+	Title			string		`json:"title"`
+	Snippet			string		`json:"snippet"`
+	Code			string		`json:"code"`
+	CursorRow		int			`json:"cursor_row"`
+	CursorColumn	int			`json:"cursor_column"`
+	Output			string		`json:"output"`
+	File			string		`json:"file,omitempty"`
+	RunConfig		*runConfig	`json:"run_config,omitempty"`
+}
+
+type session struct {
+	GoVersion	string			`json:"go_version"`
+	Selected	int				`json:"selected"`
+	Tabs		[]sessionTab	`json:"tabs"`
+}
+
+func sessionPath(file string) string {
+	return filepath.Join(os.Getenv("RUNGO_DATA_DIR"), file)
+}
+
+func readSession(file string) (session, error) {
+	var s session
+	data, err := os.ReadFile(sessionPath(file))
+	if err != nil {
+		return s, err
+	}
+
+	err = json.Unmarshal(data, &s)
+	return s, err
+}
+
+// Writes to a temporary file first, so a crash in the middle of writing
+// never leaves a truncated session behind
+func writeSession(file string, s session) error {
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	tmp := sessionPath(file + ".tmp")
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, sessionPath(file))
+}
+
+// The process holding the session's lock, if there is a lock
+func lockOwner() (int, bool) {
+	data, err := os.ReadFile(sessionPath(SESSION_LOCK))
+	if err != nil {
+		return 0, false
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		// Locks without a process are left by older releases
+		return 0, true
+	}
+
+	return pid, true
+}
+
+// The session is owned by another RunGo that is still running
+func lockedByOther() bool {
+	pid, ok := lockOwner()
+	return ok && pid != os.Getpid() && pid > 0 && processAlive(pid)
+}
+
+// Returns the session left by the previous run. If the lock file is still
+// around and the process that wrote it is gone, RunGo did not exit cleanly
+// and the last autosave is preferred
+func loadSession() (s session, crashed bool, err error) {
+	_, locked := lockOwner()
+	crashed = locked && !lockedByOther()
+
+	if crashed {
+		s, err = readSession(AUTOSAVE_FILE)
+		if err == nil {
+			return s, crashed, nil
+		} else if !os.IsNotExist(err) {
+			logger.Warn("readSession()", zap.Error(err))
+		}
+	}
+
+	s, err = readSession(SESSION_FILE)
+	if os.IsNotExist(err) {
+		return session{}, crashed, nil
+	}
+
+	return s, crashed, err
+}
+
+// The state of the tab without its output, read from its widgets so only
+// the UI goroutine can take it
+func (t *playgroundTab) state() sessionTab {
+	snippet, _ := t.snippet.Get()
+	tab := sessionTab{
+		Title: t.title,
+		Snippet: snippet,
+		Code: t.editor.Text(),
+		CursorRow: t.editor.cursor.row,
+		CursorColumn: t.editor.cursor.col,
+		File: t.editor.file,
+	}
+	if !t.editor.config.isZero() {
+		config := t.editor.config
+		tab.RunConfig = &config
+	}
+
+	return tab
+}
+
+// The console is locked on its own, so the output can be read from any
+// goroutine
+func (t *playgroundTab) snapshot() sessionTab {
+	tab := t.state()
+	tab.Output = t.console.String()
+	return tab
+}
+
+// Keeps a copy of the tab's state for the autosave, called from the UI
+// goroutine whenever the tab changes
+func (t *playgroundTab) publish() {
+	state := t.state()
+	t.sessionMu.Lock()
+	t.published = state
+	t.sessionMu.Unlock()
+}
+
+func (t *playgroundTab) publishedSnapshot() sessionTab {
+	t.sessionMu.Lock()
+	tab := t.published
+	t.sessionMu.Unlock()
+
+	tab.Output = t.console.String()
+	return tab
+}
+
+func (c *customAppTabs) snapshot() session {
+	s := session{GoVersion: os.Getenv("RUNGO_GO_VER"), Selected: c.SelectedIndex()}
+	for _, tab := range c.playgroundTabs() {
+		s.Tabs = append(s.Tabs, tab.snapshot())
+	}
+
+	return s
+}
+
+// Keeps the order of the tabs and the selected one for the autosave, called
+// from the UI goroutine whenever they change
+func (c *customAppTabs) publishSession() {
+	tabs := c.playgroundTabs()
+	c.sessionMu.Lock()
+	c.publishedTabs, c.publishedIndex = tabs, c.SelectedIndex()
+	c.sessionMu.Unlock()
+}
+
+// The session as last published, the autosave takes it from its own
+// goroutine without touching any widget
+func (c *customAppTabs) publishedSnapshot() session {
+	c.sessionMu.Lock()
+	tabs, selected := c.publishedTabs, c.publishedIndex
+	c.sessionMu.Unlock()
+
+	s := session{GoVersion: os.Getenv("RUNGO_GO_VER"), Selected: selected}
+	for _, tab := range tabs {
+		s.Tabs = append(s.Tabs, tab.publishedSnapshot())
+	}
+
+	return s
+}
+
+// Creates a tab out of a snapshot, the tab is returned even if some of its
+// state could not be restored
+func (c *customAppTabs) restoreTab(sessionTab sessionTab) (*playgroundTab, error) {
+	tab := c.newTab()
+	errs := []error{tab.snippet.Set(sessionTab.Snippet)}
+	tab.console.setText(sessionTab.Output)
+
+	// Compare against what is on disk, so edits that were never saved
+	// are still flagged as such
+	if len(sessionTab.Snippet) > 0 {
+		saved, err := readSnippet(sessionTab.Snippet)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		tab.saved = string(saved)
+	}
+
+	tab.editor.SetText(sessionTab.Code)
+	tab.editor.clearHistory()
+	tab.editor.file, tab.editor.readOnly = sessionTab.File, len(sessionTab.File) > 0
+	if tab.editor.readOnly {
+		tab.saved = sessionTab.Code
+	}
+	if sessionTab.RunConfig != nil {
+		tab.editor.config = *sessionTab.RunConfig
+	}
+	tab.editor.setCursor(textPos{row: sessionTab.CursorRow, col: sessionTab.CursorColumn})
+	tab.setTitle(sessionTab.Title)
+
+	return tab, errors.Join(errs...)
+}
+
+// Replaces the current tabs with the ones from the session
+func (c *customAppTabs) restore(s session) error {
+	if len(s.Tabs) == 0 {
+		return nil
+	}
+
+	for _, item := range c.Items {
+		delete(c.tabs, item)
+	}
+	c.SetItems(nil)
+
+	var errs []error
+	for _, sessionTab := range s.Tabs {
+		tab, err := c.restoreTab(sessionTab)
+		errs = append(errs, err)
+		c.Append(tab.TabItem)
+	}
+
+	if s.Selected >= 0 && s.Selected < len(c.Items) {
+		c.SelectIndex(s.Selected)
+	}
+	c.publishSession()
+
+	return errors.Join(errs...)
+}
+
+// Marks the session as running and periodically autosaves it, calling
+// the returned function saves it for the next launch
+// Another instance keeps its lock, so it isn't taken for a crash when this
+// one exits
+func (c *customAppTabs) startSession() (stop func() error, err error) {
+	owner := !lockedByOther()
+	if owner {
+		err = os.WriteFile(sessionPath(SESSION_LOCK), []byte(strconv.Itoa(os.Getpid())), 0644)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ticker := time.NewTicker(AUTOSAVE_INTERVAL)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				err := writeSession(AUTOSAVE_FILE, c.publishedSnapshot())
+				if err != nil {
+					logger.Error("writeSession()", zap.Error(err))
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() error {
+		ticker.Stop()
+		close(done)
+
+		err := writeSession(SESSION_FILE, c.snapshot())
+		if err != nil {
+			return err
+		}
+
+		if !owner {
+			return nil
+		}
+		return errors.Join(removeIfExists(sessionPath(AUTOSAVE_FILE)), removeIfExists(sessionPath(SESSION_LOCK)))
+	}, nil
+}
+
+func removeIfExists(file string) error {
+	err := os.Remove(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
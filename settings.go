@@ -0,0 +1,95 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type settings struct {
+	Autosave		string	`json:"autosave"`
+	AutosaveDelay	int		`json:"autosave_delay"`
+	FormatOnRun		bool	`json:"format_on_run"`
+	FormatOnSave	bool	`json:"format_on_save"`
+	ImportsOnRun	bool	`json:"imports_on_run"`
+	LanguageServer	bool	`json:"language_server"`
+	Keybindings		string	`json:"keybindings"`
+	ConsoleColors	bool	`json:"console_colors"`
+	ConsoleEmbeds	bool	`json:"console_embeds"`
+	// Lines and megabytes of output kept, the oldest lines are dropped
+	ConsoleLines	int		`json:"console_lines"`
+	ConsoleSize		int		`json:"console_size"`
+}
+
+var (
+	settingsMu		sync.RWMutex
+	currentSettings	= defaultSettings()
+)
+
+func defaultSettings() settings {
+	return settings{
+		Autosave: AUTOSAVE_OFF,
+		AutosaveDelay: 2,
+		LanguageServer: true,
+		Keybindings: KEYBINDINGS_DEFAULT,
+		ConsoleColors: true,
+		ConsoleLines: 100000,
+		ConsoleSize: 32,
+	}
+}
+
+func settingsPath() string {
+	return filepath.Join(os.Getenv("RUNGO_CONFIG_DIR"), SETTINGS_FILE)
+}
+
+// Missing fields keep their default values, so settings files written by
+// previous releases remain valid
+func loadSettings() error {
+	s := defaultSettings()
+	data, err := os.ReadFile(settingsPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		return err
+	}
+
+	settingsMu.Lock()
+	currentSettings = s
+	settingsMu.Unlock()
+
+	return nil
+}
+
+func getSettings() settings {
+	settingsMu.RLock()
+	defer settingsMu.RUnlock()
+	return currentSettings
+}
+
+func setSettings(s settings) error {
+	settingsMu.Lock()
+	currentSettings = s
+	settingsMu.Unlock()
+
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(settingsPath(), data, 0644)
+}
+
+func (s settings) autosaveDelay() time.Duration {
+	return time.Duration(s.AutosaveDelay) * time.Second
+}
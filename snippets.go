@@ -0,0 +1,28 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func snippetDir(snippet string) string {
+	return filepath.Join(os.Getenv("RUNGO_DATA_DIR"), SNIPPETS_DIR, snippet)
+}
+
+// Overwrites the code of an existing snippet
+func saveSnippet(snippet string, data []byte) error {
+	_, err := os.Stat(snippetDir(snippet))
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(snippetDir(snippet), "main.go"), data, 0644)
+}
+
+func readSnippet(snippet string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(snippetDir(snippet), "main.go"))
+}
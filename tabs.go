@@ -5,74 +5,609 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/data/binding"
-	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
 )
 
+type playgroundTab struct {
+	title			string
+	saved			string
+	autosaveTimer	*time.Timer
+	saveModal		*customSaveModal
+	openModal		*customOpenModal
+	parent			*container.DocTabs
+	snippet			binding.String
+	editor			*editor
+	findBar			*findBar
+	outline			*outline
+	problems		*problemsPanel
+	console			*console
+	consoleBar		*consoleBar
+	runs			runHistory
+	// The state the autosave writes, see publish
+	sessionMu		sync.Mutex
+	published		sessionTab
+	*container.TabItem
+}
+
 type customAppTabs struct {
-	window fyne.Window
-	*container.AppTabs
+	window			fyne.Window
+	dispatcher		*customDispatcher
+	tabs			map[*container.TabItem]*playgroundTab
+	closed			[]sessionTab
+	renameModal		*customRenameModal
+	goToLineModal	*customGoToLineModal
+	runsModal		*customRunsModal
+	runConfigModal	*customRunConfigModal
+	// The tabs the autosave writes, see publishSession
+	sessionMu		sync.Mutex
+	publishedTabs	[]*playgroundTab
+	publishedIndex	int
+	*container.DocTabs
+}
+
+func newAppTabs(window fyne.Window, dispatcher *customDispatcher) *customAppTabs {
+	appTabs := &customAppTabs{window: window, dispatcher: dispatcher, tabs: make(map[*container.TabItem]*playgroundTab)}
+	appTabs.renameModal = newRenameModal(window)
+	appTabs.goToLineModal = newGoToLineModal(window)
+	appTabs.runsModal = newRunsModal(window)
+	appTabs.runConfigModal = newRunConfigModal(window)
+	appTabs.DocTabs = container.NewDocTabs()
+	appTabs.CreateTab = func() *container.TabItem {
+		return appTabs.newTab().TabItem
+	}
+	appTabs.OnSelected = func(*container.TabItem) {
+		appTabs.publishSession()
+	}
+	appTabs.CloseIntercept = func(item *container.TabItem) {
+		appTabs.closeTab(appTabs.tabs[item])
+	}
+	appTabs.Append(appTabs.newTab().TabItem)
+	appTabs.publishSession()
+
+	return appTabs
 }
 
-func newAppTabs(window fyne.Window) *customAppTabs {
-	appTabs := &customAppTabs{window: window}
+// Commands acting on the tabs, or on the code of the selected one
+func (c *customAppTabs) commands() []*command {
+	commands := []*command{
+		{id: "run", info: "Run code", keys: []string{"Alt+Return"}, run: func() {
+			c.selectedTab().editor.run()
+		}},
+		{id: "stop", info: "Stop running code", keys: []string{"Alt+Period"}, run: func() {
+			c.selectedTab().editor.stop()
+		}},
+		{id: "test", info: "Run the snippet's tests", keys: []string{"Alt+Shift+Return"}, run: func() {
+			c.selectedTab().editor.test()
+		}},
+		{id: "run-config", info: "Edit the arguments, environment and build flags of runs", keys: []string{"Alt+Shift+C"}, run: func() {
+			c.runConfigModal.show(c.selectedTab())
+		}},
+		{id: "save", info: "Save snippet", keys: []string{"Alt+S"}, run: func() {
+			c.selectedTab().saveModal.save()
+		}},
+		{id: "save-as", info: "Open save snippet as modal", keys: []string{"Alt+Shift+S"}, run: func() {
+			c.selectedTab().saveModal.show()
+		}},
+		{id: "format", info: "Format code", keys: []string{"Alt+Shift+F"}, run: func() {
+			c.selectedTab().editor.format()
+		}},
+		{id: "organize-imports", info: "Organize imports", keys: []string{"Alt+Shift+O"}, run: func() {
+			c.selectedTab().editor.organizeImports()
+		}},
+		{id: "vet", info: "Vet code", keys: []string{"Alt+Shift+V"}, run: func() {
+			c.selectedTab().editor.vet()
+		}},
+		{id: "toggle-comment", info: "Toggle comment", keys: []string{"Ctrl+Slash"}, run: func() {
+			c.selectedTab().editor.toggleComment()
+		}},
+		{id: "indent", info: "Indent selected lines", keys: []string{"Ctrl+RightBracket"}, run: func() {
+			c.selectedTab().editor.indentRows(false)
+		}},
+		{id: "outdent", info: "Outdent selected lines", keys: []string{"Ctrl+LeftBracket"}, run: func() {
+			c.selectedTab().editor.indentRows(true)
+		}},
+		{id: "undo", info: "Undo", keys: []string{"Ctrl+Z"}, run: func() {
+			c.selectedTab().editor.undo()
+		}},
+		{id: "redo", info: "Redo", keys: []string{"Ctrl+Shift+Z", "Ctrl+Y"}, run: func() {
+			c.selectedTab().editor.redo()
+		}},
+		{id: "find", info: "Find", keys: []string{"Ctrl+F"}, run: func() {
+			tab := c.selectedTab()
+			if tab.console.text.focused {
+				tab.consoleBar.showSearch()
+			} else {
+				tab.findBar.show(false)
+			}
+		}},
+		{id: "replace", info: "Find and replace", keys: []string{"Ctrl+H"}, run: func() {
+			c.selectedTab().findBar.show(true)
+		}},
+		{id: "find-next", info: "Go to next match", run: func() {
+			c.selectedTab().editor.findNext(false)
+		}},
+		{id: "find-previous", info: "Go to previous match", run: func() {
+			c.selectedTab().editor.findNext(true)
+		}},
+		{id: "console.find", info: "Find in the output", run: func() {
+			c.selectedTab().consoleBar.showSearch()
+		}},
+		{id: "console.filter", info: "Filter the lines of the output", keys: []string{"Ctrl+Shift+L"}, run: func() {
+			c.selectedTab().consoleBar.showFilter()
+		}},
+		{id: "console.logs", info: "Show the output as a table of JSON logs", keys: []string{"Ctrl+Shift+J"}, run: func() {
+			c.selectedTab().consoleBar.toggleLogs()
+		}},
+		{id: "console.copy", info: "Copy the output", run: func() {
+			c.selectedTab().consoleBar.copyAll()
+		}},
+		{id: "console.save", info: "Save the output to a file", run: func() {
+			c.selectedTab().consoleBar.save()
+		}},
+		{id: "console.clear", info: "Clear the output", keys: []string{"Alt+L"}, run: func() {
+			c.selectedTab().console.clear()
+		}},
+		{id: "runs", info: "Show the runs of the tab", keys: []string{"Ctrl+Shift+H"}, run: func() {
+			c.runsModal.show(c.selectedTab())
+		}},
+		{id: "outline", info: "Show or hide the outline", keys: []string{"Ctrl+Shift+O"}, run: func() {
+			c.selectedTab().outline.toggle()
+		}},
+		{id: "problems", info: "Show or hide the problems", keys: []string{"Ctrl+Shift+M"}, run: func() {
+			c.selectedTab().problems.toggle()
+		}},
+		{id: "fold", info: "Fold the block at the cursor", keys: []string{"Ctrl+Shift+LeftBracket"}, run: func() {
+			c.selectedTab().editor.fold()
+		}},
+		{id: "unfold", info: "Unfold the block at the cursor", keys: []string{"Ctrl+Shift+RightBracket"}, run: func() {
+			c.selectedTab().editor.unfold()
+		}},
+		{id: "fold-all", info: "Fold all blocks", run: func() {
+			c.selectedTab().editor.foldAll(true)
+		}},
+		{id: "unfold-all", info: "Unfold all blocks", run: func() {
+			c.selectedTab().editor.foldAll(false)
+		}},
+		{id: "complete", info: "Show completions", keys: []string{"Ctrl+Space"}, run: func() {
+			c.selectedTab().editor.complete()
+		}},
+		{id: "signature-help", info: "Show signature of the function being called", keys: []string{"Ctrl+Shift+Space"}, run: func() {
+			c.selectedTab().editor.signatureHelp()
+		}},
+		{id: "hover", info: "Show documentation", keys: []string{"Ctrl+I"}, run: func() {
+			editor := c.selectedTab().editor
+			editor.hover(editor.cursor, editor.canvasPosAt(editor.cursor))
+		}},
+		{id: "goto-definition", info: "Go to definition", keys: []string{"Ctrl+B"}, run: func() {
+			editor := c.selectedTab().editor
+			editor.gotoDefinition(editor.cursor)
+		}},
+		{id: "goto-line", info: "Go to line", keys: []string{"Ctrl+G"}, run: func() {
+			c.goToLineModal.show(c.selectedTab())
+		}},
+		{id: "open", info: "Open load snippet modal", keys: []string{"Alt+O"}, run: func() {
+			c.selectedTab().openModal.show()
+		}},
+		{id: "tab.new", info: "Open a new tab", keys: []string{"Alt+T"}, run: func() {
+			c.Append(c.newTab().TabItem)
+			c.SelectIndex(len(c.Items) - 1)
+			c.publishSession()
+		}},
+		{id: "tab.close", info: "Close tab", keys: []string{"Alt+W"}, run: func() {
+			c.closeTab(c.selectedTab())
+		}},
+		{id: "tab.reopen", info: "Reopen closed tab", keys: []string{"Alt+Shift+T"}, run: c.reopenTab},
+		{id: "tab.rename", info: "Rename tab", keys: []string{"Alt+R"}, run: func() {
+			c.renameModal.show(c.selectedTab())
+		}},
+		{id: "tab.duplicate", info: "Duplicate tab", keys: []string{"Alt+D"}, run: func() {
+			c.duplicateTab(c.selectedTab())
+		}},
+		{id: "tab.move-left", info: "Move tab to the left", keys: []string{"Alt+Shift+Left"}, run: func() {
+			c.moveTab(c.selectedTab(), -1)
+		}},
+		{id: "tab.move-right", info: "Move tab to the right", keys: []string{"Alt+Shift+Right"}, run: func() {
+			c.moveTab(c.selectedTab(), 1)
+		}},
+		{id: "tab.next", info: "Go to next tab", keys: []string{"Ctrl+Tab"}, run: func() {
+			c.SelectIndex((c.SelectedIndex() + 1) % len(c.Items))
+		}},
+		{id: "tab.previous", info: "Go to previous tab", keys: []string{"Ctrl+Shift+Tab"}, run: func() {
+			c.SelectIndex((c.SelectedIndex() - 1 + len(c.Items)) % len(c.Items))
+		}},
+	}
 
-	output := binding.NewString()
+	for i := 1; i <= 8; i++ {
+		index := i - 1
+		commands = append(commands, &command{
+			id: fmt.Sprintf("tab.go-to-%d", i),
+			info: fmt.Sprintf("Go to tab %d", i),
+			keys: []string{fmt.Sprintf("Alt+%d", i)},
+			run: func() {
+				if index < len(c.Items) {
+					c.SelectIndex(index)
+				}
+			},
+		})
+	}
+
+	return append(commands, &command{id: "tab.go-to-last", info: "Go to last tab", keys: []string{"Alt+9"}, run: func() {
+		c.SelectIndex(len(c.Items) - 1)
+	}})
+}
+
+func (c *customAppTabs) newTab() *playgroundTab {
 	snippet := binding.NewString()
 	snippetList := binding.NewStringList()
 
-	editor := playgroundEditor(output, snippet)
-	console := playgroundConsole(output)
+	banner := newErrorBanner()
+	console := playgroundConsole()
+	editor := playgroundEditor(console, snippet, banner)
+	status := widget.NewLabel(editor.statusText())
+	findBar := newFindBar(editor, c.window, c.dispatcher.TypedShortcut)
+	consoleBar := newConsoleBar(console, c.window, c.dispatcher.TypedShortcut)
+	outline := newOutline(editor)
+	problems := newProblemsPanel(editor)
 
-	appTabs.AppTabs = container.NewAppTabs(
-		container.NewTabItem("New snippet", container.NewGridWithColumns(2,
-			editor,
-			console,
+	tab := &playgroundTab{
+		title: "New snippet",
+		parent: c.DocTabs,
+		snippet: snippet,
+		editor: editor,
+		findBar: findBar,
+		outline: outline,
+		problems: problems,
+		console: console,
+		consoleBar: consoleBar,
+		TabItem: container.NewTabItem("New snippet", container.NewGridWithColumns(2,
+			container.NewBorder(findBar, container.NewVBox(problems, status), outline, nil, editor),
+			container.NewBorder(container.NewVBox(banner, consoleBar), nil, nil, nil, container.NewStack(console, consoleBar.logs)),
 		)),
-	)
+	}
+	c.tabs[tab.TabItem] = tab
 
-	saveModal := newSaveModal(&editor.Entry, appTabs.AppTabs, snippet, window)
-	openModal := newOpenModal(&editor.Entry, appTabs.AppTabs, snippet, snippetList, window)
-	
-	window.Canvas().AddShortcut(altReturn, editor.Entry.TypedShortcut)
-	window.Canvas().AddShortcut(altS, saveModal.TypedShortcut)
-	window.Canvas().AddShortcut(altO, openModal.TypedShortcut)
+	editor.OnChanged = tab.edited
+	editor.onSaved = tab.markSaved
+	editor.onRun = func(r runRecord) {
+		tab.runs.add(r)
+		if c.runsModal.Visible() && c.runsModal.tab == tab {
+			c.runsModal.refresh()
+		}
+	}
+	editor.onCursorChanged = func() {
+		status.SetText(editor.statusText())
+		findBar.updateCount()
+		tab.publish()
+	}
+	editor.onShortcut = c.dispatcher.TypedShortcut
+	console.onShortcut = c.dispatcher.TypedShortcut
+	editor.isBound = c.dispatcher.bound
+	editor.onCommand = func(id string) {
+		if cmd := c.dispatcher.command(id); cmd != nil {
+			cmd.run()
+		}
+	}
+	editor.clipboard = c.window.Clipboard()
+	editor.onFocusLost = func() {
+		if getSettings().Autosave == AUTOSAVE_FOCUS {
+			tab.autosave()
+		}
+	}
 
-	return appTabs
+	editor.onDefinition = c.openSource
+	editor.onOutline = outline.setItems
+	editor.onProblems = func() {
+		problems.refresh()
+		tab.refreshTitle()
+	}
+
+	tab.saveModal = newSaveModal(tab, c.window)
+	tab.openModal = newOpenModal(tab, snippetList, c.window)
+	tab.publish()
+
+	return tab
 }
 
-func (c *customAppTabs) TypedShortcut(shortcut fyne.Shortcut) {
-	customShortcut, ok := shortcut.(*desktop.CustomShortcut)
-	if !ok {
-		c.TypedShortcut(shortcut)
+// Shows a Go source file, such as one of the standard library, in a
+// read-only tab with the cursor at the given position
+func (c *customAppTabs) openSource(path string, pos lspPosition) {
+	for _, tab := range c.playgroundTabs() {
+		if tab.editor.file == path {
+			c.Select(tab.TabItem)
+			tab.editor.setCursor(fromLSPPosition(tab.editor.buf.lines, pos))
+			return
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		showError(c.window, "Opening source", err)
 		return
 	}
 
-	switch customShortcut.ShortcutName() {
-	case ALT_T:
-		c.Append(newTab(c.AppTabs, c.window))
+	tab := c.newTab()
+	tab.editor.SetText(string(data))
+	tab.editor.clearHistory()
+	tab.editor.file, tab.editor.readOnly = path, true
+	tab.markSaved(string(data))
+	tab.editor.setCursor(fromLSPPosition(tab.editor.buf.lines, pos))
+	tab.setTitle(sourceTitle(path))
+
+	c.insertTab(tab, c.SelectedIndex()+1)
+	c.Select(tab.TabItem)
+}
+
+// Standard library sources are named after their import path, e.g.
+// fmt/print.go, the rest after the file itself
+func sourceTitle(path string) string {
+	goroot, err := goRoot()
+	if err == nil {
+		rel, err := filepath.Rel(filepath.Join(goroot, "src"), path)
+		if err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+
+	return filepath.Base(path)
+}
+
+// Tabs in the order they are displayed
+func (c *customAppTabs) playgroundTabs() []*playgroundTab {
+	tabs := make([]*playgroundTab, 0, len(c.Items))
+	for _, item := range c.Items {
+		tabs = append(tabs, c.tabs[item])
 	}
+
+	return tabs
 }
 
-func newTab(appTabs *container.AppTabs, window fyne.Window) *container.TabItem {
-	output := binding.NewString()
-	snippet := binding.NewString()
-	snippetList := binding.NewStringList()
+func (c *customAppTabs) selectedTab() *playgroundTab {
+	return c.tabs[c.Selected()]
+}
+
+// Asks before closing tabs whose code would be lost, tabs that were never
+// saved as a snippet are saved by naming one
+func (c *customAppTabs) closeTab(tab *playgroundTab) {
+	switch {
+	case tab.unsaved():
+		newUnsavedDialog(
+			fmt.Sprintf("%s has unsaved changes, do you want to save them before closing it?", tab.title),
+			func() {
+				if !tab.hasSnippet() {
+					c.Select(tab.TabItem)
+					tab.saveModal.show()
+					return
+				}
+
+				err := tab.save()
+				if err != nil {
+					showError(c.window, fmt.Sprintf("Saving %s", tab.title), err)
+					return
+				}
+
+				c.removeTab(tab)
+			},
+			func() {
+				c.removeTab(tab)
+			},
+			c.window,
+		).Show()
+	default:
+		c.removeTab(tab)
+	}
+}
+
+// There is always at least one tab open
+func (c *customAppTabs) removeTab(tab *playgroundTab) {
+	if tab.autosaveTimer != nil {
+		tab.autosaveTimer.Stop()
+	}
+	tab.editor.closeLSP()
+
+	c.closed = append(c.closed, tab.snapshot())
+	if len(c.closed) > CLOSED_TABS_LIMIT {
+		c.closed = c.closed[1:]
+	}
+
+	delete(c.tabs, tab.TabItem)
+	c.Remove(tab.TabItem)
+	if len(c.Items) == 0 {
+		c.Append(c.newTab().TabItem)
+	}
+	c.publishSession()
+}
+
+func (c *customAppTabs) reopenTab() {
+	if len(c.closed) == 0 {
+		return
+	}
+
+	sessionTab := c.closed[len(c.closed)-1]
+	c.closed = c.closed[:len(c.closed)-1]
+
+	tab, err := c.restoreTab(sessionTab)
+	if err != nil {
+		showError(c.window, "Reopening tab", err)
+	}
+
+	c.Append(tab.TabItem)
+	c.Select(tab.TabItem)
+	c.publishSession()
+}
+
+// The copy is not associated with the snippet, otherwise both tabs would
+// overwrite each other's code
+func (c *customAppTabs) duplicateTab(tab *playgroundTab) {
+	sessionTab := tab.snapshot()
+	sessionTab.Title = fmt.Sprintf("%s (copy)", tab.title)
+	sessionTab.Snippet = ""
+
+	duplicate, err := c.restoreTab(sessionTab)
+	if err != nil {
+		showError(c.window, "Duplicating tab", err)
+	}
+
+	c.insertTab(duplicate, c.SelectedIndex()+1)
+	c.Select(duplicate.TabItem)
+	c.publishSession()
+}
+
+func (c *customAppTabs) insertTab(tab *playgroundTab, index int) {
+	items := make([]*container.TabItem, 0, len(c.Items)+1)
+	items = append(items, c.Items[:index]...)
+	items = append(items, tab.TabItem)
+	items = append(items, c.Items[index:]...)
+	c.SetItems(items)
+	c.publishSession()
+}
+
+// Moves the tab by the given offset, moving past an edge puts it at the
+// other one while the rest keep their order. Tabs are only reordered from
+// the keyboard and the palette, DocTabs can't drag its tab buttons
+func (c *customAppTabs) moveTab(tab *playgroundTab, offset int) {
+	from := -1
+	for i, item := range c.Items {
+		if item == tab.TabItem {
+			from = i
+		}
+	}
+
+	to := ((from+offset)%len(c.Items) + len(c.Items)) % len(c.Items)
+	if from < 0 || from == to {
+		return
+	}
+
+	items := make([]*container.TabItem, 0, len(c.Items))
+	items = append(items, c.Items[:from]...)
+	items = append(items, c.Items[from+1:]...)
+	items = append(items[:to], append([]*container.TabItem{tab.TabItem}, items[to:]...)...)
+	c.SetItems(items)
+	c.Select(tab.TabItem)
+	c.publishSession()
+}
+
+// Tabs whose code differs from the one they were last saved or loaded with
+func (c *customAppTabs) unsavedTabs() []*playgroundTab {
+	tabs := make([]*playgroundTab, 0)
+	for _, tab := range c.playgroundTabs() {
+		if tab.unsaved() {
+			tabs = append(tabs, tab)
+		}
+	}
+
+	return tabs
+}
+
+func (t *playgroundTab) setTitle(title string) {
+	t.title = title
+	t.refreshTitle()
+	t.publish()
+}
+
+// The title is followed by how many problems the code has, and whether it
+// has unsaved changes
+func (t *playgroundTab) refreshTitle() {
+	title := t.title
+	if problems := len(t.editor.problems()); problems > 0 {
+		title = fmt.Sprintf("%s %s%d", title, PROBLEMS_MARK, problems)
+	}
+	if t.unsaved() {
+		title = fmt.Sprintf("%s %s", title, UNSAVED_MARK)
+	}
+
+	if t.Text != title {
+		t.Text = title
+		t.parent.Refresh()
+	}
+}
+
+// Tabs that are not snippets compare against the file they show, or an
+// empty tab, since their code was never saved anywhere
+func (t *playgroundTab) unsaved() bool {
+	return t.editor.Text() != t.saved
+}
+
+func (t *playgroundTab) hasSnippet() bool {
+	snippet, _ := t.snippet.Get()
+	return len(snippet) > 0
+}
+
+// Records the given code as the one that is currently on disk
+func (t *playgroundTab) markSaved(code string) {
+	t.saved = code
+	t.refreshTitle()
+}
 
-	editor := playgroundEditor(output, snippet)
-	console := playgroundConsole(output)
+// Every way of saving a snippet in place ends up here, so they all format
+// the code when the settings ask for it
+func (t *playgroundTab) save() error {
+	snippet, err := t.snippet.Get()
+	if err != nil {
+		return err
+	}
 
-	saveModal := newSaveModal(&editor.Entry, appTabs, snippet, window)
-	openModal := newOpenModal(&editor.Entry, appTabs, snippet, snippetList, window)
+	if getSettings().FormatOnSave {
+		t.editor.format()
+	}
 
-	window.Canvas().AddShortcut(altReturn, editor.Entry.TypedShortcut)
-	window.Canvas().AddShortcut(altS, saveModal.TypedShortcut)
-	window.Canvas().AddShortcut(altO, openModal.TypedShortcut)
+	code := t.editor.Text()
+	err = saveSnippet(snippet, []byte(code))
+	if err != nil {
+		return err
+	}
 
-	return container.NewTabItem("New snippet", container.NewGridWithColumns(2,
-		editor,
-		console,
-	))
+	t.markSaved(code)
+	return nil
+}
+
+// Applies to the next runs, and is saved along with the snippet if the tab
+// holds one
+func (t *playgroundTab) setRunConfig(config runConfig) error {
+	t.editor.config = config
+	t.publish()
+	snippet, _ := t.snippet.Get()
+	if len(snippet) == 0 {
+		return nil
+	}
+
+	return writeRunConfig(snippet, config)
+}
+
+func (t *playgroundTab) edited() {
+	t.publish()
+	t.refreshTitle()
+	t.problems.refresh()
+
+	if t.autosaveTimer != nil {
+		t.autosaveTimer.Stop()
+	}
+
+	s := getSettings()
+	if s.Autosave == AUTOSAVE_IDLE && t.hasSnippet() && t.unsaved() {
+		t.autosaveTimer = time.AfterFunc(s.autosaveDelay(), func() {
+			runOnUI(t.autosave)
+		})
+	}
+}
+
+// Only snippets are autosaved, the rest would need a name
+func (t *playgroundTab) autosave() {
+	if !t.hasSnippet() || !t.unsaved() {
+		return
+	}
+
+	err := t.save()
+	if err != nil {
+		t.editor.banner.showError("Autosaving snippet", err)
+	}
 }
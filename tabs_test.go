@@ -0,0 +1,99 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2/test"
+)
+
+// Outside queueUI no goroutine plays the UI, what background work hands to
+// it after its test ended is dropped rather than racing with the next test
+func TestMain(m *testing.M) {
+	setUIQueue(func(fn func()) {})
+	os.Exit(m.Run())
+}
+
+// Queues what background work hands to the UI, the test goroutine plays the
+// part of the event queue by running it in waitUI
+func queueUI(t *testing.T) chan func() {
+	queue := make(chan func(), 1024)
+	previous := setUIQueue(func(fn func()) { queue <- fn })
+	t.Cleanup(func() { setUIQueue(previous) })
+
+	return queue
+}
+
+// Runs what was handed to the UI until done returns true
+func waitUI(t *testing.T, queue chan func(), done func() bool) {
+	timeout := time.After(20 * time.Second)
+	for !done() {
+		select {
+		case fn := <-queue:
+			fn()
+		case <-timeout:
+			t.Fatal("timed out waiting for the UI")
+		}
+	}
+}
+
+func newTestTabs(t *testing.T) *customAppTabs {
+	a := test.NewApp()
+	t.Cleanup(a.Quit)
+	w := a.NewWindow("")
+	tabs := newAppTabs(w, newDispatcher(w))
+	w.SetContent(tabs)
+	tabs.dispatcher.register(tabs.commands()...)
+
+	return tabs
+}
+
+func TestAutosave(t *testing.T) {
+	tests := []struct {
+		name			string
+		formatOnSave	bool
+		typed			string
+		want			string
+	}{
+		{name: "as typed", typed: "package main\nvar  x = 1", want: "package main\nvar  x = 1"},
+		{name: "formatted", formatOnSave: true, typed: "package main\nvar  x = 1", want: "package main\n\nvar x = 1\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("RUNGO_DATA_DIR", t.TempDir())
+			err := os.MkdirAll(snippetDir("snippet"), 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			previous := currentSettings
+			t.Cleanup(func() { currentSettings = previous })
+			currentSettings = defaultSettings()
+			currentSettings.Autosave, currentSettings.AutosaveDelay = AUTOSAVE_IDLE, 1
+			currentSettings.FormatOnSave = test.formatOnSave
+
+			queue := queueUI(t)
+			tab := newTestTabs(t).selectedTab()
+			err = tab.snippet.Set("snippet")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tab.editor.insert(test.typed)
+
+			waitUI(t, queue, func() bool { return !tab.unsaved() })
+			saved, err := readSnippet("snippet")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(saved) != test.want {
+				t.Errorf("got %q saved, want %q", saved, test.want)
+			}
+		})
+	}
+}
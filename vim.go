@@ -0,0 +1,1524 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+)
+
+type vimState int
+
+const (
+	vimNormal vimState = iota
+	vimInsert
+	vimVisual
+	vimVisualLine
+	vimCommandLine
+)
+
+// Whether the keys typed so far make up a command
+type vimStatus int
+
+const (
+	vimDone vimStatus = iota
+	vimMore
+	vimInvalid
+)
+
+// A key typed in vim mode, either a rune or a named key such as Escape
+type vimKey struct {
+	r		rune
+	name	fyne.KeyName
+}
+
+type vimRegister struct {
+	text		string
+	linewise	bool
+}
+
+// Where a motion moves the cursor to, and how operators treat the text
+// between the cursor and there
+type vimMotion struct {
+	pos			textPos
+	linewise	bool
+	inclusive	bool
+}
+
+// Vim's normal, insert and visual modes, with counts, operators, motions,
+// text objects and registers. ":w" saves the snippet and ":!" runs it
+type vimMode struct {
+	editor			*editor
+	state			vimState
+	pending			[]vimKey
+	registers		map[rune]vimRegister
+	visualStart		textPos
+	pos				textPos
+	selAnchor		textPos
+	selCursor		textPos
+	cmdline			string
+	message			string
+	lastFind		[2]rune
+	searchBackward	bool
+	edited			bool
+	recording		[]vimKey
+	lastChange		[]vimKey
+	replaying		bool
+	repeated		bool
+}
+
+func newVimMode(e *editor) *vimMode {
+	return &vimMode{editor: e, registers: make(map[rune]vimRegister)}
+}
+
+func (v *vimMode) status() string {
+	switch v.state {
+	case vimInsert:
+		return "-- INSERT --"
+	case vimVisual:
+		return "-- VISUAL --"
+	case vimVisualLine:
+		return "-- VISUAL LINE --"
+	case vimCommandLine:
+		return v.cmdline
+	}
+
+	if len(v.message) > 0 {
+		return v.message
+	}
+
+	var sb strings.Builder
+	for _, k := range v.pending {
+		sb.WriteRune(k.r)
+	}
+
+	return sb.String()
+}
+
+func (v *vimMode) blockCursor() (textPos, bool) {
+	switch v.state {
+	case vimNormal:
+		return v.editor.cursor, true
+	case vimVisual, vimVisualLine:
+		return v.pos, true
+	}
+
+	return textPos{}, false
+}
+
+func (v *vimMode) typedRune(r rune) bool {
+	switch v.state {
+	case vimInsert:
+		v.record(vimKey{r: r})
+		return false
+	case vimCommandLine:
+		v.cmdline += string(r)
+		v.editor.cursorChanged()
+		return true
+	}
+
+	v.feed(vimKey{r: r})
+	return true
+}
+
+func (v *vimMode) typedKey(key *fyne.KeyEvent) bool {
+	e := v.editor
+	switch v.state {
+	case vimInsert:
+		if key.Name == fyne.KeyEscape {
+			v.record(vimKey{name: key.Name})
+			v.leaveInsert()
+			return true
+		}
+
+		v.record(vimKey{name: key.Name})
+		return false
+	case vimCommandLine:
+		switch key.Name {
+		case fyne.KeyEscape:
+			v.leaveCommandLine()
+		case fyne.KeyReturn, fyne.KeyEnter:
+			cmdline := v.cmdline
+			v.leaveCommandLine()
+			v.executeCommandLine(cmdline)
+		case fyne.KeyBackspace:
+			_, size := lastRune(v.cmdline)
+			v.cmdline = v.cmdline[:len(v.cmdline)-size]
+			if len(v.cmdline) == 0 {
+				v.leaveCommandLine()
+			}
+		}
+
+		e.cursorChanged()
+		return true
+	}
+
+	// Keys that move the cursor work as their vim counterparts
+	aliases := map[fyne.KeyName]rune{
+		fyne.KeyLeft: 'h', fyne.KeyRight: 'l', fyne.KeyUp: 'k', fyne.KeyDown: 'j',
+		fyne.KeyHome: '0', fyne.KeyEnd: '$', fyne.KeyBackspace: 'h',
+		fyne.KeyReturn: '+', fyne.KeyEnter: '+', fyne.KeyDelete: 'x',
+	}
+
+	switch key.Name {
+	case fyne.KeyEscape:
+		v.pending, v.message = nil, ""
+		e.completion.hide()
+		e.hideInfo()
+		if v.state != vimNormal {
+			v.leaveVisual()
+		}
+		e.cursorChanged()
+	case fyne.KeyPageUp:
+		v.scroll(-e.visibleRows())
+	case fyne.KeyPageDown:
+		v.scroll(e.visibleRows())
+	case fyne.KeyTab:
+	default:
+		r, ok := aliases[key.Name]
+		if !ok {
+			return false
+		}
+		v.feed(vimKey{r: r})
+	}
+
+	return true
+}
+
+// Ctrl is only used for redoing and scrolling, the rest of the shortcuts
+// act as they do without vim
+func (v *vimMode) typedShortcut(shortcut fyne.Shortcut) bool {
+	s, ok := shortcut.(*desktop.CustomShortcut)
+	if !ok || s.Modifier != fyne.KeyModifierControl || v.state == vimInsert || v.state == vimCommandLine {
+		return false
+	}
+
+	e := v.editor
+	switch s.KeyName {
+	case fyne.KeyR:
+		e.redo()
+		v.clampCursor()
+	case fyne.KeyD:
+		v.scroll(e.visibleRows() / 2)
+	case fyne.KeyU:
+		v.scroll(-e.visibleRows() / 2)
+	case fyne.KeyF:
+		v.scroll(e.visibleRows())
+	case fyne.KeyB:
+		v.scroll(-e.visibleRows())
+	default:
+		return false
+	}
+
+	return true
+}
+
+// Keys typed in insert mode are kept along with the command that entered
+// it, so "." can repeat both
+func (v *vimMode) record(k vimKey) {
+	if !v.replaying && v.recording != nil {
+		v.recording = append(v.recording, k)
+	}
+}
+
+// Adds a key to the command being typed and runs it once it's complete,
+// the edits it makes are undone at once
+func (v *vimMode) feed(k vimKey) {
+	e := v.editor
+	v.message = ""
+	v.syncSelection()
+
+	v.pending = append(v.pending, k)
+	keys := v.pending
+
+	e.holdEditGroup()
+	v.edited, v.repeated = false, false
+	status := v.execute(keys)
+	if status == vimMore {
+		e.cursorChanged()
+		return
+	}
+	v.pending = nil
+
+	switch {
+	case v.replaying || v.repeated:
+	case v.state == vimInsert:
+		v.recording = append([]vimKey{}, keys...)
+	case v.edited:
+		v.lastChange = append([]vimKey{}, keys...)
+	}
+
+	if v.state != vimInsert {
+		e.releaseEditGroup()
+		v.clampCursor()
+	}
+	if v.edited {
+		e.changed()
+	}
+	if v.state == vimVisual || v.state == vimVisualLine {
+		v.selectVisual()
+	}
+
+	e.scrollToCursor()
+	e.Refresh()
+	e.cursorChanged()
+}
+
+// Selections made with the mouse are taken over by visual mode, and clicks
+// while in visual mode leave it
+func (v *vimMode) syncSelection() {
+	e := v.editor
+	switch v.state {
+	case vimNormal:
+		if e.hasSelection() {
+			v.state, v.visualStart, v.pos = vimVisual, e.anchor, e.cursor
+			if e.anchor.before(e.cursor) && e.cursor.col > 0 {
+				v.pos.col--
+			}
+		}
+	case vimVisual, vimVisualLine:
+		if e.anchor != v.selAnchor || e.cursor != v.selCursor {
+			v.state = vimNormal
+			e.anchor = e.cursor
+		}
+	}
+}
+
+// Runs the command typed so far, [count]["x][count]command
+func (v *vimMode) execute(keys []vimKey) vimStatus {
+	e := v.editor
+	i := 0
+	register := '"'
+	if keys[i].r == '"' {
+		if len(keys) < 2 {
+			return vimMore
+		}
+		register, i = keys[1].r, 2
+	}
+
+	count, i := vimCount(keys, i)
+	if i >= len(keys) {
+		return vimMore
+	}
+
+	n := max(count, 1)
+	visual := v.state == vimVisual || v.state == vimVisualLine
+	k := keys[i].r
+	rest := keys[i+1:]
+
+	if strings.ContainsRune("dcy<>", k) {
+		if visual {
+			v.operateVisual(k, register)
+			return vimDone
+		}
+		return v.operator(k, register, count, rest)
+	}
+
+	if visual {
+		switch k {
+		case 'x', 's', '~', 'u', 'U', 'J', 'p', 'P':
+			v.operateVisual(k, register)
+			return vimDone
+		case 'D', 'X', 'Y', 'C', 'S', 'R':
+			v.state = vimVisualLine
+			v.operateVisual(map[rune]rune{'D': 'd', 'X': 'd', 'Y': 'y', 'C': 'c', 'S': 'c', 'R': 'c'}[k], register)
+			return vimDone
+		case 'o':
+			v.visualStart, v.pos = v.pos, v.visualStart
+			return vimDone
+		case 'v', 'V':
+			state := map[rune]vimState{'v': vimVisual, 'V': vimVisualLine}[k]
+			if v.state == state {
+				v.leaveVisual()
+			} else {
+				v.state = state
+			}
+			return vimDone
+		case ':':
+			v.enterCommandLine(":'<,'>")
+			return vimDone
+		}
+	}
+
+	switch k {
+	case 'i', 'a', 'I', 'A', 'o', 'O':
+		v.insertCommand(k)
+	case 'x', 'X', 'D', 'C', 's', 'S', 'Y':
+		aliases := map[rune]string{'x': "dl", 'X': "dh", 'D': "d$", 'C': "c$", 's': "cl", 'S': "cc", 'Y': "yy"}
+		alias := aliases[k]
+		return v.operator(rune(alias[0]), register, count, []vimKey{{r: rune(alias[1])}})
+	case 'p', 'P':
+		v.put(register, n, k == 'P')
+	case 'r':
+		if len(rest) == 0 {
+			return vimMore
+		}
+		line := e.buf.line(e.cursor.row)
+		if e.cursor.col+n > len(line) || rest[0].r == 0 {
+			return vimInvalid
+		}
+		v.replace(e.cursor, textPos{row: e.cursor.row, col: e.cursor.col + n}, strings.Repeat(string(rest[0].r), n))
+		e.cursor.col += n - 1
+	case '~':
+		line := e.buf.line(e.cursor.row)
+		end := textPos{row: e.cursor.row, col: min(e.cursor.col+n, len(line))}
+		v.replace(e.cursor, end, toggleCase(e.buf.slice(e.cursor, end)))
+		e.cursor = end
+	case 'J':
+		v.join(e.cursor.row, e.cursor.row+max(n-1, 1))
+	case 'u':
+		for j := 0; j < n; j++ {
+			e.undo()
+		}
+	case '.':
+		v.repeat()
+	case 'v':
+		v.state, v.visualStart, v.pos = vimVisual, e.cursor, e.cursor
+	case 'V':
+		v.state, v.visualStart, v.pos = vimVisualLine, e.cursor, e.cursor
+	case ':', '/', '?':
+		v.enterCommandLine(string(k))
+	case '*', '#':
+		word := v.wordAt(e.cursor)
+		if len(word) == 0 {
+			return vimInvalid
+		}
+		v.search(`\b`+regexp.QuoteMeta(word)+`\b`, k == '#')
+	case 'z':
+		if len(rest) == 0 {
+			return vimMore
+		}
+		return v.zCommand(rest[0].r)
+	default:
+		m, status := v.motion(keys[i:], count)
+		if status != vimDone {
+			return status
+		}
+
+		// Moving vertically keeps the column the cursor was on, "$" keeps
+		// it at the end of the lines
+		goalCol := e.goalCol
+		if visual {
+			v.pos = e.buf.clamp(m.pos)
+			e.goalCol = visualCol(e.buf.line(v.pos.row), v.pos.col)
+		} else {
+			v.moveTo(m.pos)
+		}
+		switch k {
+		case 'j', 'k':
+			e.goalCol = goalCol
+		case '$':
+			e.goalCol = math.MaxInt32
+		}
+	}
+
+	return vimDone
+}
+
+// Digits typed before a command, a leading zero is the "0" motion instead
+func vimCount(keys []vimKey, i int) (int, int) {
+	count := 0
+	for i < len(keys) && unicode.IsDigit(keys[i].r) && (count > 0 || keys[i].r != '0') {
+		count = count*10 + int(keys[i].r-'0')
+		i++
+	}
+
+	return count, i
+}
+
+// Applies an operator to the text a motion or text object moves over, or to
+// whole lines when it's typed twice such as "dd"
+func (v *vimMode) operator(op rune, register rune, count int, keys []vimKey) vimStatus {
+	e := v.editor
+	motionCount, i := vimCount(keys, 0)
+	if i >= len(keys) {
+		return vimMore
+	}
+	if count > 0 || motionCount > 0 {
+		count = max(count, 1) * max(motionCount, 1)
+	}
+	n := max(count, 1)
+
+	switch k := keys[i].r; {
+	case k == op:
+		v.operateRows(op, register, e.cursor.row, e.cursor.row+n-1)
+		return vimDone
+	case k == 'i' || k == 'a':
+		if i+1 >= len(keys) {
+			return vimMore
+		}
+		start, end, ok := v.textObject(k == 'i', keys[i+1].r)
+		if !ok {
+			return vimInvalid
+		}
+		v.operateChars(op, register, start, end)
+		return vimDone
+	}
+
+	// "cw" changes up to the end of the word, leaving the space after it
+	motionKeys := keys[i:]
+	if r, ok := e.runeAt(e.cursor); op == 'c' && ok && !unicode.IsSpace(r) && (keys[i].r == 'w' || keys[i].r == 'W') {
+		motionKeys = []vimKey{{r: keys[i].r - 'w' + 'e'}}
+	}
+
+	m, status := v.motion(motionKeys, count)
+	if status != vimDone {
+		return status
+	}
+
+	start, end := orderPos(e.cursor, e.buf.clamp(m.pos))
+	switch {
+	case m.linewise:
+		v.operateRows(op, register, start.row, end.row)
+		return vimDone
+	case m.inclusive:
+		end.col = min(end.col+1, len(e.buf.line(end.row)))
+	case end.col == 0 && end.row > start.row:
+		// Exclusive motions ending at the start of a line stop at the end of
+		// the previous one, so "dw" on the last word doesn't join lines
+		end = textPos{row: end.row - 1, col: len(e.buf.line(end.row - 1))}
+	}
+
+	v.operateChars(op, register, start, end)
+	return vimDone
+}
+
+func (v *vimMode) operateChars(op rune, register rune, start, end textPos) {
+	e := v.editor
+	text := e.buf.slice(start, end)
+	switch op {
+	case 'y':
+		v.setRegister(register, text, false, true)
+		e.cursor = start
+	case 'd':
+		v.setRegister(register, text, false, false)
+		v.replace(start, end, "")
+		e.cursor = start
+	case 'c':
+		v.setRegister(register, text, false, false)
+		v.replace(start, end, "")
+		e.cursor = start
+		v.enterInsert()
+	case '<', '>':
+		v.operateRows(op, register, start.row, end.row)
+	case '~':
+		v.replace(start, end, toggleCase(text))
+		e.cursor = start
+	case 'u':
+		v.replace(start, end, strings.ToLower(text))
+		e.cursor = start
+	case 'U':
+		v.replace(start, end, strings.ToUpper(text))
+		e.cursor = start
+	}
+}
+
+func (v *vimMode) operateRows(op rune, register rune, first, last int) {
+	e := v.editor
+	last = min(last, e.buf.lineCount()-1)
+	lines := make([]string, 0, last-first+1)
+	for row := first; row <= last; row++ {
+		lines = append(lines, string(e.buf.line(row)))
+	}
+	text := strings.Join(lines, "\n") + "\n"
+
+	switch op {
+	case 'y':
+		v.setRegister(register, text, true, true)
+		if e.cursor.row != first {
+			e.cursor = textPos{row: first, col: e.cursor.col}
+		}
+	case 'd':
+		v.setRegister(register, text, true, false)
+		switch {
+		case last < e.buf.lineCount()-1:
+			v.replace(textPos{row: first}, textPos{row: last + 1}, "")
+		case first > 0:
+			v.replace(textPos{row: first - 1, col: len(e.buf.line(first - 1))}, textPos{row: last, col: len(e.buf.line(last))}, "")
+		default:
+			v.replace(textPos{}, textPos{row: last, col: len(e.buf.line(last))}, "")
+		}
+		row := min(first, e.buf.lineCount()-1)
+		e.cursor = textPos{row: row, col: firstNonBlank(e.buf.line(row))}
+	case 'c':
+		v.setRegister(register, text, true, false)
+		indent := leadingIndent(e.buf.line(first))
+		v.replace(textPos{row: first}, textPos{row: last, col: len(e.buf.line(last))}, indent)
+		e.cursor = textPos{row: first, col: len([]rune(indent))}
+		v.enterInsert()
+	case '<', '>':
+		e.anchor = e.cursor
+		e.indentRange(first, last, op == '<')
+		v.edited = true
+		e.cursor = textPos{row: first, col: firstNonBlank(e.buf.line(first))}
+	default:
+		v.operateChars(op, register, textPos{row: first}, textPos{row: last, col: len(e.buf.line(last))})
+	}
+}
+
+// Operators typed in visual mode act on the selection, which includes the
+// character under the cursor
+func (v *vimMode) operateVisual(op rune, register rune) {
+	e := v.editor
+	start, end := orderPos(v.visualStart, v.pos)
+	linewise := v.state == vimVisualLine
+	v.leaveVisual()
+
+	switch op {
+	case 'x':
+		op = 'd'
+	case 's':
+		op = 'c'
+	case 'J':
+		v.join(start.row, max(end.row, start.row+1))
+		return
+	case 'p', 'P':
+		reg, ok := v.getRegister(register)
+		if !ok {
+			return
+		}
+		v.operateVisualRange('d', '_', start, end, linewise)
+		if linewise && !reg.linewise {
+			reg.text += "\n"
+		}
+		v.insertAt(e.cursor, reg.text, linewise || reg.linewise, true)
+		return
+	}
+
+	v.operateVisualRange(op, register, start, end, linewise)
+}
+
+func (v *vimMode) operateVisualRange(op rune, register rune, start, end textPos, linewise bool) {
+	e := v.editor
+	if linewise {
+		v.operateRows(op, register, start.row, end.row)
+		return
+	}
+
+	end = e.buf.clamp(end)
+	if end.col < len(e.buf.line(end.row)) {
+		end.col++
+	} else {
+		end = e.nextPos(end)
+	}
+	v.operateChars(op, register, start, end)
+}
+
+// Where the motion typed as keys goes from the cursor
+func (v *vimMode) motion(keys []vimKey, count int) (vimMotion, vimStatus) {
+	e := v.editor
+	pos := e.cursor
+	if v.state == vimVisual || v.state == vimVisualLine {
+		pos = v.pos
+	}
+	n := max(count, 1)
+	line := e.buf.line(pos.row)
+
+	switch k := keys[0].r; k {
+	case 'h':
+		return vimMotion{pos: textPos{row: pos.row, col: max(pos.col-n, 0)}}, vimDone
+	case 'l', ' ':
+		return vimMotion{pos: textPos{row: pos.row, col: min(pos.col+n, len(line))}}, vimDone
+	case 'j', 'k':
+		if k == 'k' {
+			n = -n
+		}
+		row, _ := e.stepRows(pos.row, n)
+		return vimMotion{pos: textPos{row: row, col: colAtVisual(e.buf.line(row), e.goalCol)}, linewise: true}, vimDone
+	case '+', '-':
+		if k == '-' {
+			n = -n
+		}
+		row, _ := e.stepRows(pos.row, n)
+		return vimMotion{pos: textPos{row: row, col: firstNonBlank(e.buf.line(row))}, linewise: true}, vimDone
+	case '0':
+		return vimMotion{pos: textPos{row: pos.row}}, vimDone
+	case '^':
+		return vimMotion{pos: textPos{row: pos.row, col: firstNonBlank(line)}}, vimDone
+	case '$':
+		row := min(pos.row+n-1, e.buf.lineCount()-1)
+		return vimMotion{pos: textPos{row: row, col: max(len(e.buf.line(row))-1, 0)}, inclusive: true}, vimDone
+	case 'w', 'W':
+		for j := 0; j < n; j++ {
+			pos = v.wordForward(pos, k == 'W')
+		}
+		return vimMotion{pos: pos}, vimDone
+	case 'b', 'B':
+		for j := 0; j < n; j++ {
+			pos = v.wordBackward(pos, k == 'B')
+		}
+		return vimMotion{pos: pos}, vimDone
+	case 'e', 'E':
+		for j := 0; j < n; j++ {
+			pos = v.wordEnd(pos, k == 'E')
+		}
+		return vimMotion{pos: pos, inclusive: true}, vimDone
+	case 'G':
+		row := e.buf.lineCount() - 1
+		if count > 0 {
+			row = min(count, e.buf.lineCount()) - 1
+		}
+		return vimMotion{pos: textPos{row: row, col: firstNonBlank(e.buf.line(row))}, linewise: true}, vimDone
+	case 'g':
+		if len(keys) < 2 {
+			return vimMotion{}, vimMore
+		}
+		switch keys[1].r {
+		case 'g':
+			row := min(n, e.buf.lineCount()) - 1
+			return vimMotion{pos: textPos{row: row, col: firstNonBlank(e.buf.line(row))}, linewise: true}, vimDone
+		case 'e':
+			for j := 0; j < n; j++ {
+				pos = v.wordEndBackward(pos)
+			}
+			return vimMotion{pos: pos, inclusive: true}, vimDone
+		}
+	case '{', '}':
+		step := 1
+		if k == '{' {
+			step = -1
+		}
+		row := pos.row
+		for j := 0; j < n; j++ {
+			row += step
+			for row > 0 && row < e.buf.lineCount()-1 && len(strings.TrimSpace(string(e.buf.line(row)))) > 0 {
+				row += step
+			}
+		}
+		row = min(max(row, 0), e.buf.lineCount()-1)
+		col := 0
+		if row == e.buf.lineCount()-1 && step > 0 {
+			col = len(e.buf.line(row))
+		}
+		return vimMotion{pos: textPos{row: row, col: col}}, vimDone
+	case '%':
+		match, ok := v.matchingBracket(pos)
+		if !ok {
+			return vimMotion{}, vimInvalid
+		}
+		return vimMotion{pos: match, inclusive: true}, vimDone
+	case 'f', 'F', 't', 'T':
+		if len(keys) < 2 {
+			return vimMotion{}, vimMore
+		}
+		v.lastFind = [2]rune{k, keys[1].r}
+		return v.find(pos, k, keys[1].r, n, false)
+	case ';', ',':
+		if v.lastFind[0] == 0 {
+			return vimMotion{}, vimInvalid
+		}
+		k := v.lastFind[0]
+		if k2 := keys[0].r; k2 == ',' {
+			k = map[rune]rune{'f': 'F', 'F': 'f', 't': 'T', 'T': 't'}[k]
+		}
+		return v.find(pos, k, v.lastFind[1], n, true)
+	case 'H', 'M', 'L':
+		rows := e.displayedRows()
+		i := map[rune]int{'H': min(n-1, len(rows)-1), 'M': (len(rows) - 1) / 2, 'L': max(len(rows)-n, 0)}[k]
+		return vimMotion{pos: textPos{row: rows[i], col: firstNonBlank(e.buf.line(rows[i]))}, linewise: true}, vimDone
+	case 'n', 'N':
+		backward := v.searchBackward != (k == 'N')
+		for j := 0; j < n; j++ {
+			next, ok := v.nextMatch(pos, backward)
+			if !ok {
+				v.message = "Pattern not found"
+				return vimMotion{}, vimInvalid
+			}
+			pos = next
+		}
+		return vimMotion{pos: pos}, vimDone
+	}
+
+	return vimMotion{}, vimInvalid
+}
+
+// Finds a rune in the current line, "t" and "T" stop right before it. When
+// repeated they skip the one they already stopped before
+func (v *vimMode) find(pos textPos, k, target rune, n int, repeat bool) (vimMotion, vimStatus) {
+	line := v.editor.buf.line(pos.row)
+	col := pos.col
+	for j := 0; j < n; j++ {
+		skip := 1
+		if repeat && j == 0 && (k == 't' || k == 'T') {
+			skip = 2
+		}
+
+		found := false
+		if k == 'f' || k == 't' {
+			for c := col + skip; c < len(line); c++ {
+				if line[c] == target {
+					col, found = c, true
+					break
+				}
+			}
+		} else {
+			for c := col - skip; c >= 0; c-- {
+				if line[c] == target {
+					col, found = c, true
+					break
+				}
+			}
+		}
+		if !found {
+			return vimMotion{}, vimInvalid
+		}
+	}
+
+	switch k {
+	case 't':
+		col--
+	case 'T':
+		col++
+	}
+
+	return vimMotion{pos: textPos{row: pos.row, col: col}, inclusive: k == 'f' || k == 't'}, vimDone
+}
+
+// Words are runs of letters, digits and underscores or runs of other non
+// blank runes, WORDs are runs of non blank runes
+func (v *vimMode) class(pos textPos, big bool) int {
+	r, ok := v.editor.runeAt(pos)
+	switch {
+	case !ok || unicode.IsSpace(r):
+		return 0
+	case big || isWordRune(r):
+		return 1
+	}
+
+	return 2
+}
+
+// Empty lines count as words of their own
+func (v *vimMode) emptyLine(pos textPos) bool {
+	return pos.col == 0 && len(v.editor.buf.line(pos.row)) == 0
+}
+
+func (v *vimMode) wordForward(pos textPos, big bool) textPos {
+	e := v.editor
+	end := e.buf.end()
+	start := pos
+	class := v.class(pos, big)
+	pos = e.nextPos(pos)
+	if class != 0 {
+		for pos != end && pos.row == start.row && v.class(pos, big) == class {
+			pos = e.nextPos(pos)
+		}
+	}
+
+	for pos != end && v.class(pos, big) == 0 && !v.emptyLine(pos) {
+		pos = e.nextPos(pos)
+	}
+
+	return pos
+}
+
+func (v *vimMode) wordBackward(pos textPos, big bool) textPos {
+	e := v.editor
+	pos = e.prevPos(pos)
+	for pos != (textPos{}) && v.class(pos, big) == 0 && !v.emptyLine(pos) {
+		pos = e.prevPos(pos)
+	}
+
+	class := v.class(pos, big)
+	for class != 0 && pos.col > 0 && v.class(textPos{row: pos.row, col: pos.col - 1}, big) == class {
+		pos.col--
+	}
+
+	return pos
+}
+
+func (v *vimMode) wordEnd(pos textPos, big bool) textPos {
+	e := v.editor
+	end := e.buf.end()
+	pos = e.nextPos(pos)
+	for pos != end && v.class(pos, big) == 0 {
+		pos = e.nextPos(pos)
+	}
+
+	class := v.class(pos, big)
+	for class != 0 && v.class(textPos{row: pos.row, col: pos.col + 1}, big) == class {
+		pos.col++
+	}
+
+	return pos
+}
+
+func (v *vimMode) wordEndBackward(pos textPos) textPos {
+	e := v.editor
+	class := v.class(pos, false)
+	for pos != (textPos{}) && class != 0 && v.class(pos, false) == class {
+		pos = e.prevPos(pos)
+	}
+	for pos != (textPos{}) && v.class(pos, false) == 0 {
+		pos = e.prevPos(pos)
+	}
+
+	return pos
+}
+
+// The bracket matching the one under the cursor, or the first one after it
+// in the line
+func (v *vimMode) matchingBracket(pos textPos) (textPos, bool) {
+	e := v.editor
+	brackets := map[rune]rune{'(': ')', '[': ']', '{': '}', ')': '(', ']': '[', '}': '{'}
+	line := e.buf.line(pos.row)
+	col := pos.col
+	for col < len(line) && brackets[line[col]] == 0 {
+		col++
+	}
+	if col == len(line) {
+		return pos, false
+	}
+
+	pos.col = col
+	bracket := line[col]
+	return v.findUnmatched(pos, brackets[bracket], bracket, strings.ContainsRune("([{", bracket))
+}
+
+// Looks for a bracket that is not matched by the ones in between
+func (v *vimMode) findUnmatched(pos textPos, target, other rune, forward bool) (textPos, bool) {
+	e := v.editor
+	depth := 0
+	for {
+		next := e.prevPos(pos)
+		if forward {
+			next = e.nextPos(pos)
+		}
+		if next == pos {
+			return pos, false
+		}
+		pos = next
+
+		r, ok := e.runeAt(pos)
+		switch {
+		case !ok:
+		case r == target && depth == 0:
+			return pos, true
+		case r == target:
+			depth--
+		case r == other:
+			depth++
+		}
+	}
+}
+
+// The text of a word, quoted string or brackets around the cursor, inner
+// ones leave the surrounding space, quotes or brackets out
+func (v *vimMode) textObject(inner bool, object rune) (textPos, textPos, bool) {
+	e := v.editor
+	pos := e.cursor
+	line := e.buf.line(pos.row)
+
+	switch object {
+	case 'w', 'W':
+		big := object == 'W'
+		class := v.class(pos, big)
+		start, end := pos.col, pos.col
+		for start > 0 && v.class(textPos{row: pos.row, col: start - 1}, big) == class {
+			start--
+		}
+		for end < len(line) && v.class(textPos{row: pos.row, col: end}, big) == class {
+			end++
+		}
+		if !inner {
+			switch {
+			case end < len(line) && unicode.IsSpace(line[end]):
+				for end < len(line) && unicode.IsSpace(line[end]) {
+					end++
+				}
+			default:
+				for start > 0 && unicode.IsSpace(line[start-1]) {
+					start--
+				}
+			}
+		}
+		return textPos{row: pos.row, col: start}, textPos{row: pos.row, col: end}, end > start
+	case '"', '\'', '`':
+		// Quotes are paired from the start of the line, the cursor is either
+		// inside a pair or before the next one
+		quotes := make([]int, 0)
+		for c, r := range line {
+			if r == object && (c == 0 || line[c-1] != '\\') {
+				quotes = append(quotes, c)
+			}
+		}
+		for j := 0; j+1 < len(quotes); j += 2 {
+			start, end := quotes[j], quotes[j+1]
+			if end < pos.col {
+				continue
+			}
+			if inner {
+				return textPos{row: pos.row, col: start + 1}, textPos{row: pos.row, col: end}, true
+			}
+			return textPos{row: pos.row, col: start}, textPos{row: pos.row, col: end + 1}, true
+		}
+		return pos, pos, false
+	}
+
+	pairs := map[rune][2]rune{
+		'(': {'(', ')'}, ')': {'(', ')'}, 'b': {'(', ')'},
+		'{': {'{', '}'}, '}': {'{', '}'}, 'B': {'{', '}'},
+		'[': {'[', ']'}, ']': {'[', ']'},
+		'<': {'<', '>'}, '>': {'<', '>'},
+	}
+	pair, ok := pairs[object]
+	if !ok {
+		return pos, pos, false
+	}
+
+	open, ok := pos, false
+	if r, isRune := e.runeAt(pos); isRune && r == pair[0] {
+		ok = true
+	} else {
+		open, ok = v.findUnmatched(pos, pair[0], pair[1], false)
+	}
+	if !ok {
+		return pos, pos, false
+	}
+
+	closing, ok := v.findUnmatched(open, pair[1], pair[0], true)
+	if !ok {
+		return pos, pos, false
+	}
+
+	if inner {
+		// Blocks spanning lines keep their brackets on lines of their own
+		start, end := e.nextPos(open), closing
+		if start.col == len(e.buf.line(open.row)) && closing.row > open.row {
+			start = textPos{row: open.row + 1}
+			if closing.row > start.row && strings.TrimSpace(string(e.buf.line(closing.row)[:closing.col])) == "" {
+				end = textPos{row: closing.row}
+			}
+		}
+		return start, end, true
+	}
+
+	return open, e.nextPos(closing), true
+}
+
+func (v *vimMode) wordAt(pos textPos) string {
+	line := v.editor.buf.line(pos.row)
+	start, end := pos.col, pos.col
+	for start > 0 && start <= len(line) && isWordRune(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isWordRune(line[end]) {
+		end++
+	}
+
+	return string(line[start:end])
+}
+
+// Enters insert mode at the place each command does
+func (v *vimMode) insertCommand(k rune) {
+	e := v.editor
+	line := e.buf.line(e.cursor.row)
+	switch k {
+	case 'a':
+		e.cursor.col = min(e.cursor.col+1, len(line))
+	case 'I':
+		e.cursor.col = firstNonBlank(line)
+	case 'A':
+		e.cursor.col = len(line)
+	case 'o':
+		indent := leadingIndent(line)
+		e.cursor = v.replace(textPos{row: e.cursor.row, col: len(line)}, textPos{row: e.cursor.row, col: len(line)}, "\n"+indent)
+	case 'O':
+		indent := leadingIndent(line)
+		v.replace(textPos{row: e.cursor.row}, textPos{row: e.cursor.row}, indent+"\n")
+		e.cursor = textPos{row: e.cursor.row, col: len([]rune(indent))}
+	}
+
+	v.enterInsert()
+}
+
+func (v *vimMode) enterInsert() {
+	v.state = vimInsert
+	v.editor.anchor = v.editor.cursor
+}
+
+// Leaving insert mode moves the cursor back onto the last character typed
+func (v *vimMode) leaveInsert() {
+	e := v.editor
+	v.state = vimNormal
+	e.completion.hide()
+	e.hideInfo()
+	e.releaseEditGroup()
+
+	if !v.replaying && v.recording != nil {
+		v.lastChange, v.recording = v.recording, nil
+	}
+
+	if e.cursor.col > 0 {
+		e.cursor.col--
+	}
+	e.anchor = e.cursor
+	e.scrollToCursor()
+	e.Refresh()
+	e.cursorChanged()
+}
+
+func (v *vimMode) leaveVisual() {
+	v.state = vimNormal
+	v.editor.cursor = v.editor.buf.clamp(v.pos)
+	v.editor.anchor = v.editor.cursor
+}
+
+// Selects what visual mode covers, which includes the character under the
+// cursor or whole lines
+func (v *vimMode) selectVisual() {
+	e := v.editor
+	start, end := orderPos(v.visualStart, v.pos)
+	if v.state == vimVisualLine {
+		start, end = textPos{row: start.row}, textPos{row: end.row, col: len(e.buf.line(end.row))}
+	} else if end.col < len(e.buf.line(end.row)) {
+		end.col++
+	}
+
+	if v.pos.before(v.visualStart) {
+		e.anchor, e.cursor = end, start
+	} else {
+		e.anchor, e.cursor = start, end
+	}
+	v.selAnchor, v.selCursor = e.anchor, e.cursor
+}
+
+func (v *vimMode) enterCommandLine(prefix string) {
+	if v.state == vimVisual || v.state == vimVisualLine {
+		v.leaveVisual()
+	}
+	v.state = vimCommandLine
+	v.cmdline = prefix
+}
+
+func (v *vimMode) leaveCommandLine() {
+	v.state = vimNormal
+	v.cmdline = ""
+}
+
+// Runs what was typed after ":", or searches for what was typed after "/"
+// and "?"
+func (v *vimMode) executeCommandLine(cmdline string) {
+	e := v.editor
+	if len(cmdline) == 0 {
+		return
+	}
+
+	switch cmdline[0] {
+	case '/', '?':
+		if len(cmdline) > 1 {
+			v.search(cmdline[1:], cmdline[0] == '?')
+		} else if e.search != nil {
+			v.searchBackward = cmdline[0] == '?'
+			v.feed(vimKey{r: 'n'})
+		}
+		return
+	}
+
+	cmd := strings.TrimSpace(cmdline[1:])
+	rows := [2]int{e.cursor.row, e.cursor.row}
+	switch {
+	case strings.HasPrefix(cmd, "%"):
+		rows, cmd = [2]int{0, e.buf.lineCount() - 1}, cmd[1:]
+	case strings.HasPrefix(cmd, "'<,'>"):
+		start, end := orderPos(v.visualStart, v.pos)
+		rows, cmd = [2]int{start.row, end.row}, cmd[len("'<,'>"):]
+	}
+
+	line, err := strconv.Atoi(cmd)
+	switch {
+	case err == nil:
+		row := min(max(line, 1), e.buf.lineCount()) - 1
+		v.moveTo(textPos{row: row, col: firstNonBlank(e.buf.line(row))})
+	case cmd == "w" || cmd == "w!" || cmd == "write":
+		e.runCommand("save")
+	case cmd == "q" || cmd == "q!" || cmd == "quit":
+		e.runCommand("tab.close")
+	case cmd == "wq" || cmd == "x" || cmd == "xit":
+		e.runCommand("save")
+		e.runCommand("tab.close")
+	case strings.HasPrefix(cmd, "!"):
+		e.runCommand("run")
+	case cmd == "noh" || cmd == "nohlsearch":
+		e.setSearch(nil)
+	case cmd == "u" || cmd == "undo":
+		e.undo()
+	case cmd == "red" || cmd == "redo":
+		e.redo()
+	case strings.HasPrefix(cmd, "s") && len(cmd) > 1 && !unicode.IsLetter(rune(cmd[1])):
+		v.message = v.substitute(rows[0], rows[1], cmd[1:])
+	default:
+		v.message = fmt.Sprintf("Not an editor command: %s", cmd)
+	}
+
+	v.clampCursor()
+	e.scrollToCursor()
+	e.Refresh()
+	e.cursorChanged()
+}
+
+// Runs ":s/pattern/replacement/flags" on the given lines, where the
+// pattern is a Go regular expression. Returns what went wrong, if anything
+func (v *vimMode) substitute(first, last int, cmd string) string {
+	e := v.editor
+	parts := splitEscaped(cmd[1:], rune(cmd[0]))
+	if len(parts) < 2 {
+		return fmt.Sprintf("Invalid substitute: %s", cmd)
+	}
+
+	pattern := parts[0]
+	flags := ""
+	if len(parts) > 2 {
+		flags = parts[2]
+	}
+	if strings.Contains(flags, "i") {
+		pattern = "(?i)" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Sprintf("Invalid pattern: %s", parts[0])
+	}
+
+	// Vim's \1 and & are Go's ${1} and ${0}
+	replacement := regexp.MustCompile(`\\(\d)|\\&|&|\$`).ReplaceAllStringFunc(parts[1], func(s string) string {
+		switch {
+		case s == "$":
+			return "$$"
+		case s == "&":
+			return "${0}"
+		case s == `\&`:
+			return "&"
+		}
+		return "${" + s[1:] + "}"
+	})
+
+	lines := make([]string, 0, last-first+1)
+	replaced := false
+	for row := first; row <= last; row++ {
+		line := string(e.buf.line(row))
+		match := re.FindStringSubmatchIndex(line)
+		switch {
+		case match == nil:
+		case strings.Contains(flags, "g"):
+			line = re.ReplaceAllString(line, replacement)
+		default:
+			// Expanded against the whole line, so anchors and word
+			// boundaries match as they did when it was found
+			expanded := re.ExpandString(nil, replacement, line, match)
+			line = line[:match[0]] + string(expanded) + line[match[1]:]
+		}
+		replaced = replaced || match != nil
+		lines = append(lines, line)
+	}
+
+	if !replaced {
+		return fmt.Sprintf("Pattern not found: %s", parts[0])
+	}
+
+	e.anchor = e.cursor
+	e.replaceRows(first, last, lines)
+	e.cursor = textPos{row: first, col: firstNonBlank(e.buf.line(first))}
+	return ""
+}
+
+// Splits the text at every separator that is not escaped with a backslash
+func splitEscaped(text string, sep rune) []string {
+	parts := make([]string, 0, 3)
+	var sb strings.Builder
+	escaped := false
+	for _, r := range text {
+		switch {
+		case escaped:
+			if r != sep {
+				sb.WriteRune('\\')
+			}
+			sb.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == sep:
+			parts = append(parts, sb.String())
+			sb.Reset()
+		default:
+			sb.WriteRune(r)
+		}
+	}
+
+	return append(parts, sb.String())
+}
+
+// Highlights the matches of the pattern and moves to the next one
+func (v *vimMode) search(pattern string, backward bool) {
+	e := v.editor
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		v.message = fmt.Sprintf("Invalid pattern: %s", pattern)
+		return
+	}
+
+	v.searchBackward = backward
+	e.setSearch(re)
+	next, ok := v.nextMatch(e.cursor, backward)
+	if !ok {
+		v.message = fmt.Sprintf("Pattern not found: %s", pattern)
+		return
+	}
+
+	v.moveTo(next)
+}
+
+// The start of the match after the given position, or before it, wrapping
+// around the ends of the code
+func (v *vimMode) nextMatch(pos textPos, backward bool) (textPos, bool) {
+	matches := v.editor.matches
+	if len(matches) == 0 {
+		return pos, false
+	}
+
+	if backward {
+		for i := len(matches) - 1; i >= 0; i-- {
+			if matches[i].start.before(pos) {
+				return matches[i].start, true
+			}
+		}
+		return matches[len(matches)-1].start, true
+	}
+
+	for _, m := range matches {
+		if pos.before(m.start) {
+			return m.start, true
+		}
+	}
+
+	return matches[0].start, true
+}
+
+// Commands starting with "z", scrolling or folding
+func (v *vimMode) zCommand(k rune) vimStatus {
+	e := v.editor
+	switch k {
+	case 'z':
+		e.top, _ = e.stepRows(e.cursor.row, -e.visibleRows()/2)
+	case 't':
+		e.top = e.cursor.row
+	case 'b':
+		e.top, _ = e.stepRows(e.cursor.row, 1-e.visibleRows())
+	case 'a':
+		if _, ok := e.foldAt(e.cursor.row); ok {
+			e.toggleFold(e.cursor.row)
+		} else {
+			e.fold()
+		}
+	case 'c':
+		e.fold()
+	case 'o':
+		e.unfold()
+	case 'M':
+		e.foldAll(true)
+	case 'R':
+		e.foldAll(false)
+	default:
+		return vimInvalid
+	}
+
+	return vimDone
+}
+
+// Joins the lines, separating them with a space unless the next one is
+// empty or starts with a closing bracket
+func (v *vimMode) join(first, last int) {
+	e := v.editor
+	last = min(last, e.buf.lineCount()-1)
+	for row := first; row < last; row++ {
+		line := e.buf.line(first)
+		next := e.buf.line(first + 1)
+		indent := len([]rune(leadingIndent(next)))
+		rest := strings.TrimLeft(string(next), " \t")
+
+		sep := " "
+		if len(rest) == 0 || strings.HasPrefix(rest, ")") || len(line) == 0 || unicode.IsSpace(line[len(line)-1]) {
+			sep = ""
+		}
+
+		start := textPos{row: first, col: len(line)}
+		v.replace(start, textPos{row: first + 1, col: indent}, sep)
+		e.cursor = textPos{row: first, col: max(start.col+len(sep)-1, 0)}
+	}
+}
+
+// Puts the register's text after the cursor, or before it, as many times
+// as the count
+func (v *vimMode) put(register rune, n int, before bool) {
+	reg, ok := v.getRegister(register)
+	if !ok {
+		v.message = fmt.Sprintf("Nothing in register %c", register)
+		return
+	}
+
+	v.insertAt(v.editor.cursor, strings.Repeat(reg.text, n), reg.linewise, before)
+}
+
+func (v *vimMode) insertAt(pos textPos, text string, linewise, before bool) {
+	e := v.editor
+	switch {
+	case linewise && before:
+		v.replace(textPos{row: pos.row}, textPos{row: pos.row}, text)
+		e.cursor = textPos{row: pos.row, col: firstNonBlank(e.buf.line(pos.row))}
+	case linewise:
+		end := textPos{row: pos.row, col: len(e.buf.line(pos.row))}
+		v.replace(end, end, "\n"+strings.TrimSuffix(text, "\n"))
+		e.cursor = textPos{row: pos.row + 1, col: firstNonBlank(e.buf.line(pos.row + 1))}
+	default:
+		if !before && len(e.buf.line(pos.row)) > 0 {
+			pos.col = min(pos.col+1, len(e.buf.line(pos.row)))
+		}
+		end := v.replace(pos, pos, text)
+		e.cursor = e.prevPos(end)
+		if len(text) == 0 {
+			e.cursor = pos
+		}
+	}
+}
+
+// "." runs the last command that changed the code again, along with what
+// was typed in insert mode if it entered it
+func (v *vimMode) repeat() {
+	if len(v.lastChange) == 0 || v.replaying {
+		return
+	}
+
+	e := v.editor
+	keys := v.lastChange
+	v.replaying = true
+	v.pending = nil
+	for _, k := range keys {
+		switch {
+		case len(k.name) > 0:
+			e.TypedKey(&fyne.KeyEvent{Name: k.name})
+		default:
+			e.TypedRune(k.r)
+		}
+	}
+	if v.state == vimInsert {
+		v.leaveInsert()
+	}
+	v.replaying = false
+	v.edited, v.repeated = true, true
+}
+
+// Registers "a" to "z" are set by name, "A" to "Z" append to them, "+"
+// and "*" are the clipboard and "_" discards. Yanks are also kept in "0"
+// and deletions in "1" to "9"
+func (v *vimMode) setRegister(name rune, text string, linewise, yank bool) {
+	reg := vimRegister{text: text, linewise: linewise}
+	switch {
+	case name == '_':
+		return
+	case name >= 'A' && name <= 'Z':
+		lower := unicode.ToLower(name)
+		prev := v.registers[lower]
+		reg = vimRegister{text: prev.text + text, linewise: prev.linewise || linewise}
+		name = lower
+	case name == '+' || name == '*':
+		if v.editor.clipboard != nil {
+			v.editor.clipboard.SetContent(text)
+		}
+	}
+
+	if name != '"' {
+		v.registers[name] = reg
+	} else if yank {
+		v.registers['0'] = reg
+	} else {
+		for i := '9'; i > '1'; i-- {
+			v.registers[i] = v.registers[i-1]
+		}
+		v.registers['1'] = reg
+	}
+	v.registers['"'] = reg
+}
+
+func (v *vimMode) getRegister(name rune) (vimRegister, bool) {
+	if (name == '+' || name == '*') && v.editor.clipboard != nil {
+		text := v.editor.clipboard.Content()
+		return vimRegister{text: text, linewise: strings.HasSuffix(text, "\n")}, len(text) > 0
+	}
+
+	reg, ok := v.registers[unicode.ToLower(name)]
+	return reg, ok
+}
+
+// Edits the code, the editor is told once the whole command ran
+func (v *vimMode) replace(start, end textPos, text string) textPos {
+	v.edited = true
+	return v.editor.replace(start, end, text)
+}
+
+// Moves the cursor after a motion, keeping the column it moves vertically on
+func (v *vimMode) moveTo(pos textPos) {
+	e := v.editor
+	e.cursor = e.buf.clamp(pos)
+	e.anchor = e.cursor
+	e.goalCol = visualCol(e.buf.line(e.cursor.row), e.cursor.col)
+}
+
+// In normal mode the cursor sits on a character, never after the last one
+func (v *vimMode) clampCursor() {
+	e := v.editor
+	if v.state != vimNormal {
+		return
+	}
+
+	goalCol := e.goalCol
+	e.cursor = e.buf.clamp(e.cursor)
+	if line := e.buf.line(e.cursor.row); e.cursor.col > 0 && e.cursor.col >= len(line) {
+		e.cursor.col = len(line) - 1
+	}
+	e.anchor = e.cursor
+	e.goalCol = goalCol
+}
+
+// Moves the cursor by the given number of lines, scrolling along
+func (v *vimMode) scroll(rows int) {
+	e := v.editor
+	row, _ := e.stepRows(e.cursor.row, rows)
+	e.top, _ = e.stepRows(e.top, rows)
+	v.moveTo(textPos{row: row, col: firstNonBlank(e.buf.line(row))})
+	v.clampCursor()
+	e.scrollToCursor()
+	e.Refresh()
+	e.cursorChanged()
+}
+
+func firstNonBlank(line []rune) int {
+	return len([]rune(leadingIndent(line)))
+}
+
+func toggleCase(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, text)
+}
+
+func lastRune(text string) (rune, int) {
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return 0, 0
+	}
+
+	r := runes[len(runes)-1]
+	return r, len(string(r))
+}
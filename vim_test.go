@@ -0,0 +1,213 @@
+/*
+	SPDX-FileCopyrightText: 2023 Kevin Suñer <keware.dev@proton.me>
+	SPDX-License-Identifier: MIT
+*/
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/test"
+)
+
+// An editor in the given key mode, with the app's commands it runs kept in
+// order. Work scheduled for the UI is queued and never run
+func newModeEditor(t *testing.T, keybindings, text string) (*editor, *[]string) {
+	test.NewApp()
+	queueUI(t)
+	previous := currentSettings
+	t.Cleanup(func() { currentSettings = previous })
+	currentSettings = defaultSettings()
+	currentSettings.Keybindings = keybindings
+
+	e := playgroundEditor(playgroundConsole(), nil, newErrorBanner())
+	commands := make([]string, 0)
+	e.onCommand = func(id string) {
+		commands = append(commands, id)
+	}
+	e.SetText(text)
+	e.anchor, e.cursor = textPos{}, textPos{}
+
+	return e, &commands
+}
+
+// Types keys written as vim writes them, e.g. "cwfoo<Esc>" or "<C-r>"
+func typeVimKeys(e *editor, keys string) {
+	names := map[string]fyne.KeyName{"<Esc>": fyne.KeyEscape, "<CR>": fyne.KeyReturn, "<BS>": fyne.KeyBackspace}
+	for len(keys) > 0 {
+		if strings.HasPrefix(keys, "<C-") {
+			end := strings.IndexRune(keys, '>')
+			e.TypedShortcut(&desktop.CustomShortcut{KeyName: fyne.KeyName(strings.ToUpper(keys[3:end])), Modifier: fyne.KeyModifierControl})
+			keys = keys[end+1:]
+			continue
+		}
+
+		named := false
+		for notation, name := range names {
+			if strings.HasPrefix(keys, notation) {
+				e.TypedKey(&fyne.KeyEvent{Name: name})
+				keys, named = keys[len(notation):], true
+				break
+			}
+		}
+		if !named {
+			r := []rune(keys)[0]
+			e.TypedRune(r)
+			keys = keys[len(string(r)):]
+		}
+	}
+}
+
+func TestVimMotions(t *testing.T) {
+	tests := []struct {
+		name	string
+		text	string
+		keys	string
+		want	textPos
+	}{
+		{name: "word", text: "foo bar baz", keys: "w", want: textPos{0, 4}},
+		{name: "count", text: "foo bar baz", keys: "2w", want: textPos{0, 8}},
+		{name: "word back", text: "foo bar baz", keys: "$b", want: textPos{0, 8}},
+		{name: "word end", text: "foo bar baz", keys: "e", want: textPos{0, 2}},
+		{name: "line end", text: "foo bar baz", keys: "$", want: textPos{0, 10}},
+		{name: "line start", text: "foo bar baz", keys: "$0", want: textPos{0, 0}},
+		{name: "last line", text: "a\nb\nc", keys: "G", want: textPos{2, 0}},
+		{name: "first line", text: "a\nb\nc", keys: "Ggg", want: textPos{0, 0}},
+		{name: "line number", text: "a\nb\nc", keys: ":2<CR>", want: textPos{1, 0}},
+		{name: "down keeps the end", text: "abc\nde", keys: "$j", want: textPos{1, 1}},
+		{name: "find", text: "f(a, b)", keys: "f,", want: textPos{0, 3}},
+		{name: "till", text: "f(a, b)", keys: "t,", want: textPos{0, 2}},
+		{name: "matching bracket", text: "f(a, b)", keys: "f(%", want: textPos{0, 6}},
+		{name: "search", text: "foo\nbar foo", keys: "/foo<CR>", want: textPos{1, 4}},
+		{name: "search again", text: "foo\nbar foo", keys: "/foo<CR>n", want: textPos{0, 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, _ := newModeEditor(t, KEYBINDINGS_VIM, test.text)
+			typeVimKeys(e, test.keys)
+
+			if e.cursor != test.want {
+				t.Errorf("got cursor %v, want %v", e.cursor, test.want)
+			}
+		})
+	}
+}
+
+func TestVimEdits(t *testing.T) {
+	tests := []struct {
+		name	string
+		text	string
+		keys	string
+		want	string
+	}{
+		{name: "delete word", text: "foo bar", keys: "dw", want: "bar"},
+		{name: "change word", text: "foo bar", keys: "cwbaz<Esc>", want: "baz bar"},
+		{name: "delete line", text: "a\nb\nc", keys: "dd", want: "b\nc"},
+		{name: "delete lines", text: "a\nb\nc", keys: "2dd", want: "c"},
+		{name: "delete to the end", text: "foo bar", keys: "wd$", want: "foo "},
+		{name: "change inside brackets", text: "f(a, b)", keys: "f(ci(x<Esc>", want: "f(x)"},
+		{name: "delete around word", text: "foo bar baz", keys: "wdaw", want: "foo baz"},
+		{name: "delete char", text: "abc", keys: "x", want: "bc"},
+		{name: "replace char", text: "abc", keys: "rx", want: "xbc"},
+		{name: "toggle case", text: "abc", keys: "~", want: "Abc"},
+		{name: "join", text: "a\nb", keys: "J", want: "a b"},
+		{name: "open line", text: "a\nb", keys: "onew<Esc>", want: "a\nnew\nb"},
+		{name: "append", text: "a\nb", keys: "Ax<Esc>", want: "ax\nb"},
+		{name: "undo", text: "foo bar", keys: "xdwu", want: "oo bar"},
+		{name: "redo", text: "foo bar", keys: "xdwu<C-r>", want: "bar"},
+		{name: "repeat", text: "foo bar baz", keys: "dw.", want: "baz"},
+		{name: "repeat insert", text: "a\nb", keys: "Ax<Esc>j.", want: "ax\nbx"},
+		{name: "visual delete", text: "foo bar", keys: "vlld", want: " bar"},
+		{name: "visual line delete", text: "a\nb\nc", keys: "Vjd", want: "c"},
+		{name: "indent", text: "a", keys: ">>", want: "\ta"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, _ := newModeEditor(t, KEYBINDINGS_VIM, test.text)
+			typeVimKeys(e, test.keys)
+
+			if got := e.Text(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestVimRegisters(t *testing.T) {
+	tests := []struct {
+		name	string
+		text	string
+		keys	string
+		want	string
+	}{
+		{name: "yank and put", text: "a\nb", keys: "yyp", want: "a\na\nb"},
+		{name: "put before", text: "a\nb", keys: "jyyP", want: "a\nb\nb"},
+		{name: "named register", text: "a\nb", keys: "\"ayyj\"ap", want: "a\nb\na"},
+		{name: "appending to a register", text: "a\nb", keys: "\"ayyj\"Ayy\"ap", want: "a\nb\na\nb"},
+		{name: "yank register after a delete", text: "a\nb\nc", keys: "yyjdd\"0p", want: "a\nc\na"},
+		{name: "delete registers shift", text: "a\nb\nc", keys: "dddd\"2p", want: "c\na"},
+		{name: "black hole", text: "a\nb", keys: "yyj\"_ddp", want: "a\na"},
+		{name: "characters", text: "foo bar", keys: "yiw$p", want: "foo barfoo"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, _ := newModeEditor(t, KEYBINDINGS_VIM, test.text)
+			typeVimKeys(e, test.keys)
+
+			if got := e.Text(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestVimCommandLine(t *testing.T) {
+	tests := []struct {
+		name			string
+		text			string
+		keys			string
+		want			string
+		wantCommands	[]string
+	}{
+		{name: "substitute", text: "aa\naa", keys: ":s/a/b/<CR>", want: "ba\naa"},
+		{name: "substitute every match", text: "aa\naa", keys: ":s/a/b/g<CR>", want: "bb\naa"},
+		{name: "substitute every line", text: "aa\naa", keys: ":%s/a/b/<CR>", want: "ba\nba"},
+		{name: "substitute ignoring case", text: "Aa", keys: ":s/a/b/i<CR>", want: "ba"},
+		{name: "substitute at the end", text: "aa", keys: ":s/a$/b/<CR>", want: "ab"},
+		{name: "substitute at the start", text: "aa", keys: ":s/^a/b/<CR>", want: "ba"},
+		{name: "substitute a whole word", text: "axx x xx", keys: `:s/\bx\b/y/<CR>`, want: "axx y xx"},
+		{name: "substitute followed by a letter", text: "xy xy", keys: `:s/x\B/z/<CR>`, want: "zy xy"},
+		{name: "substitute groups", text: "ab ab", keys: `:s/(a)(b)/\2\1/<CR>`, want: "ba ab"},
+		{name: "substitute the match", text: "ab", keys: ":s/b/[&]/<CR>", want: "a[b]"},
+		{name: "substitute a dollar", text: "a", keys: ":s/a/$1/<CR>", want: "$1"},
+		{name: "substitute the selection", text: "a\na\na", keys: "Vj:s/a/b/<CR>", want: "b\nb\na"},
+		{name: "substitute nothing", text: "a", keys: ":s/x/y/<CR>", want: "a"},
+		{name: "write", text: "a", keys: ":w<CR>", want: "a", wantCommands: []string{"save"}},
+		{name: "write and quit", text: "a", keys: ":wq<CR>", want: "a", wantCommands: []string{"save", "tab.close"}},
+		{name: "quit", text: "a", keys: ":q!<CR>", want: "a", wantCommands: []string{"tab.close"}},
+		{name: "run", text: "a", keys: ":!go run .<CR>", want: "a", wantCommands: []string{"run"}},
+		{name: "unknown command", text: "a", keys: ":nope<CR>", want: "a"},
+		{name: "left with escape", text: "a", keys: ":w<Esc>", want: "a"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, commands := newModeEditor(t, KEYBINDINGS_VIM, test.text)
+			typeVimKeys(e, test.keys)
+
+			if got := e.Text(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if !slices.Equal(*commands, test.wantCommands) {
+				t.Errorf("got commands %q, want %q", *commands, test.wantCommands)
+			}
+		})
+	}
+}